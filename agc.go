@@ -0,0 +1,191 @@
+package voxaudio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LevelMeasure is how the AGC measures the input level
+type LevelMeasure int
+
+const (
+	LevelRMS  LevelMeasure = iota // RMS level in dBFS
+	LevelLUFS                     // K-weighted loudness in LUFS
+)
+
+// AGCOptions configures an AutomaticGainControl
+type AGCOptions struct {
+	Target  float64       // Level aimed for in dBFS or LUFS, default -20
+	Measure LevelMeasure  // How the level is measured, default RMS
+	MaxGain float64       // Highest gain in dB, default 30
+	MinGain float64       // Lowest gain in dB, default -20
+	Window  time.Duration // Time constant of the level measurement, default 400ms
+	Attack  time.Duration // Time constant of gain decreases, default 50ms
+	Release time.Duration // Time constant of gain increases, default 1s
+	Gate    float64       // Below this level the input is silence and the gain is held, default -50
+	Ceiling float64       // Limiter ceiling in dBFS, default -1
+}
+
+func (o AGCOptions) withDefaults() AGCOptions {
+	if o.Target == 0 {
+		o.Target = -20
+	}
+	if o.MaxGain == 0 {
+		o.MaxGain = 30
+	}
+	if o.MinGain == 0 {
+		o.MinGain = -20
+	}
+	if o.Window <= 0 {
+		o.Window = 400 * time.Millisecond
+	}
+	if o.Attack <= 0 {
+		o.Attack = 50 * time.Millisecond
+	}
+	if o.Release <= 0 {
+		o.Release = time.Second
+	}
+	if o.Gate == 0 {
+		o.Gate = -50
+	}
+	if o.Ceiling == 0 {
+		o.Ceiling = -1
+	}
+	return o
+}
+
+// smoothing returns the per sample coefficient of a time constant
+func smoothing(d time.Duration, rate int) float64 {
+	return math.Exp(-1 / (d.Seconds() * float64(rate)))
+}
+
+// AutomaticGainControl brings the input to a target level, so quiet and
+// loud microphones reach the model alike. A limiter keeps the amplified
+// audio from clipping. Frames are mono at any sample rate.
+type AutomaticGainControl struct {
+	options AGCOptions
+	ceiling float64
+
+	mu                      sync.Mutex
+	rate                    int
+	window, attack, release float64 // Smoothing coefficients at rate
+	gateWindow              float64
+	limiterRelease          float64
+	bypass                  bool
+	weighting               *kWeighting
+	meanSquare              float64 // Of the input while not gated, K-weighted for LUFS
+	recent                  float64 // Short-term mean square deciding the gate
+	gain                    float64 // Current gain in dB
+	envelope                float64 // Limiter peak envelope
+}
+
+// NewAutomaticGainControl returns an AGC starting at unity gain
+func NewAutomaticGainControl(options AGCOptions) *AutomaticGainControl {
+	options = options.withDefaults()
+	agc := &AutomaticGainControl{
+		options: options,
+		ceiling: dbToGain(options.Ceiling),
+	}
+	agc.configure(inputSampleRate)
+	return agc
+}
+
+// configure sets the coefficients for a sample rate; agc.mu must be held
+// unless agc is new
+func (agc *AutomaticGainControl) configure(rate int) {
+	agc.rate = rate
+	agc.window = smoothing(agc.options.Window, rate)
+	agc.attack = smoothing(agc.options.Attack, rate)
+	agc.release = smoothing(agc.options.Release, rate)
+	agc.gateWindow = smoothing(20*time.Millisecond, rate)
+	agc.limiterRelease = smoothing(50*time.Millisecond, rate)
+	agc.weighting = newKWeighting(rate)
+}
+
+// SetBypass passes the input through unchanged while enabled; the level is still measured
+func (agc *AutomaticGainControl) SetBypass(bypass bool) {
+	agc.mu.Lock()
+	defer agc.mu.Unlock()
+	agc.bypass = bypass
+}
+
+// Gain returns the current gain in dB
+func (agc *AutomaticGainControl) Gain() float64 {
+	agc.mu.Lock()
+	defer agc.mu.Unlock()
+	return agc.gain
+}
+
+// Level returns the measured input level in dBFS, or LUFS with LevelLUFS
+func (agc *AutomaticGainControl) Level() float64 {
+	agc.mu.Lock()
+	defer agc.mu.Unlock()
+	return agc.level()
+}
+
+func (agc *AutomaticGainControl) level() float64 {
+	if agc.options.Measure == LevelLUFS {
+		return loudness(agc.meanSquare)
+	}
+	return decibels(agc.meanSquare)
+}
+
+// Process returns the samples of a frame brought to the target level
+func (agc *AutomaticGainControl) Process(frame Frame) []float32 {
+	agc.mu.Lock()
+	defer agc.mu.Unlock()
+	if rate := frame.Format.SampleRate; rate > 0 && rate != agc.rate {
+		agc.configure(rate)
+	}
+	samples := frame.Samples
+	out := make([]float32, len(samples))
+	for i, sample := range samples {
+		x := float64(sample)
+		measured := x
+		if agc.options.Measure == LevelLUFS {
+			measured = agc.weighting.process(x)
+		}
+		agc.recent = agc.gateWindow*agc.recent + (1-agc.gateWindow)*measured*measured
+
+		// Follow the target, holding the level and gain through silence
+		if decibels(agc.recent) > agc.options.Gate {
+			agc.meanSquare = agc.window*agc.meanSquare + (1-agc.window)*measured*measured
+			target := math.Max(agc.options.MinGain, math.Min(agc.options.MaxGain, agc.options.Target-agc.level()))
+			coef := agc.release
+			if target < agc.gain {
+				coef = agc.attack
+			}
+			agc.gain = coef*agc.gain + (1-coef)*target
+		}
+		if agc.bypass {
+			out[i] = sample
+			continue
+		}
+
+		// Limit the peaks above the ceiling
+		y := x * dbToGain(agc.gain)
+		agc.envelope = math.Max(math.Abs(y), agc.envelope*agc.limiterRelease)
+		if agc.envelope > agc.ceiling {
+			y *= agc.ceiling / agc.envelope
+		}
+		out[i] = float32(y)
+	}
+	return out
+}
+
+// SetAGC levels the input with agc before upload, nil disables
+// Note: agc is the StageAGC stage of Processors
+func (s *Session) SetAGC(agc *AutomaticGainControl) {
+	if agc == nil {
+		s.setStage(StageAGC, nil)
+		return
+	}
+	s.setStage(StageAGC, agc)
+}
+
+// AGC returns the configured gain control, nil if none
+func (s *Session) AGC() *AutomaticGainControl {
+	agc, _ := stageOf[*AutomaticGainControl](s, StageAGC)
+	return agc
+}
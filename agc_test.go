@@ -0,0 +1,76 @@
+package voxaudio
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sine returns seconds of a sine wave at 24 kHz with the given peak amplitude
+func sine(freq, amplitude, seconds float64) []float32 {
+	out := make([]float32, int(seconds*inputSampleRate))
+	for i := range out {
+		out[i] = float32(amplitude * math.Sin(2*math.Pi*freq*float64(i)/inputSampleRate))
+	}
+	return out
+}
+
+func processChunks(agc *AutomaticGainControl, in []float32) []float32 {
+	var out []float32
+	for len(in) > 0 {
+		n := min(480, len(in))
+		out = append(out, agc.Process(Frame{Samples: in[:n], Format: uploadFormat})...)
+		in = in[n:]
+	}
+	return out
+}
+
+func TestKWeightingLoudness(t *testing.T) {
+	// A full scale 997 Hz sine reads -3.01 LUFS
+	k := newKWeighting(inputSampleRate)
+	var sum float64
+	in := sine(997, 1, 2)
+	for i, sample := range in {
+		y := k.process(float64(sample))
+		if i >= inputSampleRate {
+			sum += y * y
+		}
+	}
+	assert.InDelta(t, -3.01, loudness(sum/inputSampleRate), 0.05)
+}
+
+func TestAGCReachesTarget(t *testing.T) {
+	for _, measure := range []LevelMeasure{LevelRMS, LevelLUFS} {
+		agc := NewAutomaticGainControl(AGCOptions{Target: -20, Measure: measure})
+		in := sine(1000, 0.01*math.Sqrt2, 6) // -40 dBFS RMS
+		out := processChunks(agc, in)
+
+		assert.InDelta(t, -20, 20*math.Log10(rmsOf(out[len(out)-inputSampleRate:])), 1, "measure %d", measure)
+		assert.InDelta(t, 20, agc.Gain(), 1)
+		assert.InDelta(t, -40, agc.Level(), 1)
+	}
+}
+
+func TestAGCLimiterAndGate(t *testing.T) {
+	agc := NewAutomaticGainControl(AGCOptions{Target: -10, MaxGain: 30})
+
+	// Quiet speech raises the gain, then a loud burst must not clip
+	in := append(sine(300, 0.003, 4), sine(300, 0.9, 0.5)...)
+	out := processChunks(agc, in)
+	ceiling := dbToGain(-1)
+	for i, sample := range out {
+		if math.Abs(float64(sample)) > ceiling+1e-6 {
+			t.Fatalf("sample %d is %.3f, above the ceiling", i, sample)
+		}
+	}
+
+	// Silence holds the gain
+	gain := agc.Gain()
+	processChunks(agc, make([]float32, 2*inputSampleRate))
+	assert.InDelta(t, gain, agc.Gain(), 0.5)
+
+	agc.SetBypass(true)
+	quiet := sine(300, 0.003, 0.1)
+	assert.Equal(t, quiet, processChunks(agc, quiet))
+}
@@ -0,0 +1,252 @@
+package voxaudio
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"voxworld/wavfile"
+)
+
+// AudioSource supplies the input audio of a session
+type AudioSource interface {
+	Start(deviceName string) error
+	Stop() error
+	Audio() <-chan []float32 // Interleaved samples, closed when the source ends
+	Format() (sampleRate, channels int)
+}
+
+// Audio returns the channel of captured samples
+func (r *LoopbackRecorder) Audio() <-chan []float32 {
+	return r.Samples
+}
+
+// Format returns the sample rate and channel count of the opened stream
+func (r *LoopbackRecorder) Format() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.SampleRate, r.Channels
+}
+
+// fileChunk is the amount of audio delivered by a FileSource at a time
+const fileChunk = 100 * time.Millisecond
+
+// FileSource reads a WAV file as an AudioSource. The file can be delivered
+// faster than real time and paused while the consumer catches up.
+type FileSource struct {
+	mu     sync.Mutex
+	reader *wavfile.Reader
+	format wavfile.Format
+	speed  float64       // Relative to real time, 0 delivers as fast as possible
+	offset time.Duration // Position to start reading from
+	tail   time.Duration // Silence appended after the file
+	hold   func() bool   // Delivery pauses while it returns true
+
+	audio    chan []float32
+	stopCh   chan struct{}
+	done     chan struct{}
+	frames   int64 // Frames of the file delivered or skipped
+	err      error
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewFileSource opens the WAV file at path. It is delivered in real time
+// unless SetSpeed is called.
+func NewFileSource(path string) (*FileSource, error) {
+	reader, err := wavfile.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	return &FileSource{
+		reader: reader,
+		format: reader.Format(),
+		speed:  1,
+		audio:  make(chan []float32, 16),
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// SetSpeed sets the delivery speed relative to real time
+// Note: 0 delivers the file as fast as the consumer reads it
+func (f *FileSource) SetSpeed(speed float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.speed = speed
+}
+
+// SetOffset skips the beginning of the file
+// Note: Takes effect on Start
+func (f *FileSource) SetOffset(offset time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.offset = offset
+}
+
+// SetTailSilence appends silence after the file so that voice activity
+// detection can close the last turn
+func (f *FileSource) SetTailSilence(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tail = d
+}
+
+// SetHold registers a function that pauses delivery while it returns true
+func (f *FileSource) SetHold(hold func() bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hold = hold
+}
+
+// Start begins delivering the file. The device name is ignored.
+func (f *FileSource) Start(deviceName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.started {
+		return fmt.Errorf("file source already started")
+	}
+	f.started = true
+	go f.run()
+	return nil
+}
+
+// Stop ends delivery and closes the file
+func (f *FileSource) Stop() error {
+	f.stopOnce.Do(func() {
+		close(f.stopCh)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if !f.started {
+			// Let run release the file and close the channels
+			f.started = true
+			go f.run()
+		}
+	})
+	<-f.done
+	return nil
+}
+
+// Audio returns the channel of file samples
+func (f *FileSource) Audio() <-chan []float32 {
+	return f.audio
+}
+
+// Format returns the sample rate and channel count of the file
+func (f *FileSource) Format() (int, int) {
+	return f.format.SampleRate, f.format.Channels
+}
+
+// Position returns how far into the file the delivery has progressed
+func (f *FileSource) Position() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return time.Duration(f.frames) * time.Second / time.Duration(f.format.SampleRate)
+}
+
+// Done is closed when the whole file has been delivered or the source is stopped
+func (f *FileSource) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the read error that ended the delivery, if any
+func (f *FileSource) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *FileSource) run() {
+	defer close(f.done)
+	defer close(f.audio)
+	defer f.reader.Close()
+
+	f.mu.Lock()
+	speed, offset, tail, hold := f.speed, f.offset, f.tail, f.hold
+	f.mu.Unlock()
+
+	chunkFrames := int(int64(f.format.SampleRate) * int64(fileChunk) / int64(time.Second))
+	skip := int64(offset) * int64(f.format.SampleRate) / int64(time.Second)
+	tailFrames := int64(tail) * int64(f.format.SampleRate) / int64(time.Second)
+	buf := make([]float32, chunkFrames*f.format.Channels)
+	next := time.Now()
+
+	for {
+		select {
+		case <-f.stopCh:
+			return
+		default:
+		}
+
+		n, err := f.reader.ReadFloat32(buf)
+		frames := n / f.format.Channels
+		if err == io.EOF {
+			if tailFrames <= 0 {
+				return
+			}
+			// Deliver the trailing silence in chunks like the file itself
+			frames = chunkFrames
+			if int64(frames) > tailFrames {
+				frames = int(tailFrames)
+			}
+			tailFrames -= int64(frames)
+			clear(buf)
+			n = frames * f.format.Channels
+		} else if err != nil {
+			f.mu.Lock()
+			f.err = fmt.Errorf("failed to read input file: %w", err)
+			f.mu.Unlock()
+			return
+		}
+
+		// Skip to the start offset without delivering
+		data := buf[:n]
+		if skip > 0 {
+			if int64(frames) <= skip {
+				skip -= int64(frames)
+				f.addFrames(frames)
+				continue
+			}
+			data = data[skip*int64(f.format.Channels):]
+			frames -= int(skip)
+			f.addFrames(int(skip))
+			skip = 0
+		}
+
+		for hold != nil && hold() {
+			select {
+			case <-f.stopCh:
+				return
+			case <-time.After(20 * time.Millisecond):
+				next = time.Now()
+			}
+		}
+
+		if speed > 0 {
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-f.stopCh:
+					return
+				case <-time.After(wait):
+				}
+			}
+			duration := time.Duration(frames) * time.Second / time.Duration(f.format.SampleRate)
+			next = next.Add(time.Duration(float64(duration) / speed))
+		}
+
+		chunk := append([]float32(nil), data...)
+		select {
+		case <-f.stopCh:
+			return
+		case f.audio <- chunk:
+			f.addFrames(frames)
+		}
+	}
+}
+
+func (f *FileSource) addFrames(frames int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frames += int64(frames)
+}
@@ -0,0 +1,95 @@
+package voxaudio
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"voxworld/wavfile"
+)
+
+// writeRampWav writes a stereo file whose left channel counts frames
+func writeRampWav(t *testing.T, rate int, duration time.Duration) string {
+	path := filepath.Join(t.TempDir(), "input.wav")
+	w, err := wavfile.Create(path, wavfile.Format{SampleRate: rate, Channels: 2, SampleFormat: wavfile.Float32})
+	require.NoError(t, err)
+	frames := int(int64(rate) * int64(duration) / int64(time.Second))
+	samples := make([]float32, frames*2)
+	for i := 0; i < frames; i++ {
+		samples[i*2] = float32(i) / float32(frames)
+	}
+	require.NoError(t, w.WriteFloat32(samples))
+	require.NoError(t, w.Close())
+	return path
+}
+
+func TestFileSourceOffsetAndTail(t *testing.T) {
+	path := writeRampWav(t, 16000, time.Second)
+	source, err := NewFileSource(path)
+	require.NoError(t, err)
+	source.SetSpeed(0)
+	source.SetOffset(250 * time.Millisecond)
+	source.SetTailSilence(150 * time.Millisecond)
+
+	rate, channels := source.Format()
+	assert.Equal(t, 16000, rate)
+	assert.Equal(t, 2, channels)
+
+	require.NoError(t, source.Start(""))
+	var samples []float32
+	for chunk := range source.Audio() {
+		samples = append(samples, chunk...)
+	}
+	<-source.Done()
+
+	require.Len(t, samples, (12000+2400)*2)
+	assert.InDelta(t, 0.25, samples[0], 1e-6)
+	assert.InDelta(t, float32(15999)/16000, samples[11999*2], 1e-6)
+	assert.Equal(t, float32(0), samples[12000*2])
+	assert.Equal(t, 1150*time.Millisecond, source.Position())
+	assert.NoError(t, source.Err())
+	assert.NoError(t, source.Stop())
+	assert.Error(t, source.Start(""))
+}
+
+func TestFileSourcePacing(t *testing.T) {
+	path := writeRampWav(t, 8000, 400*time.Millisecond)
+	source, err := NewFileSource(path)
+	require.NoError(t, err)
+	source.SetSpeed(2)
+
+	var held atomic.Bool
+	held.Store(true)
+	source.SetHold(held.Load)
+	require.NoError(t, source.Start(""))
+
+	select {
+	case <-source.Audio():
+		t.Fatal("audio delivered while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	held.Store(false)
+	start := time.Now()
+	var frames int
+	for chunk := range source.Audio() {
+		frames += len(chunk) / 2
+	}
+	// 400ms at twice real time, the first chunk is sent immediately
+	assert.Equal(t, 3200, frames)
+	assert.GreaterOrEqual(t, time.Since(start), 140*time.Millisecond)
+}
+
+func TestFileSourceStopBeforeStart(t *testing.T) {
+	source, err := NewFileSource(writeRampWav(t, 8000, 100*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, source.Stop())
+	require.NoError(t, source.Stop())
+	_, ok := <-source.Audio()
+	assert.False(t, ok)
+	assert.Error(t, source.Start(""))
+}
@@ -0,0 +1,67 @@
+package voxaudio
+
+import "fmt"
+
+// SetBargeIn sets whether new speech interrupts the translation playing on
+// an output. Interrupting drops the queued audio, cancels the response and
+// truncates its item to the audio actually played. Enabled by default.
+func (s *Session) SetBargeIn(output Output, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bargeIn == nil {
+		s.bargeIn = make(map[Output]bool)
+	}
+	s.bargeIn[output] = enabled
+}
+
+// setKeepResponses keeps responses running when new speech starts, instead
+// of cancelling them on barge-in
+func (s *Session) setKeepResponses(keep bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepResponses = keep
+}
+
+// handleBargeIn interrupts the playing translation when the speaker starts talking
+func (s *Session) handleBargeIn(evt ServerEvent) {
+	if evt.Type != EventSpeechStarted {
+		return
+	}
+	s.mu.Lock()
+	if s.keepResponses {
+		s.mu.Unlock()
+		return
+	}
+	var playbacks []*playbackState
+	for _, p := range s.playbacks {
+		if s.bargeIn[p.output] {
+			playbacks = append(playbacks, p)
+		}
+	}
+	serverPlaying := s.serverPlaying
+	s.mu.Unlock()
+
+	// With several outputs the listener heard the furthest one
+	var itemID string
+	var playedMs int64 = -1
+	for _, p := range playbacks {
+		if id, ms, ok := p.interrupt(serverPlaying); ok && ms > playedMs {
+			itemID, playedMs = id, ms
+		}
+	}
+	if itemID == "" {
+		return
+	}
+
+	fmt.Printf("[Session] Barge-in: truncating item %s after %dms of playback\n", itemID, playedMs)
+	events := []map[string]interface{}{
+		{"type": "response.cancel"},
+		{"type": "output_audio_buffer.clear"},
+		{"type": "conversation.item.truncate", "item_id": itemID, "content_index": 0, "audio_end_ms": playedMs},
+	}
+	for _, evt := range events {
+		if err := s.sendEvent(evt); err != nil {
+			fmt.Printf("[Session] Failed to send %s: %v\n", evt["type"], err)
+		}
+	}
+}
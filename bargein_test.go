@@ -0,0 +1,138 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bargeInSession returns a session that records the events it sends
+func bargeInSession() (*Session, *[]map[string]interface{}) {
+	var mu sync.Mutex
+	sent := &[]map[string]interface{}{}
+	s := &Session{
+		bargeIn: map[Output]bool{OutputSpeaker: true, OutputBlackHole: true},
+		sender: func(msg string) error {
+			var evt map[string]interface{}
+			if err := json.Unmarshal([]byte(msg), &evt); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			*sent = append(*sent, evt)
+			return nil
+		},
+	}
+	return s, sent
+}
+
+// fakeOutput is a device queue of samples
+type fakeOutput struct {
+	queued  int64
+	flushed int
+}
+
+func (o *fakeOutput) register(s *Session, output Output) *playbackState {
+	return s.addPlayback(output, 0, func() int64 { return o.queued }, func() {
+		o.queued = 0
+		o.flushed++
+	})
+}
+
+func TestBargeInTruncatesPlayedAudio(t *testing.T) {
+	s, sent := bargeInSession()
+	out := &fakeOutput{}
+	playback := out.register(s, OutputSpeaker)
+	now := time.Now()
+
+	dispatchAt(t, s, now, `{"type":"response.output_item.added","response_id":"resp_1","item":{"id":"item_1","type":"message"}}`)
+	dispatchAt(t, s, now, `{"type":"output_audio_buffer.started","response_id":"resp_1"}`)
+	require.Equal(t, "item_1", s.outputItem())
+
+	// 2 seconds received, 500ms still queued
+	playback.queue(frameSize, false, "item_1") // Leading silence does not start the item
+	for i := 0; i < 100; i++ {
+		playback.queue(frameSize, true, "item_1")
+	}
+	out.queued = sampleRate / 2
+
+	dispatchAt(t, s, now, `{"type":"input_audio_buffer.speech_started","item_id":"item_2","audio_start_ms":3000}`)
+	assert.Equal(t, 1, out.flushed)
+	require.Len(t, *sent, 3)
+	assert.Equal(t, "response.cancel", (*sent)[0]["type"])
+	assert.Equal(t, "output_audio_buffer.clear", (*sent)[1]["type"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "conversation.item.truncate", "item_id": "item_1", "content_index": 0.0, "audio_end_ms": 1500.0,
+	}, (*sent)[2])
+
+	// The rest of the interrupted item is dropped, the next item plays
+	assert.True(t, playback.discard("item_1"))
+	dispatchAt(t, s, now, `{"type":"output_audio_buffer.stopped","response_id":"resp_1"}`)
+	dispatchAt(t, s, now, `{"type":"input_audio_buffer.speech_started","item_id":"item_3"}`)
+	assert.Len(t, *sent, 3, "nothing left to interrupt")
+
+	dispatchAt(t, s, now, `{"type":"response.output_item.added","response_id":"resp_2","item":{"id":"item_4","type":"message"}}`)
+	assert.False(t, playback.discard(s.outputItem()))
+}
+
+func TestBargeInPerOutput(t *testing.T) {
+	s, sent := bargeInSession()
+	s.SetBargeIn(OutputSpeaker, false)
+	speaker, blackHole := &fakeOutput{}, &fakeOutput{}
+	speakerPlayback := speaker.register(s, OutputSpeaker)
+	blackHolePlayback := blackHole.register(s, OutputBlackHole)
+
+	dispatchAt(t, s, time.Now(), `{"type":"response.output_item.added","response_id":"resp_1","item":{"id":"item_1","type":"message"}}`)
+	for i := 0; i < 50; i++ {
+		speakerPlayback.queue(frameSize, true, "item_1")
+		blackHolePlayback.queue(frameSize, true, "item_1")
+	}
+	speaker.queued, blackHole.queued = frameSize, frameSize
+
+	dispatchAt(t, s, time.Now(), `{"type":"input_audio_buffer.speech_started","item_id":"item_2"}`)
+	assert.Zero(t, speaker.flushed)
+	assert.Equal(t, 1, blackHole.flushed)
+	require.Len(t, *sent, 3)
+	assert.Equal(t, 980.0, (*sent)[2]["audio_end_ms"])
+
+	// Disabled everywhere, or kept responses, nothing is interrupted
+	s.SetBargeIn(OutputBlackHole, false)
+	dispatchAt(t, s, time.Now(), `{"type":"response.output_item.added","response_id":"resp_2","item":{"id":"item_5","type":"message"}}`)
+	blackHolePlayback.queue(frameSize, true, "item_5")
+	blackHole.queued = frameSize
+	dispatchAt(t, s, time.Now(), `{"type":"input_audio_buffer.speech_started","item_id":"item_6"}`)
+	s.SetBargeIn(OutputBlackHole, true)
+	s.setKeepResponses(true)
+	dispatchAt(t, s, time.Now(), `{"type":"input_audio_buffer.speech_started","item_id":"item_7"}`)
+	assert.Len(t, *sent, 3)
+	assert.Equal(t, 1, blackHole.flushed)
+
+	s.removePlayback(speakerPlayback)
+	s.removePlayback(blackHolePlayback)
+	assert.Empty(t, s.playbacks)
+}
+
+func TestPlaybackBuffer(t *testing.T) {
+	var b playbackBuffer
+	_, err := b.Write([]byte{1, 2, 3, 4})
+	require.NoError(t, err)
+	assert.Equal(t, 4, b.Len())
+
+	p := make([]byte, 2)
+	n, err := b.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, p[:n])
+
+	_, err = b.Seek(0, io.SeekStart)
+	assert.Error(t, err)
+	_, err = b.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Zero(t, b.Len())
+	_, err = b.Read(p)
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,581 @@
+package voxaudio
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchOptions configures the offline translation of an audio file
+type BatchOptions struct {
+	Speed           float64       // Upload speed relative to real time, default 4
+	MaxPendingTurns int           // Pause the upload while this many turns await translation, default 2
+	TailSilence     time.Duration // Silence appended so the last turn is detected, default 2s
+	IdleTimeout     time.Duration // Fail when no event arrives for this long while waiting, default 60s
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.Speed <= 0 {
+		o.Speed = 4
+	}
+	if o.MaxPendingTurns <= 0 {
+		o.MaxPendingTurns = 2
+	}
+	if o.TailSilence <= 0 {
+		o.TailSilence = 2 * time.Second
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 60 * time.Second
+	}
+	return o
+}
+
+// BatchTurn is one translated turn, as written to the transcript file
+type BatchTurn struct {
+	Index       int    `json:"index"`
+	StartMs     int64  `json:"start_ms"` // Position in the input file
+	EndMs       int64  `json:"end_ms"`
+	Source      string `json:"source,omitempty"`
+	Translation string `json:"translation"`
+	Status      string `json:"status,omitempty"` // Why the turn is untranslated, such as cancelled or incomplete
+}
+
+// batchState is the checkpoint that lets an interrupted batch resume
+type batchState struct {
+	Input      string   `json:"input"`
+	PositionMs int64    `json:"position_ms"` // Input translated up to here
+	Turns      int      `json:"turns"`       // Turns written to the transcript
+	Parts      []string `json:"parts"`       // Translated audio of each run
+	Complete   bool     `json:"complete"`
+}
+
+// batchTurn tracks a turn until both its transcript and translation are done
+type batchTurn struct {
+	BatchTurn
+	itemID     string
+	responses  []*batchResponse // Responses answering the turn, in order
+	sourceDone bool
+}
+
+// translated reports whether the last response of the turn has finished
+// without calling tools, whose continuation would answer the turn instead
+func (t *batchTurn) translated() bool {
+	if len(t.responses) == 0 {
+		return false
+	}
+	last := t.responses[len(t.responses)-1]
+	return last.status != "" && !last.calls
+}
+
+// batchResponse tracks a response until the turn it answers is written
+type batchResponse struct {
+	id         string
+	output     string     // First output item, links the response to its turn
+	turn       *batchTurn // Turn answered, nil until linked
+	transcript string
+	status     string // Final status, empty while running
+	calls      bool   // Called tools, a continuation response follows
+}
+
+// batchItem is a conversation item with the item before it
+type batchItem struct {
+	previous string
+	user     bool // Input from the user, such as typed text
+}
+
+// BatchTranslator translates a WAV file through a Session. The file is
+// uploaded faster than real time, and the translated audio and transcripts
+// are collected into files next to outputBase:
+//
+//	outputBase.partNNN.opus     translated audio, one file per run
+//	outputBase.transcript.jsonl one BatchTurn per line
+//	outputBase.state.json       checkpoint used to resume
+//
+// Running again after a failure continues after the last completed turn.
+// The audio part of a failed run may contain turns that are translated
+// again by the next run.
+type BatchTranslator struct {
+	mu         sync.Mutex
+	session    *Session
+	input      string
+	outputBase string
+	options    BatchOptions
+
+	state      batchState
+	baseMs     int64 // Input position where this run started
+	transcript *os.File
+	turns      []*batchTurn // Turns not yet written, in order
+	responses  map[string]*batchResponse
+	items      map[string]batchItem // Conversation items, to find the turn a response answers
+	speaking   bool
+	speechMs   int64 // Start of the current speech in this run's audio
+	lastEvent  time.Time
+	failed     error
+	start      func() error // Connects and starts the session, replaced in tests
+}
+
+// NewBatchTranslator prepares the translation of the WAV file at inputPath.
+// The session must not be connected or started; Run does both.
+func NewBatchTranslator(session *Session, inputPath, outputBase string, options BatchOptions) *BatchTranslator {
+	return &BatchTranslator{
+		session:    session,
+		input:      inputPath,
+		outputBase: outputBase,
+		options:    options.withDefaults(),
+	}
+}
+
+// TranscriptPath returns the path of the transcript file
+func (b *BatchTranslator) TranscriptPath() string {
+	return b.outputBase + ".transcript.jsonl"
+}
+
+// StatePath returns the path of the checkpoint file
+func (b *BatchTranslator) StatePath() string {
+	return b.outputBase + ".state.json"
+}
+
+// Run translates the file, or the rest of it when a previous run failed.
+// It returns when every turn is translated, ctx is cancelled or the
+// translation stalls. A session can only be used for one run.
+func (b *BatchTranslator) Run(ctx context.Context) error {
+	if err := b.prepare(); err != nil {
+		return err
+	}
+	defer b.transcript.Close()
+
+	if b.state.Complete {
+		fmt.Printf("[Batch] %s is already translated\n", b.input)
+		return nil
+	}
+
+	source, err := NewFileSource(b.input)
+	if err != nil {
+		return err
+	}
+	source.SetSpeed(b.options.Speed)
+	source.SetOffset(time.Duration(b.baseMs) * time.Millisecond)
+	source.SetTailSilence(b.options.TailSilence)
+	source.SetHold(b.hold)
+
+	partPath := fmt.Sprintf("%s.part%03d.opus", b.outputBase, len(b.state.Parts)+1)
+	sink, err := NewOggOpusSink(partPath)
+	if err != nil {
+		source.Stop()
+		return err
+	}
+	closeSink := sync.OnceValue(sink.Close)
+	b.mu.Lock()
+	b.state.Parts = append(b.state.Parts, filepath.Base(partPath))
+	err = b.saveState()
+	b.mu.Unlock()
+	if err != nil {
+		source.Stop()
+		closeSink()
+		return err
+	}
+
+	// Reuse the live session with the file as its input. Responses are kept
+	// running because the upload outpaces the translated speech.
+	b.session.SetAudioSource(source)
+	b.session.SetRecordFormat(RecordNone)
+	b.session.setKeepResponses(true)
+
+	// Save the translation of every connection, rotations continue the same track
+	b.session.handleTracks(func(track RTPReader) error {
+		b.receive(track, sink)
+		return nil
+	})
+
+	fmt.Printf("[Batch] Translating %s from %s at %.1fx real time\n",
+		b.input, time.Duration(b.baseMs)*time.Millisecond, b.options.Speed)
+	start := b.start
+	if start == nil {
+		start = b.startSession
+	}
+	if err := start(); err != nil {
+		source.Stop()
+		b.session.Stop()
+		closeSink()
+		return err
+	}
+
+	err = b.wait(ctx, source)
+	b.session.Stop()
+	select {
+	case <-b.session.Done():
+	case <-time.After(5 * time.Second):
+	}
+	if cerr := closeSink(); cerr != nil {
+		fmt.Printf("[Batch] Failed to finalize translated audio: %v\n", cerr)
+	}
+	fmt.Printf("[Batch] Saved %.2f seconds of translated audio to %s\n", sink.Seconds(), partPath)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state.Complete = true
+	if err := b.saveState(); err != nil {
+		return err
+	}
+	fmt.Printf("[Batch] Finished: %d turns translated\n", b.state.Turns)
+	return nil
+}
+
+// startSession connects the session and starts uploading the file
+func (b *BatchTranslator) startSession() error {
+	if err := b.session.Conn(); err != nil {
+		return err
+	}
+	return b.session.Start("")
+}
+
+// prepare loads the checkpoint, opens the transcript and registers the event handlers
+func (b *BatchTranslator) prepare() error {
+	input, err := filepath.Abs(b.input)
+	if err != nil {
+		return fmt.Errorf("failed to resolve input path: %w", err)
+	}
+
+	data, err := os.ReadFile(b.StatePath())
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		b.state = batchState{Input: input}
+	case err != nil:
+		return fmt.Errorf("failed to read batch state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &b.state); err != nil {
+			return fmt.Errorf("invalid batch state: %w", err)
+		}
+		if b.state.Input != input {
+			return fmt.Errorf("batch state belongs to another input: %s", b.state.Input)
+		}
+	}
+	b.baseMs = b.state.PositionMs
+
+	b.transcript, err = openTranscript(b.TranscriptPath(), b.state.Turns)
+	if err != nil {
+		return err
+	}
+
+	if b.session.transcriptionModel == "" {
+		b.session.SetInputTranscription(defaultTranscriptionModel)
+	}
+	b.lastEvent = time.Now()
+	b.session.OnEvent("", b.handleEvent)
+	return nil
+}
+
+// openTranscript opens the transcript for appending after its first turns
+// lines, dropping lines written after the last saved checkpoint
+func openTranscript(path string, turns int) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript: %w", err)
+	}
+	var offset int64
+	reader := bufio.NewReader(file)
+	for i := 0; i < turns; i++ {
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+		if err != nil {
+			break
+		}
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate transcript: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek transcript: %w", err)
+	}
+	return file, nil
+}
+
+// hold pauses the upload while too many turns await translation
+func (b *BatchTranslator) hold() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pending := 0
+	for _, turn := range b.turns {
+		if !turn.translated() {
+			pending++
+		}
+	}
+	return pending >= b.options.MaxPendingTurns
+}
+
+// wait returns when the whole file is uploaded and translated
+func (b *BatchTranslator) wait(ctx context.Context, source *FileSource) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := source.Err(); err != nil {
+			return err
+		}
+
+		uploaded := false
+		select {
+		case <-source.Done():
+			uploaded = true
+		default:
+		}
+
+		b.mu.Lock()
+		failed := b.failed
+		idle := len(b.turns) == 0 && !b.speaking
+		if !uploaded && idle {
+			// Nothing to wait for while the upload is progressing
+			b.lastEvent = time.Now()
+		}
+		stalled := time.Since(b.lastEvent) > b.options.IdleTimeout
+		b.mu.Unlock()
+
+		switch {
+		case failed != nil:
+			return failed
+		case uploaded && idle:
+			return nil
+		case stalled:
+			return fmt.Errorf("no response from the session for %s", b.options.IdleTimeout)
+		}
+	}
+}
+
+// receive saves the translated audio of the remote track
+func (b *BatchTranslator) receive(track RTPReader, sink PacketSink) {
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			if err == io.EOF || strings.Contains(err.Error(), "closed") {
+				return
+			}
+			continue
+		}
+		if err := sink.WriteRTP(packet); err != nil {
+			fmt.Printf("[Batch] Failed to save audio packet: %v\n", err)
+		}
+	}
+}
+
+// handleEvent tracks the turns of the conversation
+func (b *BatchTranslator) handleEvent(evt ServerEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastEvent = evt.Received
+
+	switch evt.Type {
+	case EventSpeechStarted:
+		b.speaking = true
+		b.speechMs = int64(evt.AudioStartMs)
+	case EventSpeechStopped:
+		b.speaking = false
+		b.turns = append(b.turns, &batchTurn{
+			BatchTurn: BatchTurn{StartMs: b.baseMs + b.speechMs, EndMs: b.baseMs + int64(evt.AudioEndMs)},
+			itemID:    evt.ItemID,
+		})
+	case EventInputTranscriptionDone, EventInputTranscriptionFailed:
+		for _, turn := range b.turns {
+			if turn.itemID == evt.ItemID {
+				turn.Source = strings.TrimSpace(evt.Transcript)
+				turn.sourceDone = true
+			}
+		}
+	case EventConversationItemCreated:
+		previous, id, role := conversationItem(evt)
+		if b.items == nil {
+			b.items = make(map[string]batchItem)
+		}
+		b.items[id] = batchItem{previous: previous, user: role == "user"}
+	case EventResponseOutputItemAdded:
+		_, id, _ := conversationItem(evt)
+		if r := b.response(evt.ResponseID); r.output == "" {
+			r.output = id
+		}
+	case EventResponseAudioTranscriptEnd:
+		b.response(evt.ResponseID).transcript = strings.TrimSpace(evt.Transcript)
+	case EventResponseDone:
+		id, status, calls := responseOutcome(evt)
+		if status == "failed" {
+			// Leave the turn unwritten so the next run translates it again
+			if b.failed == nil {
+				b.failed = fmt.Errorf("response %s ended with status %s", id, status)
+			}
+			return
+		}
+		// Cancelled and incomplete turns are written untranslated
+		r := b.response(id)
+		r.status, r.calls = status, calls && status == "completed"
+	default:
+		return
+	}
+
+	b.link()
+	if err := b.flush(); err != nil && b.failed == nil {
+		b.failed = err
+	}
+}
+
+// response returns the response with the given ID; the caller holds b.mu
+func (b *BatchTranslator) response(id string) *batchResponse {
+	if b.responses == nil {
+		b.responses = make(map[string]*batchResponse)
+	}
+	r, ok := b.responses[id]
+	if !ok {
+		r = &batchResponse{id: id}
+		b.responses[id] = r
+	}
+	return r
+}
+
+// link assigns the responses to the turns they answer, as soon as their
+// output is placed in the conversation; the caller holds b.mu
+func (b *BatchTranslator) link() {
+	for _, r := range b.responses {
+		if r.turn != nil || r.output == "" {
+			continue
+		}
+		if turn := b.turnBefore(r.output); turn != nil {
+			r.turn = turn
+			turn.responses = append(turn.responses, r)
+		}
+	}
+}
+
+// turnBefore returns the turn whose input precedes itemID in the
+// conversation, passing over the output and tool calls of earlier responses.
+// Other user input, such as typed text, has no turn.
+func (b *BatchTranslator) turnBefore(itemID string) *batchTurn {
+	item, ok := b.items[itemID]
+	for ok && item.previous != "" {
+		for _, turn := range b.turns {
+			if turn.itemID == item.previous {
+				return turn
+			}
+		}
+		item, ok = b.items[item.previous]
+		if item.user {
+			return nil
+		}
+	}
+	return nil
+}
+
+// conversationItem returns the previous item ID and the ID and role of the
+// item of a conversation.item.created or response.output_item.added event
+func conversationItem(evt ServerEvent) (previous, id, role string) {
+	var msg struct {
+		PreviousItemID string `json:"previous_item_id"`
+		Item           struct {
+			ID   string `json:"id"`
+			Role string `json:"role"`
+		} `json:"item"`
+	}
+	json.Unmarshal(evt.Raw, &msg)
+	return msg.PreviousItemID, msg.Item.ID, msg.Item.Role
+}
+
+// responseOutcome returns the ID and status of a response.done event and
+// whether the response called tools
+func responseOutcome(evt ServerEvent) (string, string, bool) {
+	var msg struct {
+		Response struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+			Output []struct {
+				Type string `json:"type"`
+			} `json:"output"`
+		} `json:"response"`
+	}
+	json.Unmarshal(evt.Raw, &msg)
+	calls := false
+	for _, item := range msg.Response.Output {
+		calls = calls || item.Type == "function_call"
+	}
+	return msg.Response.ID, msg.Response.Status, calls
+}
+
+// responseStatus returns the ID and status of a response event
+func responseStatus(evt ServerEvent) (string, string) {
+	var msg struct {
+		Response struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"response"`
+	}
+	json.Unmarshal(evt.Raw, &msg)
+	return msg.Response.ID, msg.Response.Status
+}
+
+// flush writes the completed turns at the front of the queue and saves the
+// checkpoint after each; the caller holds b.mu
+func (b *BatchTranslator) flush() error {
+	for len(b.turns) > 0 && b.turns[0].translated() && b.turns[0].sourceDone {
+		turn := b.turns[0]
+		turn.Index = b.state.Turns + 1
+		last := turn.responses[len(turn.responses)-1]
+		for _, r := range turn.responses {
+			if r.transcript != "" && last.status == "completed" {
+				turn.Translation = r.transcript
+			}
+			delete(b.responses, r.id)
+		}
+		if last.status != "completed" {
+			turn.Status = last.status // Untranslated, even if part of it was spoken
+		}
+		line, err := json.Marshal(turn.BatchTurn)
+		if err != nil {
+			return fmt.Errorf("failed to encode turn: %w", err)
+		}
+		if _, err := b.transcript.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write transcript: %w", err)
+		}
+		if err := b.transcript.Sync(); err != nil {
+			return fmt.Errorf("failed to write transcript: %w", err)
+		}
+
+		b.state.Turns++
+		b.state.PositionMs = turn.EndMs
+		if err := b.saveState(); err != nil {
+			return err
+		}
+		b.turns = b.turns[1:]
+		fmt.Printf("[Batch] Turn %d (%s): %s\n", turn.Index,
+			time.Duration(turn.StartMs)*time.Millisecond, turn.Translation)
+	}
+	return nil
+}
+
+// saveState atomically replaces the checkpoint file; the caller holds b.mu
+func (b *BatchTranslator) saveState() error {
+	data, err := json.MarshalIndent(b.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch state: %w", err)
+	}
+	tmp := b.StatePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save batch state: %w", err)
+	}
+	if err := os.Rename(tmp, b.StatePath()); err != nil {
+		return fmt.Errorf("failed to save batch state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package voxaudio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"voxworld/wavfile"
+)
+
+func readTranscript(t *testing.T, path string) []BatchTurn {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var turns []BatchTurn
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var turn BatchTurn
+		require.NoError(t, json.Unmarshal([]byte(line), &turn))
+		turns = append(turns, turn)
+	}
+	return turns
+}
+
+func readBatchState(t *testing.T, path string) batchState {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var state batchState
+	require.NoError(t, json.Unmarshal(data, &state))
+	return state
+}
+
+// respond places the first output item of a response after previous
+func respond(send func(string, ...interface{}), responseID, outputID, previous, itemType string) {
+	send(`{"type":"response.output_item.added","response_id":"%s","item":{"id":"%s","type":"%s"}}`, responseID, outputID, itemType)
+	send(`{"type":"conversation.item.created","previous_item_id":"%s","item":{"id":"%s","type":"%s","role":"assistant"}}`, previous, outputID, itemType)
+}
+
+func TestBatchTranslatorCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "lecture.wav")
+	base := filepath.Join(dir, "lecture.en")
+
+	s := &Session{}
+	b := NewBatchTranslator(s, input, base, BatchOptions{MaxPendingTurns: 2})
+	require.NoError(t, b.prepare())
+	defer b.transcript.Close()
+	assert.Equal(t, defaultTranscriptionModel, s.transcriptionModel)
+
+	send := func(format string, args ...interface{}) {
+		require.NoError(t, s.dispatchEvent([]byte(fmt.Sprintf(format, args...)), time.Now()))
+	}
+
+	send(`{"type":"input_audio_buffer.speech_started","item_id":"a","audio_start_ms":500}`)
+	send(`{"type":"input_audio_buffer.speech_stopped","item_id":"a","audio_end_ms":2500}`)
+	send(`{"type":"response.created","response":{"id":"r1","status":"in_progress"}}`)
+	respond(send, "r1", "out1", "a", "message")
+
+	// A response to typed text answers no turn
+	send(`{"type":"conversation.item.created","previous_item_id":"out1","item":{"id":"typed","type":"message","role":"user"}}`)
+	respond(send, "r2", "out2", "typed", "message")
+	send(`{"type":"response.audio_transcript.done","response_id":"r2","transcript":"Typed"}`)
+	send(`{"type":"response.done","response":{"id":"r2","status":"completed"}}`)
+
+	// The response can be placed before the speech_stopped of its turn is handled
+	send(`{"type":"input_audio_buffer.speech_started","item_id":"b","audio_start_ms":3000}`)
+	respond(send, "r3", "call", "b", "function_call")
+	send(`{"type":"input_audio_buffer.speech_stopped","item_id":"b","audio_end_ms":4000}`)
+	assert.True(t, b.hold(), "two turns await translation")
+
+	send(`{"type":"response.audio_transcript.done","response_id":"r1","transcript":"Good morning"}`)
+	send(`{"type":"response.done","response":{"id":"r1","status":"completed"}}`)
+	assert.False(t, b.hold())
+
+	// The turn is written once its source transcript arrives
+	_, err := os.Stat(b.StatePath())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	send(`{"type":"conversation.item.input_audio_transcription.completed","item_id":"a","transcript":"Buenos días "}`)
+
+	assert.Equal(t, []BatchTurn{{Index: 1, StartMs: 500, EndMs: 2500, Source: "Buenos días", Translation: "Good morning"}},
+		readTranscript(t, b.TranscriptPath()))
+	state := readBatchState(t, b.StatePath())
+	assert.Equal(t, int64(2500), state.PositionMs)
+	assert.Equal(t, 1, state.Turns)
+	assert.False(t, state.Complete)
+
+	// A turn that called a tool is translated by the continuation
+	send(`{"type":"conversation.item.input_audio_transcription.completed","item_id":"b","transcript":"Adiós"}`)
+	send(`{"type":"response.done","response":{"id":"r3","status":"completed","output":[{"id":"call","type":"function_call"}]}}`)
+	assert.Len(t, readTranscript(t, b.TranscriptPath()), 1)
+	send(`{"type":"conversation.item.created","previous_item_id":"call","item":{"id":"call_output","type":"function_call_output"}}`)
+	respond(send, "r4", "out4", "call_output", "message")
+	send(`{"type":"response.audio_transcript.done","response_id":"r4","transcript":"Goodbye"}`)
+	send(`{"type":"response.done","response":{"id":"r4","status":"completed"}}`)
+	turns := readTranscript(t, b.TranscriptPath())
+	require.Len(t, turns, 2)
+	assert.Equal(t, BatchTurn{Index: 2, StartMs: 3000, EndMs: 4000, Source: "Adiós", Translation: "Goodbye"}, turns[1])
+
+	// A failed response stops the run without checkpointing the turn
+	send(`{"type":"input_audio_buffer.speech_started","item_id":"c","audio_start_ms":5000}`)
+	send(`{"type":"input_audio_buffer.speech_stopped","item_id":"c","audio_end_ms":6000}`)
+	send(`{"type":"conversation.item.input_audio_transcription.completed","item_id":"c","transcript":"Hola"}`)
+	respond(send, "r5", "out5", "c", "message")
+	send(`{"type":"response.done","response":{"id":"r5","status":"failed"}}`)
+	assert.ErrorContains(t, b.failed, "failed")
+	assert.Equal(t, 2, readBatchState(t, b.StatePath()).Turns)
+}
+
+func TestBatchTranslatorResume(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "lecture.wav")
+	base := filepath.Join(dir, "lecture.en")
+	abs, err := filepath.Abs(input)
+	require.NoError(t, err)
+
+	// The previous run wrote a second turn but died before saving the checkpoint
+	state, err := json.Marshal(batchState{Input: abs, PositionMs: 2500, Turns: 1, Parts: []string{"lecture.en.part001.opus"}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(base+".state.json", state, 0644))
+	require.NoError(t, os.WriteFile(base+".transcript.jsonl",
+		[]byte(`{"index":1,"start_ms":500,"end_ms":2500,"translation":"Good morning"}`+"\n"+
+			`{"index":2,"start_ms":3000,"end_ms":4000,"translation":"Goodbye"}`+"\n"), 0644))
+
+	s := &Session{}
+	b := NewBatchTranslator(s, input, base, BatchOptions{})
+	require.NoError(t, b.prepare())
+	defer b.transcript.Close()
+	assert.Len(t, readTranscript(t, b.TranscriptPath()), 1)
+
+	// Positions continue from the checkpoint
+	send := func(format string, args ...interface{}) {
+		require.NoError(t, s.dispatchEvent([]byte(fmt.Sprintf(format, args...)), time.Now()))
+	}
+	send(`{"type":"input_audio_buffer.speech_started","item_id":"b","audio_start_ms":500}`)
+	send(`{"type":"input_audio_buffer.speech_stopped","item_id":"b","audio_end_ms":1500}`)
+	send(`{"type":"conversation.item.input_audio_transcription.failed","item_id":"b"}`)
+	respond(send, "r9", "out9", "b", "message")
+	send(`{"type":"response.audio_transcript.done","response_id":"r9","transcript":"Goodbye"}`)
+	send(`{"type":"response.done","response":{"id":"r9","status":"completed"}}`)
+
+	turns := readTranscript(t, b.TranscriptPath())
+	require.Len(t, turns, 2)
+	assert.Equal(t, BatchTurn{Index: 2, StartMs: 3000, EndMs: 4000, Translation: "Goodbye"}, turns[1])
+	assert.Equal(t, int64(4000), readBatchState(t, b.StatePath()).PositionMs)
+
+	// A state file for a different input is rejected
+	other := NewBatchTranslator(&Session{}, filepath.Join(dir, "other.wav"), base, BatchOptions{})
+	assert.ErrorContains(t, other.prepare(), "another input")
+}
+
+func TestBatchTranslatorRun(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "lecture.wav")
+	base := filepath.Join(dir, "lecture.en")
+	w, err := wavfile.Create(input, wavfile.Format{SampleRate: 16000, Channels: 1, SampleFormat: wavfile.PCM16})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteFloat32(make([]float32, 3*16000)))
+	require.NoError(t, w.Close())
+
+	// run translates the file with a session that receives events instead of
+	// connecting, and returns the number of samples uploaded
+	run := func(events ...string) (int, error) {
+		pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+		require.NoError(t, err)
+		s := &Session{pc: pc}
+		b := NewBatchTranslator(s, input, base, BatchOptions{Speed: 100, TailSilence: time.Millisecond, IdleTimeout: time.Second})
+		delivered := make(chan int, 1)
+		started := false
+		b.start = func() error {
+			started = true
+			for _, evt := range events {
+				if err := s.dispatchEvent([]byte(evt), time.Now()); err != nil {
+					return err
+				}
+			}
+			if err := s.recorder.Start(""); err != nil {
+				return err
+			}
+			go func() {
+				samples := 0
+				for chunk := range s.recorder.Audio() {
+					samples += len(chunk)
+				}
+				delivered <- samples
+			}()
+			return nil
+		}
+		err = b.Run(context.Background())
+		if !started {
+			return 0, err // Already translated, nothing uploaded
+		}
+		return <-delivered, err
+	}
+	turn := func(item string, startMs, endMs int, source string) []string {
+		return []string{
+			fmt.Sprintf(`{"type":"input_audio_buffer.speech_started","item_id":"%s","audio_start_ms":%d}`, item, startMs),
+			fmt.Sprintf(`{"type":"input_audio_buffer.speech_stopped","item_id":"%s","audio_end_ms":%d}`, item, endMs),
+			fmt.Sprintf(`{"type":"conversation.item.input_audio_transcription.completed","item_id":"%s","transcript":"%s"}`, item, source),
+		}
+	}
+	response := func(id, previous, transcript, status string) []string {
+		return []string{
+			fmt.Sprintf(`{"type":"response.output_item.added","response_id":"%s","item":{"id":"out_%s","type":"message"}}`, id, id),
+			fmt.Sprintf(`{"type":"conversation.item.created","previous_item_id":"%s","item":{"id":"out_%s","type":"message","role":"assistant"}}`, previous, id),
+			fmt.Sprintf(`{"type":"response.audio_transcript.done","response_id":"%s","transcript":"%s"}`, id, transcript),
+			fmt.Sprintf(`{"type":"response.done","response":{"id":"%s","status":"%s"}}`, id, status),
+		}
+	}
+
+	// The first run fails on the second turn after uploading the whole file
+	var events []string
+	events = append(events, turn("a", 500, 1500, "Buenos días")...)
+	events = append(events, response("r1", "a", "Good morning", "completed")...)
+	events = append(events, turn("b", 2000, 2500, "Adiós")...)
+	events = append(events, response("r2", "b", "", "failed")...)
+	samples, err := run(events...)
+	assert.ErrorContains(t, err, "failed")
+	assert.GreaterOrEqual(t, samples, 3*16000)
+	state := readBatchState(t, base+".state.json")
+	assert.Equal(t, batchState{Input: state.Input, PositionMs: 1500, Turns: 1, Parts: []string{"lecture.en.part001.opus"}}, state)
+
+	// The next run uploads the rest; a cancelled response leaves its turn
+	// untranslated without failing the run
+	events = append(turn("b", 500, 1000, "Adiós"), response("r3", "b", "Good", "cancelled")...)
+	events = append(events, turn("c", 1100, 1400, "Hasta luego")...)
+	events = append(events, response("r4", "c", "See you", "completed")...)
+	samples, err = run(events...)
+	require.NoError(t, err)
+	assert.InDelta(t, 24000, samples, 1000, "resumed at 1.5s")
+	assert.Equal(t, []BatchTurn{
+		{Index: 1, StartMs: 500, EndMs: 1500, Source: "Buenos días", Translation: "Good morning"},
+		{Index: 2, StartMs: 2000, EndMs: 2500, Source: "Adiós", Status: "cancelled"},
+		{Index: 3, StartMs: 2600, EndMs: 2900, Source: "Hasta luego", Translation: "See you"},
+	}, readTranscript(t, base+".transcript.jsonl"))
+	state = readBatchState(t, base+".state.json")
+	assert.True(t, state.Complete)
+	assert.Equal(t, []string{"lecture.en.part001.opus", "lecture.en.part002.opus"}, state.Parts)
+	assert.FileExists(t, base+".part002.opus")
+
+	// A complete translation is not run again
+	samples, err = run()
+	require.NoError(t, err)
+	assert.Zero(t, samples)
+	assert.Len(t, readBatchState(t, base+".state.json").Parts, 2)
+}
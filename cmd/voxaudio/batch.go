@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	voxaudio "voxworld"
+)
+
+func runBatchTranslate(ctx context.Context, args []string) error {
+	var cfg config
+	fs := newFlagSet("batch-translate")
+	cfg.register(fs, "api-key", "model", "lang", "voice")
+	output := fs.String("o", "", "Base path of the output files (default: input name plus target language)")
+	speed := fs.Float64("speed", 4, "Upload speed relative to real time")
+	maxPending := fs.Int("max-pending", 2, "Pause the upload while this many turns await translation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one input file")
+	}
+	if err := cfg.resolve(); err != nil {
+		return err
+	}
+	if err := cfg.requireAPIKey(); err != nil {
+		return err
+	}
+
+	input := fs.Arg(0)
+	base := *output
+	if base == "" {
+		base = strings.TrimSuffix(input, filepath.Ext(input)) + "." + strings.ToLower(cfg.targetLang)
+	}
+
+	session, err := voxaudio.NewSession("", cfg.model, cfg.targetLang, cfg.voice)
+	if err != nil {
+		return err
+	}
+	defer session.Stop()
+	session.SetKeyProvider(cfg.keyProvider())
+	batch := voxaudio.NewBatchTranslator(session, input, base, voxaudio.BatchOptions{
+		Speed:           *speed,
+		MaxPendingTurns: *maxPending,
+	})
+	if err := batch.Run(ctx); err != nil {
+		return fmt.Errorf("%w (run again to resume)", err)
+	}
+	fmt.Printf("Transcript saved to %s\n", batch.TranscriptPath())
+	return nil
+}
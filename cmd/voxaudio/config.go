@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+
+	voxaudio "voxworld"
+)
+
+const defaultModel = "gpt-4o-mini-realtime-preview"
+
+// config holds the settings shared by the commands. Values missing from the
+// flags are taken from the environment, which includes the .env file.
+type config struct {
+	envFile    string
+	apiKey     string
+	model      string
+	device     string
+	targetLang string
+	voice      string
+}
+
+// setting binds a config field to its flag and environment variable
+type setting struct {
+	value    *string
+	flag     string
+	env      string
+	fallback string
+	usage    string
+}
+
+func (c *config) settings() []setting {
+	return []setting{
+		{&c.apiKey, "api-key", "OPENAI_API_KEY", "", "OpenAI API key"},
+		{&c.model, "model", "OPENAI_MODEL", defaultModel, "Realtime model"},
+		{&c.device, "device", "VOXAUDIO_DEVICE", "", "Input device name, partial names match"},
+		{&c.targetLang, "lang", "VOXAUDIO_TARGET_LANG", "English", "Target language"},
+		{&c.voice, "voice", "VOXAUDIO_VOICE", "alloy", "Voice of the translation"},
+	}
+}
+
+// register adds the flags of the given settings, plus -env, to fs
+func (c *config) register(fs *flag.FlagSet, names ...string) {
+	fs.StringVar(&c.envFile, "env", "", "Load environment variables from this file instead of .env")
+	for _, s := range c.settings() {
+		for _, name := range names {
+			if s.flag == name {
+				usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+				if s.fallback != "" {
+					usage += fmt.Sprintf(" (default %q)", s.fallback)
+				}
+				fs.StringVar(s.value, s.flag, "", usage)
+			}
+		}
+	}
+}
+
+// resolve loads the .env file and fills the settings not given as flags
+func (c *config) resolve() error {
+	if c.envFile != "" {
+		if err := godotenv.Load(c.envFile); err != nil {
+			return fmt.Errorf("failed to load %s: %w", c.envFile, err)
+		}
+	} else if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to load .env: %w", err)
+	}
+
+	for _, s := range c.settings() {
+		if *s.value == "" {
+			*s.value = strings.TrimSpace(os.Getenv(s.env))
+		}
+		if *s.value == "" {
+			*s.value = s.fallback
+		}
+	}
+	return nil
+}
+
+// requireAPIKey reports a missing API key
+func (c *config) requireAPIKey() error {
+	if c.apiKey == "" {
+		return fmt.Errorf("an API key is required, set OPENAI_API_KEY or use -api-key")
+	}
+	return nil
+}
+
+// keyProvider mints ephemeral keys with the API key, so the API key itself
+// is never sent to the realtime endpoint
+func (c *config) keyProvider() voxaudio.KeyProvider {
+	return voxaudio.NewEphemeralKeyProvider(c.apiKey, voxaudio.EphemeralKeyOptions{Model: c.model, Voice: c.voice})
+}
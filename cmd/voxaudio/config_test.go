@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "test.env")
+	require.NoError(t, os.WriteFile(envFile, []byte(
+		"OPENAI_API_KEY=from-file\nOPENAI_MODEL=model-from-file\nVOXAUDIO_VOICE=echo\n"), 0644))
+	for _, key := range []string{"OPENAI_API_KEY", "OPENAI_MODEL", "VOXAUDIO_DEVICE", "VOXAUDIO_TARGET_LANG", "VOXAUDIO_VOICE"} {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("OPENAI_MODEL", "model-from-env")
+
+	var cfg config
+	fs := newFlagSet("translate")
+	cfg.register(fs, "api-key", "model", "device", "lang", "voice")
+	require.NoError(t, fs.Parse([]string{"-env", envFile, "-lang", "Japanese"}))
+	require.NoError(t, cfg.resolve())
+
+	assert.Equal(t, "from-file", cfg.apiKey)     // .env file
+	assert.Equal(t, "model-from-env", cfg.model) // Environment wins over the file
+	assert.Equal(t, "Japanese", cfg.targetLang)  // Flag
+	assert.Equal(t, "echo", cfg.voice)           // .env file
+	assert.Equal(t, "", cfg.device)              // No default
+	assert.NoError(t, cfg.requireAPIKey())
+}
+
+func TestConfigDefaults(t *testing.T) {
+	// No .env in the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+	for _, key := range []string{"OPENAI_API_KEY", "OPENAI_MODEL", "VOXAUDIO_TARGET_LANG", "VOXAUDIO_VOICE"} {
+		t.Setenv(key, "")
+	}
+
+	var cfg config
+	fs := newFlagSet("batch-translate")
+	cfg.register(fs, "api-key", "model", "lang", "voice")
+	assert.Nil(t, fs.Lookup("device"))
+	require.NoError(t, fs.Parse(nil))
+	require.NoError(t, cfg.resolve())
+
+	assert.Equal(t, defaultModel, cfg.model)
+	assert.Equal(t, "English", cfg.targetLang)
+	assert.Equal(t, "alloy", cfg.voice)
+	assert.Error(t, cfg.requireAPIKey())
+
+	cfg.envFile = "missing.env"
+	assert.Error(t, cfg.resolve())
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	voxaudio "voxworld"
+)
+
+func runDevices(ctx context.Context, args []string) error {
+	fs := newFlagSet("devices")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rec, err := voxaudio.NewLoopbackRecorder()
+	if err != nil {
+		return err
+	}
+	defer rec.Stop()
+
+	devices, err := rec.Devices()
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+	api := ""
+	for i, dev := range devices {
+		if i == 0 || dev.HostAPI != api {
+			api = dev.HostAPI
+			fmt.Printf("API: %s\n", api)
+		}
+		fmt.Printf("  [%d] %s (in:%d out:%d, rate:%.0f)\n",
+			dev.Index, dev.Name, dev.MaxInputChannels, dev.MaxOutputChannels, dev.DefaultSampleRate)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Command voxaudio captures, translates, records and replays audio with the
+// OpenAI Realtime API.
+//
+// Usage:
+//
+//	voxaudio <command> [flags] [args]
+//
+// Configuration is read from flags, then environment variables, then a .env
+// file in the working directory (or the file given with -env).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// command is a voxaudio subcommand
+type command struct {
+	name    string
+	usage   string // Arguments after the flags
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+// commands is filled in init because the commands refer back to it for usage
+var commands []command
+
+func init() {
+	commands = []command{
+		{"devices", "", "List audio devices", runDevices},
+		{"translate", "", "Translate live input and play the translation", runTranslate},
+		{"record", "<output.wav|output.opus>", "Record an input device to a file", runRecord},
+		{"batch-translate", "<input.wav>", "Translate a WAV file faster than real time", runBatchTranslate},
+		{"replay", "<recording.wav|recording.opus|capture.pcap>", "Play a recording", runReplay},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := cmd.run(ctx, os.Args[2:])
+		stop()
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "voxaudio %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "voxaudio: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: voxaudio <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'voxaudio <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates the flag set of a command with a usage line
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				line := strings.TrimSpace(fmt.Sprintf("voxaudio %s [flags] %s", name, cmd.usage))
+				fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s\n\nFlags:\n", line, cmd.summary)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
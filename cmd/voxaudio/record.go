@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	voxaudio "voxworld"
+	"voxworld/wavfile"
+)
+
+// audioWriter is the part of the WAV and Ogg Opus writers used by record
+type audioWriter interface {
+	WriteFloat32(samples []float32) error
+	Close() error
+}
+
+func runRecord(ctx context.Context, args []string) error {
+	var cfg config
+	fs := newFlagSet("record")
+	cfg.register(fs, "device")
+	var sig signalFlags
+	sig.register(fs)
+	duration := fs.Duration("duration", 0, "Stop after this long, 0 runs until interrupted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one output file")
+	}
+	if err := cfg.resolve(); err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+
+	var rec voxaudio.AudioSource
+	source, err := sig.source()
+	if err != nil {
+		return err
+	}
+	if source != nil {
+		rec = source
+		cfg.device = "signal " + sig.spec
+	} else {
+		if cfg.device == "" {
+			return fmt.Errorf("an input device is required, set VOXAUDIO_DEVICE or use -device")
+		}
+		if rec, err = voxaudio.NewLoopbackRecorder(); err != nil {
+			return err
+		}
+	}
+	if err := rec.Start(cfg.device); err != nil {
+		rec.Stop()
+		return err
+	}
+	defer rec.Stop()
+	rate, channels := rec.Format()
+	if rate <= 0 || channels <= 0 {
+		return fmt.Errorf("invalid recording format: %d Hz, %d channels", rate, channels)
+	}
+
+	var out audioWriter
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		out, err = wavfile.Create(path, wavfile.Format{SampleRate: rate, Channels: channels, SampleFormat: wavfile.PCM16})
+	case ".opus", ".ogg":
+		out, err = voxaudio.NewOggOpusEncoder(path, rate, channels)
+	default:
+		err = fmt.Errorf("unsupported output format %q, use .wav or .opus", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	fmt.Printf("Recording %s to %s, press Ctrl+C to stop\n", cfg.device, path)
+
+	var frames int64
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			done = true
+		case samples, ok := <-rec.Audio():
+			if !ok {
+				done = true
+				break
+			}
+			if err := out.WriteFloat32(samples); err != nil {
+				out.Close()
+				return fmt.Errorf("failed to write recording: %w", err)
+			}
+			frames += int64(len(samples) / channels)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to finalize recording: %w", err)
+	}
+	fmt.Printf("Saved %.2f seconds of audio to %s\n", float64(frames)/float64(rate), path)
+	return nil
+}
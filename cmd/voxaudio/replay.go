@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+	"github.com/hraban/opus"
+
+	voxaudio "voxworld"
+	"voxworld/oggopus"
+	"voxworld/wavfile"
+)
+
+// sampleSource fills dst with interleaved samples and returns the count,
+// or io.EOF at the end
+type sampleSource func(dst []float32) (int, error)
+
+// pcmReader adapts a sampleSource to the float32 byte stream played by oto
+type pcmReader struct {
+	read    sampleSource
+	samples []float32
+}
+
+func (r *pcmReader) Read(p []byte) (int, error) {
+	want := len(p) / 4
+	if want == 0 {
+		return 0, nil
+	}
+	if cap(r.samples) < want {
+		r.samples = make([]float32, want)
+	}
+	n, err := r.read(r.samples[:want])
+	for i, v := range r.samples[:n] {
+		binary.LittleEndian.PutUint32(p[i*4:], math.Float32bits(v))
+	}
+	if n > 0 {
+		return n * 4, nil
+	}
+	return 0, err
+}
+
+func runReplay(ctx context.Context, args []string) error {
+	fs := newFlagSet("replay")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one recording")
+	}
+	path := fs.Arg(0)
+
+	var (
+		rate, channels int
+		read           sampleSource
+		duration       time.Duration
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		r, err := wavfile.Open(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		rate, channels, read, duration = r.Format().SampleRate, r.Format().Channels, r.ReadFloat32, r.Duration()
+	case ".opus", ".ogg":
+		r, err := oggopus.Open(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		rate, channels = 48000, r.Header().Channels
+		read, err = opusSource(r)
+		if err != nil {
+			return err
+		}
+	case ".rtp", ".rtpdump", ".pcap", ".cap":
+		r, err := voxaudio.OpenRTPReplay(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		rate, channels = 48000, 1
+		read, err = rtpSource(r)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported recording format %q, use .wav, .opus or an RTP capture", filepath.Ext(path))
+	}
+	if channels > 2 {
+		return fmt.Errorf("unsupported channel count: %d", channels)
+	}
+
+	otoCtx, ready, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:   rate,
+		ChannelCount: channels,
+		Format:       oto.FormatFloat32LE,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open audio output: %w", err)
+	}
+	<-ready
+
+	player := otoCtx.NewPlayer(&pcmReader{read: read})
+	defer player.Close()
+	if duration > 0 {
+		fmt.Printf("Playing %s (%.1f seconds), press Ctrl+C to stop\n", path, duration.Seconds())
+	} else {
+		fmt.Printf("Playing %s, press Ctrl+C to stop\n", path)
+	}
+	player.Play()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for player.IsPlaying() {
+		select {
+		case <-ctx.Done():
+			player.Pause()
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return player.Err()
+}
+
+// opusSource decodes the packets of r, dropping the pre-skip samples
+func opusSource(r *oggopus.Reader) (sampleSource, error) {
+	channels := r.Header().Channels
+	decoder, err := opus.NewDecoder(48000, channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus decoder: %w", err)
+	}
+	skip := r.Header().PreSkip * channels
+	frame := make([]float32, 5760*channels) // Longest Opus packet, 120ms
+	var pending []float32
+
+	return func(dst []float32) (int, error) {
+		for len(pending) == 0 {
+			packet, err := r.ReadPacket()
+			if err != nil {
+				return 0, err
+			}
+			n, err := decoder.DecodeFloat32(packet, frame)
+			if err != nil {
+				return 0, fmt.Errorf("failed to decode audio: %w", err)
+			}
+			pending = frame[:n*channels]
+			if skip > 0 {
+				drop := min(skip, len(pending))
+				pending = pending[drop:]
+				skip -= drop
+			}
+		}
+		n := copy(dst, pending)
+		pending = pending[n:]
+		return n, nil
+	}, nil
+}
+
+// rtpSource decodes the Opus payloads of a mono RTP capture
+func rtpSource(r voxaudio.RTPReader) (sampleSource, error) {
+	decoder, err := opus.NewDecoder(48000, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus decoder: %w", err)
+	}
+	frame := make([]float32, 5760)
+	var pending []float32
+
+	return func(dst []float32) (int, error) {
+		for len(pending) == 0 {
+			packet, _, err := r.ReadRTP()
+			if err != nil {
+				return 0, err
+			}
+			if len(packet.Payload) == 0 {
+				continue
+			}
+			n, err := decoder.DecodeFloat32(packet.Payload, frame)
+			if err != nil {
+				return 0, fmt.Errorf("failed to decode audio: %w", err)
+			}
+			pending = frame[:n]
+		}
+		n := copy(dst, pending)
+		pending = pending[n:]
+		return n, nil
+	}, nil
+}
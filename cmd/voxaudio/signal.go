@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	voxaudio "voxworld"
+)
+
+// signalAmplitude keeps generated signals at -6 dBFS
+const signalAmplitude = 0.5
+
+// signalFlags selects a generated test signal in place of an input device
+type signalFlags struct {
+	spec     string
+	rate     int
+	channels int
+}
+
+func (f *signalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.spec, "signal", "", "Use a test signal instead of a device: tone[:hz], sweep[:from-to], dtmf[:keys], white, pink, silence or clicks[:interval]")
+	fs.IntVar(&f.rate, "signal-rate", 48000, "Sample rate of the test signal")
+	fs.IntVar(&f.channels, "signal-channels", 1, "Channel count of the test signal")
+}
+
+// source returns the test signal source, or nil if no signal was requested
+func (f *signalFlags) source() (*voxaudio.SignalSource, error) {
+	if f.spec == "" {
+		return nil, nil
+	}
+	signal, err := parseSignal(f.spec)
+	if err != nil {
+		return nil, err
+	}
+	return voxaudio.NewSignalSource(signal, f.rate, f.channels)
+}
+
+// parseSignal parses a signal name with an optional parameter after a colon
+func parseSignal(spec string) (voxaudio.Signal, error) {
+	name, param, _ := strings.Cut(strings.ToLower(spec), ":")
+	switch name {
+	case "tone", "sine":
+		freq := 1000.0
+		if param != "" {
+			var err error
+			if freq, err = strconv.ParseFloat(param, 64); err != nil || freq <= 0 {
+				return nil, fmt.Errorf("invalid tone frequency %q", param)
+			}
+		}
+		return voxaudio.Tone(freq, signalAmplitude), nil
+	case "sweep":
+		from, to := 20.0, 20000.0
+		if param != "" {
+			lo, hi, ok := strings.Cut(param, "-")
+			var err1, err2 error
+			from, err1 = strconv.ParseFloat(lo, 64)
+			to, err2 = strconv.ParseFloat(hi, 64)
+			if !ok || err1 != nil || err2 != nil || from <= 0 || to <= 0 {
+				return nil, fmt.Errorf("invalid sweep range %q, use from-to in Hz", param)
+			}
+		}
+		return voxaudio.Sweep(from, to, 5*time.Second, signalAmplitude), nil
+	case "dtmf":
+		keys := param
+		if keys == "" {
+			keys = "123456789*0#"
+		}
+		return voxaudio.DTMF(keys, 100*time.Millisecond, 100*time.Millisecond, signalAmplitude)
+	case "white":
+		return voxaudio.WhiteNoise(signalAmplitude, uint64(time.Now().UnixNano())), nil
+	case "pink":
+		return voxaudio.PinkNoise(signalAmplitude, uint64(time.Now().UnixNano())), nil
+	case "silence":
+		return voxaudio.Silence(), nil
+	case "clicks":
+		interval := time.Second
+		if param != "" {
+			var err error
+			if interval, err = time.ParseDuration(param); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid click interval %q", param)
+			}
+		}
+		return voxaudio.Clicks(interval, signalAmplitude), nil
+	}
+	return nil, fmt.Errorf("unknown signal %q", spec)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, spec := range []string{"tone", "tone:440", "sweep", "sweep:100-8000", "dtmf", "DTMF:911", "white", "pink", "silence", "clicks:250ms"} {
+		signal, err := parseSignal(spec)
+		assert.NoError(t, err, spec)
+		assert.NotNil(t, signal, spec)
+	}
+	for _, spec := range []string{"", "square", "tone:-5", "sweep:100", "dtmf:12x", "clicks:often"} {
+		_, err := parseSignal(spec)
+		assert.Error(t, err, spec)
+	}
+}
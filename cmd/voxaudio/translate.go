@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	voxaudio "voxworld"
+	"voxworld/wavfile"
+)
+
+func runTranslate(ctx context.Context, args []string) error {
+	var cfg config
+	fs := newFlagSet("translate")
+	cfg.register(fs, "api-key", "model", "device", "lang", "voice")
+	var sig signalFlags
+	sig.register(fs)
+	output := fs.String("output", "speaker", "Where to play the translation: speaker or blackhole")
+	record := fs.String("record", "wav", "Save the translated audio as wav, opus or none")
+	recordInput := fs.Bool("record-input", false, "Also save the captured input as Ogg Opus")
+	subtitles := fs.String("subtitles", "", "Write source and translation subtitles next to this base path")
+	subtitleFormat := fs.String("subtitle-format", "srt", "Subtitle format: srt or vtt")
+	messageLog := fs.String("message-log", "", "Log the data channel traffic to this JSONL file")
+	rtpCapture := fs.String("rtp-capture", "", "Capture the received RTP packets to this rtpdump or .pcap file")
+	duration := fs.Duration("duration", 0, "Stop after this long, 0 runs until interrupted")
+	textOnly := fs.Bool("text-only", false, "Print the translation as text instead of speaking it")
+	typed := fs.Bool("type", false, "Also translate lines typed on standard input")
+	bargeIn := fs.Bool("barge-in", true, "Stop the playing translation when the speaker starts talking again")
+	maxCost := fs.Float64("max-cost", 0, "Stop translating once the estimated cost reaches this many USD, 0 is unlimited")
+	maxTokens := fs.Int("max-tokens", 0, "Stop translating once this many tokens were used, 0 is unlimited")
+	denoise := fs.String("denoise", "", "Suppress background noise in the input: "+strings.Join(voxaudio.NoiseSuppressors(), ", ")+", or empty for none")
+	agc := fs.Float64("agc", 0, "Level the input to this RMS level in dBFS, such as -20, 0 disables")
+	normalize := fs.Float64("normalize", 0, "Normalize the translation to this short-term loudness in LUFS, such as -23, with a -1 dBTP limiter, 0 disables")
+	voiceOver := fs.String("voice-over", "", "Mix the input under the translation into this .wav or .opus file, or device:NAME to play it on an output device")
+	duck := fs.Float64("duck", -18, "Level of the input under the translation in the voice-over mix, in dB")
+	aec := fs.Bool("aec", false, "Remove the translation played on the speaker from the input, for setups without headphones")
+	preRoll := fs.Duration("pre-roll", 5*time.Second, "Send up to this much audio captured before the connection was ready, negative disables")
+	rotate := fs.Duration("rotate", 25*time.Minute, "Switch to a new connection after this long to outlast the session limit, 0 disables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cfg.resolve(); err != nil {
+		return err
+	}
+	if err := cfg.requireAPIKey(); err != nil {
+		return err
+	}
+	source, err := sig.source()
+	if err != nil {
+		return err
+	}
+	if source == nil && cfg.device == "" {
+		return fmt.Errorf("an input device is required, set VOXAUDIO_DEVICE or use -device")
+	}
+	recordFormat, err := parseRecordFormat(*record)
+	if err != nil {
+		return err
+	}
+	subFormat, err := parseSubtitleFormat(*subtitleFormat)
+	if err != nil {
+		return err
+	}
+
+	session, err := voxaudio.NewSession("", cfg.model, cfg.targetLang, cfg.voice)
+	if err != nil {
+		return err
+	}
+	// Release the session if the setup fails, once translating it is stopped below
+	setup := true
+	defer func() {
+		if setup {
+			session.Stop()
+		}
+	}()
+	session.SetKeyProvider(cfg.keyProvider())
+	session.SetRecordFormat(recordFormat)
+	session.SetRecordInput(*recordInput)
+	session.SetRotation(voxaudio.RotationOptions{After: *rotate})
+	session.SetPreRoll(voxaudio.PreRollOptions{Duration: *preRoll})
+	if *agc != 0 {
+		session.SetAGC(voxaudio.NewAutomaticGainControl(voxaudio.AGCOptions{Target: *agc}))
+	}
+	if *normalize != 0 {
+		session.SetLoudnessNormalizer(voxaudio.NewLoudnessNormalizer(voxaudio.NormalizerOptions{Target: *normalize}))
+	}
+	if *denoise != "" {
+		ns, err := voxaudio.NewNoiseSuppressor(*denoise)
+		if err != nil {
+			return err
+		}
+		session.SetNoiseSuppressor(ns)
+	}
+	if *voiceOver != "" {
+		sink, err := openVoiceOverSink(*voiceOver)
+		if err != nil {
+			return err
+		}
+		mixer := voxaudio.NewVoiceOverMixer(sink, voxaudio.VoiceOverOptions{DuckedLevel: *duck})
+		defer func() {
+			if err := mixer.Close(); err != nil {
+				fmt.Printf("Failed to finalize the voice-over mix: %v\n", err)
+			}
+		}()
+		session.SetVoiceOver(mixer)
+	}
+	if *textOnly {
+		session.SetTextOnly(true)
+		session.OnEvent(voxaudio.EventResponseTextDelta, func(evt voxaudio.ServerEvent) {
+			fmt.Print(evt.Delta)
+		})
+		session.OnEvent(voxaudio.EventResponseTextDone, func(evt voxaudio.ServerEvent) {
+			fmt.Println()
+		})
+	}
+	if source != nil {
+		session.SetAudioSource(source)
+		cfg.device = "signal " + sig.spec
+	}
+
+	if *messageLog != "" {
+		log, err := voxaudio.CreateMessageLog(*messageLog)
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+		session.SetMessageLog(log)
+		defer session.SetMessageLog(nil) // Detach before the log is closed
+	}
+
+	if *rtpCapture != "" {
+		capture, err := voxaudio.NewRTPCaptureSink(*rtpCapture)
+		if err != nil {
+			return err
+		}
+		defer capture.Close()
+		session.AddPacketSink(capture)
+	}
+
+	// The session stops itself when the budget is exhausted
+	session.SetBudget(voxaudio.Budget{MaxCost: *maxCost, MaxTokens: *maxTokens, Action: voxaudio.BudgetStop})
+
+	var subs *voxaudio.SubtitleWriter
+	if *subtitles != "" {
+		subs = voxaudio.NewSubtitleWriter(session, voxaudio.SubtitleOptions{})
+	}
+
+	switch strings.ToLower(*output) {
+	case "speaker":
+		if *aec {
+			session.SetEchoCanceller(voxaudio.NewEchoCanceller(voxaudio.EchoOptions{}))
+		}
+		session.SetBargeIn(voxaudio.OutputSpeaker, *bargeIn)
+		session.RegisterLocalTrack()
+	case "blackhole":
+		session.SetBargeIn(voxaudio.OutputBlackHole, *bargeIn)
+		session.RegisterBlackHoleTrack()
+	default:
+		return fmt.Errorf("unknown output %q, use speaker or blackhole", *output)
+	}
+
+	if err := session.Conn(); err != nil {
+		return err
+	}
+	if err := session.Start(cfg.device); err != nil {
+		return err
+	}
+	fmt.Printf("Translating %s into %s, press Ctrl+C to stop\n", cfg.device, cfg.targetLang)
+	if *typed {
+		go translateTyped(session, os.Stdin)
+	}
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	setup = false
+	select {
+	case <-ctx.Done():
+		session.Stop()
+	case <-session.Done(): // Stopped by the budget
+	}
+	// Let the tracks finalize the recordings before their sinks are closed
+	select {
+	case <-session.Done():
+	case <-time.After(5 * time.Second):
+		fmt.Println("Timed out waiting for the recordings to be saved")
+	}
+
+	if summary := session.LatencySummary(); summary.Turns > 0 {
+		fmt.Printf("Latency over %d turns: p50 %dms, p90 %dms, p99 %dms\n", summary.Turns,
+			summary.Total.P50.Milliseconds(), summary.Total.P90.Milliseconds(), summary.Total.P99.Milliseconds())
+	}
+	if usage, cost := session.Usage(); usage.Total() > 0 {
+		fmt.Printf("Used %d input and %d output tokens, estimated cost $%.4f\n",
+			usage.InputText+usage.InputAudio, usage.OutputText+usage.OutputAudio, cost)
+	}
+
+	if subs != nil {
+		if err := subs.WriteFiles(*subtitles, subFormat); err != nil {
+			return err
+		}
+		fmt.Printf("Saved subtitles to %s.*%s\n", *subtitles, subFormat.Extension())
+	}
+	return nil
+}
+
+// translateTyped sends each non-empty line read from r for translation
+func translateTyped(session *voxaudio.Session, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		if err := session.TranslateText(scanner.Text()); err != nil {
+			fmt.Printf("Failed to translate typed text: %v\n", err)
+		}
+	}
+}
+
+// openVoiceOverSink opens the file or, with a device: prefix, the output device the voice-over is written to
+func openVoiceOverSink(target string) (voxaudio.AudioSink, error) {
+	if name, ok := strings.CutPrefix(target, "device:"); ok {
+		return voxaudio.NewDeviceSink(nil, name)
+	}
+	switch strings.ToLower(filepath.Ext(target)) {
+	case ".wav":
+		return wavfile.Create(target, wavfile.Format{SampleRate: 48000, Channels: 1, SampleFormat: wavfile.PCM16})
+	case ".opus", ".ogg":
+		return voxaudio.NewOggOpusEncoder(target, 48000, 1)
+	}
+	return nil, fmt.Errorf("unsupported voice-over output %q, use .wav, .opus or device:NAME", target)
+}
+
+func parseRecordFormat(name string) (voxaudio.RecordFormat, error) {
+	switch strings.ToLower(name) {
+	case "wav":
+		return voxaudio.RecordWAV, nil
+	case "opus", "ogg":
+		return voxaudio.RecordOggOpus, nil
+	case "none":
+		return voxaudio.RecordNone, nil
+	}
+	return 0, fmt.Errorf("unknown record format %q, use wav, opus or none", name)
+}
+
+func parseSubtitleFormat(name string) (voxaudio.SubtitleFormat, error) {
+	switch strings.ToLower(name) {
+	case "srt":
+		return voxaudio.SubtitleSRT, nil
+	case "vtt", "webvtt":
+		return voxaudio.SubtitleWebVTT, nil
+	}
+	return 0, fmt.Errorf("unknown subtitle format %q, use srt or vtt", name)
+}
@@ -0,0 +1,127 @@
+package voxaudio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeviceInfo describes an audio device of a DeviceBackend
+type DeviceInfo struct {
+	Index             int // Backend specific device index
+	Name              string
+	HostAPI           string // e.g. CoreAudio, ALSA
+	MaxInputChannels  int
+	MaxOutputChannels int
+	DefaultSampleRate float64
+	DefaultInput      bool // Default input device of the default host API
+	DefaultOutput     bool // Default output device of the default host API
+
+	LowInputLatency   time.Duration
+	HighInputLatency  time.Duration
+	LowOutputLatency  time.Duration
+	HighOutputLatency time.Duration
+}
+
+// StreamConfig describes an input or output stream
+type StreamConfig struct {
+	Device          DeviceInfo
+	Channels        int
+	SampleRate      float64
+	FramesPerBuffer int           // 0 lets the backend choose
+	Latency         time.Duration // Suggested latency
+}
+
+// DeviceStream is an opened audio stream. The callback passed when opening
+// it is called from the backend's audio thread between Start and Stop.
+type DeviceStream interface {
+	Start() error
+	Stop() error
+	Close() error
+}
+
+// LatencyReporter is implemented by streams that know their actual latency,
+// which may differ from the suggested StreamConfig.Latency
+type LatencyReporter interface {
+	Latency() time.Duration
+}
+
+// DeviceBackend gives access to the audio devices. Init and Terminate are
+// reference counted: every successful Init must be paired with a Terminate.
+type DeviceBackend interface {
+	Init() error
+	Terminate()
+	Devices() ([]DeviceInfo, error)
+	// OpenInput opens a capture stream; callback receives interleaved samples
+	OpenInput(config StreamConfig, callback func(in []float32)) (DeviceStream, error)
+	// OpenOutput opens a playback stream; callback fills interleaved samples
+	OpenOutput(config StreamConfig, callback func(out []float32)) (DeviceStream, error)
+}
+
+var (
+	backendMu      sync.Mutex
+	defaultBackend DeviceBackend = PortAudioBackend{}
+)
+
+// SetDeviceBackend replaces the backend used by recorders and sessions created afterwards
+// Note: nil restores the PortAudio backend
+func SetDeviceBackend(backend DeviceBackend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if backend == nil {
+		backend = PortAudioBackend{}
+	}
+	defaultBackend = backend
+}
+
+// currentDeviceBackend returns the backend set by SetDeviceBackend
+func currentDeviceBackend() DeviceBackend {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	return defaultBackend
+}
+
+// findInputDevice selects the input device named name, falling back to the
+// first input device whose name contains it
+func findInputDevice(devices []DeviceInfo, name string) (DeviceInfo, bool) {
+	for _, dev := range devices {
+		if dev.MaxInputChannels > 0 && dev.Name == name {
+			return dev, true
+		}
+	}
+	if name == "" {
+		return DeviceInfo{}, false
+	}
+	for _, dev := range devices {
+		if dev.MaxInputChannels > 0 && strings.Contains(dev.Name, name) {
+			fmt.Printf("Found partial match device: %s\n", dev.Name)
+			return dev, true
+		}
+	}
+	return DeviceInfo{}, false
+}
+
+// findOutputDevice selects the first output device whose name contains name
+func findOutputDevice(devices []DeviceInfo, name string) (DeviceInfo, bool) {
+	for _, dev := range devices {
+		if dev.MaxOutputChannels > 0 && strings.Contains(dev.Name, name) {
+			return dev, true
+		}
+	}
+	return DeviceInfo{}, false
+}
+
+// SetDeviceBackend sets the audio devices used by the session's BlackHole output
+// Note: The input recorder keeps the backend it was created with, use SetAudioSource to replace it
+func (s *Session) SetDeviceBackend(backend DeviceBackend) {
+	s.backend = backend
+}
+
+// deviceBackend returns the session's backend or the package default
+func (s *Session) deviceBackend() DeviceBackend {
+	if s.backend != nil {
+		return s.backend
+	}
+	return currentDeviceBackend()
+}
@@ -0,0 +1,169 @@
+package voxaudio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"voxworld/rtpfile"
+)
+
+func TestFindInputDevice(t *testing.T) {
+	devices := []DeviceInfo{
+		{Index: 0, Name: "USB Audio Speaker", MaxOutputChannels: 2},
+		{Index: 1, Name: "USB Audio Mic (2)", MaxInputChannels: 1},
+		{Index: 2, Name: "USB Audio Mic", MaxInputChannels: 1},
+	}
+	dev, ok := findInputDevice(devices, "USB Audio Mic")
+	require.True(t, ok)
+	assert.Equal(t, 2, dev.Index, "exact match wins")
+
+	dev, ok = findInputDevice(devices, "Audio")
+	require.True(t, ok)
+	assert.Equal(t, 1, dev.Index, "output devices are skipped")
+
+	_, ok = findInputDevice(devices, "")
+	assert.False(t, ok)
+	_, ok = findInputDevice(devices, "Speaker")
+	assert.False(t, ok)
+}
+
+func TestLoopbackRecorderFakeBackend(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.SetSpeed(10)
+	backend.AddOutput("Speakers", 48000, 2)
+	ramp := make([]float32, 2*1024)
+	for i := range ramp {
+		ramp[i] = float32(i) / float32(len(ramp))
+	}
+	mic := backend.AddInput("Built-in Microphone", 16000, 2, FakeScript(ramp))
+
+	rec, err := NewLoopbackRecorderWithBackend(backend)
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.Users())
+
+	devices, err := rec.Devices()
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	assert.True(t, devices[1].DefaultInput)
+
+	require.Error(t, rec.Start("Line In"))
+	require.NoError(t, rec.Start("Microphone"))
+	rate, channels := rec.Format()
+	assert.Equal(t, 16000, rate)
+	assert.Equal(t, 2, channels)
+	config, open := mic.Config()
+	require.True(t, open)
+	assert.Equal(t, 512, config.FramesPerBuffer)
+	assert.Equal(t, mic.Info().LowInputLatency, config.Latency)
+
+	var got []float32
+	for len(got) < len(ramp) {
+		select {
+		case samples := <-rec.Audio():
+			assert.Len(t, samples, 512*2)
+			got = append(got, samples...)
+		case <-time.After(time.Second):
+			t.Fatal("no audio from the fake device")
+		}
+	}
+	assert.Equal(t, ramp, got[:len(ramp)])
+
+	require.NoError(t, rec.Stop())
+	require.NoError(t, rec.Stop())
+	assert.False(t, mic.Running())
+	_, open = mic.Config()
+	assert.False(t, open)
+	assert.Zero(t, backend.Users())
+}
+
+func TestOutputCaptureRecorderFakeBackend(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.AddInput("Microphone", 48000, 1, nil)
+	loopback := backend.AddInput("BlackHole 2ch", 48000, 2, nil)
+
+	rec, err := NewOutputCaptureRecorderWithBackend(backend)
+	require.NoError(t, err)
+	require.NoError(t, rec.Start("Microphone"))
+	config, open := loopback.Config()
+	require.True(t, open, "loopback devices are preferred")
+	assert.Equal(t, 2, config.Channels)
+	assert.Equal(t, loopback.Info().HighInputLatency, config.Latency)
+	require.NoError(t, rec.Stop())
+	assert.Zero(t, backend.Users())
+
+	// Without a loopback device the default input is used
+	backend = NewFakeBackend()
+	mic := backend.AddInput("Microphone", 48000, 1, nil)
+	rec, err = NewOutputCaptureRecorderWithBackend(backend)
+	require.NoError(t, err)
+	require.NoError(t, rec.Start("Headphones"))
+	_, open = mic.Config()
+	assert.True(t, open)
+	require.NoError(t, rec.Stop())
+}
+
+func TestFakeDeviceStreams(t *testing.T) {
+	backend := NewFakeBackend()
+	backend.SetSpeed(0)
+	out := backend.AddOutput("Speakers", 8000, 1)
+	config := StreamConfig{Device: out.Info(), Channels: 1, SampleRate: 8000, Latency: 30 * time.Millisecond}
+
+	_, err := backend.OpenInput(config, func([]float32) {})
+	assert.Error(t, err, "no input channels")
+	_, err = backend.OpenOutput(StreamConfig{Device: out.Info(), Channels: 2, SampleRate: 8000}, func([]float32) {})
+	assert.Error(t, err)
+
+	var n float32
+	stream, err := backend.OpenOutput(config, func(buf []float32) {
+		for i := range buf {
+			n++
+			buf[i] = n
+		}
+	})
+	require.NoError(t, err)
+	_, err = backend.OpenOutput(config, func([]float32) {})
+	assert.Error(t, err, "device is busy")
+	require.Implements(t, (*LatencyReporter)(nil), stream)
+	assert.Equal(t, 30*time.Millisecond, stream.(LatencyReporter).Latency())
+
+	require.NoError(t, stream.Start())
+	assert.True(t, out.Running())
+	require.Eventually(t, func() bool { return out.Buffers() >= 3 }, time.Second, time.Millisecond)
+	require.NoError(t, stream.Stop())
+	require.NoError(t, stream.Close())
+
+	captured := out.Captured()
+	assert.Len(t, captured, out.Buffers()*80, "10ms buffers by default")
+	for i, v := range captured {
+		if v != float32(i+1) {
+			t.Fatalf("sample %d = %v, want %d", i, v, i+1)
+		}
+	}
+	assert.Error(t, stream.Start(), "closed streams cannot restart")
+}
+
+func TestBlackHoleTrackFakeBackend(t *testing.T) {
+	backend := NewFakeBackend()
+	blackHole := backend.AddOutput("BlackHole 2ch", 48000, 2)
+	replay, err := NewRTPReplay(bytes.NewReader(writeCapture(t, rtpfile.RTPDump, 10)))
+	require.NoError(t, err)
+	replay.SetRealtime(true)
+
+	s := &Session{stopCh: make(chan struct{})}
+	s.SetDeviceBackend(backend)
+	require.NoError(t, s.blackHoleTrack(replay))
+
+	assert.Zero(t, backend.Users())
+	assert.False(t, blackHole.Running())
+	captured := blackHole.Captured()
+	assert.NotEmpty(t, captured)
+	assert.Zero(t, len(captured)%frameSize, "one decoded frame per buffer")
+
+	// Without a BlackHole device the track fails
+	s.SetDeviceBackend(NewFakeBackend())
+	assert.Error(t, s.blackHoleTrack(replay))
+}
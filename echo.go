@@ -0,0 +1,306 @@
+package voxaudio
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+)
+
+// EchoOptions configures an EchoCanceller
+type EchoOptions struct {
+	MaxDelay     time.Duration // Longest echo delay searched, default 500ms
+	FilterLength int           // Taps of the adaptive filter around the delay, default 256 (about 10ms)
+	StepSize     float64       // Adaptation speed of the filter, default 0.5
+}
+
+func (o EchoOptions) withDefaults() EchoOptions {
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 500 * time.Millisecond
+	}
+	if o.FilterLength <= 0 {
+		o.FilterLength = 256
+	}
+	if o.StepSize <= 0 {
+		o.StepSize = 0.5
+	}
+	return o
+}
+
+const (
+	echoWindow       = 8192            // Input samples correlated to estimate the delay
+	echoEstimateStep = inputSampleRate // Input samples between delay estimates
+	echoMinCorr      = 0.2             // Lowest normalized correlation accepted as echo
+	echoDoubleTalk   = 0.6             // Input louder than this share of the reference is near-end speech
+	echoHold         = 1200            // Samples the filter stays frozen after near-end speech
+)
+
+// EchoCanceller removes the translated audio played on the speaker from the
+// captured input, so the model does not translate its own output. Both
+// streams are 24 kHz mono. The delay between them is estimated by cross
+// correlation and the remaining echo path is learned by an NLMS filter.
+type EchoCanceller struct {
+	options  EchoOptions
+	maxDelay int // In samples
+
+	mu       sync.Mutex
+	bypass   bool
+	start    time.Time // Time of sample index 0 of both streams
+	far      []float32 // Played reference from index farStart
+	farStart int64
+	near     []float32 // Last echoWindow input samples
+	nearPos  int64     // Index of the next input sample, -1 before the first
+	delay    int       // Estimated delay in samples, -1 until echo was found
+	pending  int       // Input samples until the next delay estimate
+	hold     int       // Input samples until the filter adapts again
+	weights  []float64
+	inPower  float64 // Decaying energy of the input while the reference plays
+	outPower float64 // Decaying energy of the output while the reference plays
+}
+
+// NewEchoCanceller returns an echo canceller
+func NewEchoCanceller(options EchoOptions) *EchoCanceller {
+	options = options.withDefaults()
+	return &EchoCanceller{
+		options:  options,
+		maxDelay: int(options.MaxDelay.Seconds() * inputSampleRate),
+		nearPos:  -1,
+		delay:    -1,
+		pending:  echoWindow,
+		weights:  make([]float64, options.FilterLength),
+	}
+}
+
+// SetBypass passes the input through unchanged while enabled
+func (ec *EchoCanceller) SetBypass(bypass bool) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.bypass = bypass
+}
+
+// Delay returns the estimated echo delay; false until echo was detected
+func (ec *EchoCanceller) Delay() (time.Duration, bool) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.delay < 0 {
+		return 0, false
+	}
+	return time.Duration(ec.delay) * time.Second / inputSampleRate, true
+}
+
+// Reduction returns the echo removed over the last second while the
+// reference played (echo return loss enhancement), in dB
+func (ec *EchoCanceller) Reduction() float64 {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.inPower == 0 || ec.outPower == 0 {
+		return 0
+	}
+	return 10 * math.Log10(ec.inPower/ec.outPower)
+}
+
+// index returns the stream position of time at
+func (ec *EchoCanceller) index(at time.Time) int64 {
+	if ec.start.IsZero() {
+		ec.start = at
+	}
+	return int64(at.Sub(ec.start).Seconds() * inputSampleRate)
+}
+
+// Reference adds audio that started playing at the given time. Gaps in the
+// playback are filled with silence.
+func (ec *EchoCanceller) Reference(samples []float32, at time.Time) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	pos := ec.index(at)
+	end := ec.farStart + int64(len(ec.far))
+	if len(ec.far) == 0 && pos > ec.farStart {
+		ec.farStart = pos
+	} else if gap := pos - end; gap > 0 {
+		gap = min(gap, int64(ec.history()))
+		ec.far = append(ec.far, make([]float32, gap)...)
+	}
+	ec.far = append(ec.far, samples...)
+	if excess := len(ec.far) - ec.history(); excess > 0 {
+		ec.far = append(ec.far[:0], ec.far[excess:]...)
+		ec.farStart += int64(excess)
+	}
+}
+
+// history returns the number of reference samples kept
+func (ec *EchoCanceller) history() int {
+	return 2 * (echoWindow + ec.maxDelay + ec.options.FilterLength)
+}
+
+// farAt returns the reference sample at index i, silence outside the history
+func (ec *EchoCanceller) farAt(i int64) float64 {
+	i -= ec.farStart
+	if i < 0 || i >= int64(len(ec.far)) {
+		return 0
+	}
+	return float64(ec.far[i])
+}
+
+// Process removes the echo from a 24 kHz mono frame
+func (ec *EchoCanceller) Process(frame Frame) []float32 {
+	return ec.Cancel(frame.Samples, frame.Captured)
+}
+
+// Cancel removes the echo from input captured up to the given time
+func (ec *EchoCanceller) Cancel(samples []float32, at time.Time) []float32 {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.nearPos < 0 {
+		ec.nearPos = max(ec.index(at)-int64(len(samples)), 0)
+	}
+
+	out := make([]float32, len(samples))
+	taps := len(ec.weights)
+	x := make([]float64, taps)
+	const decay = 1 - 1.0/inputSampleRate
+	for i, sample := range samples {
+		n := ec.nearPos + int64(i)
+		d := float64(sample)
+		out[i] = sample
+		if ec.delay < 0 {
+			continue
+		}
+
+		// The middle tap is at the estimated delay
+		center := n - int64(ec.delay) + int64(taps/2)
+		var y, power, peak float64
+		for j := range x {
+			x[j] = ec.farAt(center - int64(j))
+			y += ec.weights[j] * x[j]
+			power += x[j] * x[j]
+			peak = max(peak, math.Abs(x[j]))
+		}
+		if power < 1e-6*float64(taps) {
+			continue // Nothing playing
+		}
+		e := d - y
+		if !ec.bypass {
+			out[i] = float32(e)
+		}
+		ec.inPower = ec.inPower*decay + d*d
+		ec.outPower = ec.outPower*decay + e*e
+
+		// Adapt unless the near end is talking over the playback
+		if math.Abs(d) > echoDoubleTalk*peak {
+			ec.hold = echoHold
+		}
+		if ec.hold > 0 {
+			ec.hold--
+		} else {
+			step := ec.options.StepSize * e / (power + 1e-6)
+			for j := range ec.weights {
+				ec.weights[j] += step * x[j]
+			}
+		}
+	}
+
+	ec.nearPos += int64(len(samples))
+	ec.near = append(ec.near, samples...)
+	if excess := len(ec.near) - echoWindow; excess > 0 {
+		ec.near = append(ec.near[:0], ec.near[excess:]...)
+	}
+	if ec.pending -= len(samples); ec.pending <= 0 {
+		ec.pending = echoEstimateStep
+		ec.estimateDelay()
+	}
+	return out
+}
+
+// estimateDelay finds the lag of the reference that best matches the
+// recent input. A clearly different delay restarts the filter.
+func (ec *EchoCanceller) estimateDelay() {
+	if len(ec.near) < echoWindow {
+		return
+	}
+	// Reference window from maxDelay before the input window to its end
+	start := ec.nearPos - echoWindow - int64(ec.maxDelay)
+	ref := make([]float64, echoWindow+ec.maxDelay)
+	for i := range ref {
+		ref[i] = ec.farAt(start + int64(i))
+	}
+
+	size := 1
+	for size < 2*echoWindow+ec.maxDelay {
+		size <<= 1
+	}
+	a := make([]complex128, size)
+	b := make([]complex128, size)
+	var nearEnergy float64
+	for i, sample := range ec.near {
+		a[i] = complex(float64(sample), 0)
+		nearEnergy += float64(sample) * float64(sample)
+	}
+	for i, sample := range ref {
+		b[i] = complex(sample, 0)
+	}
+	if nearEnergy == 0 {
+		return
+	}
+	fft(a, false)
+	fft(b, false)
+	for i := range a {
+		a[i] = cmplx.Conj(a[i]) * b[i]
+	}
+	fft(a, true)
+
+	// Normalize by the energy of the reference at each lag
+	energy := make([]float64, len(ref)+1)
+	for i, sample := range ref {
+		energy[i+1] = energy[i] + sample*sample
+	}
+	best, bestCorr := -1, echoMinCorr
+	for m := 0; m <= ec.maxDelay; m++ {
+		refEnergy := energy[m+echoWindow] - energy[m]
+		if refEnergy <= 0 {
+			continue
+		}
+		corr := math.Abs(real(a[m])) / math.Sqrt(nearEnergy*refEnergy)
+		if corr > bestCorr {
+			best, bestCorr = m, corr
+		}
+	}
+	if best < 0 {
+		return
+	}
+	delay := ec.maxDelay - best
+	if ec.delay < 0 || absInt(delay-ec.delay) > len(ec.weights)/4 {
+		ec.delay = delay
+		clear(ec.weights)
+	}
+}
+
+// SetEchoCanceller removes the speaker playback from the captured input
+// with ec, nil disables
+// Note: Only the speaker output is used as reference, see RegisterLocalTrack;
+// ec is the StageEcho stage of Processors
+func (s *Session) SetEchoCanceller(ec *EchoCanceller) {
+	if ec == nil {
+		s.setStage(StageEcho, nil)
+		return
+	}
+	s.setStage(StageEcho, ec)
+}
+
+// echoCanceller returns the configured echo canceller, nil if none
+func (s *Session) echoCanceller() *EchoCanceller {
+	ec, _ := stageOf[*EchoCanceller](s, StageEcho)
+	return ec
+}
+
+// echoReference returns a tap passing the PCM16 audio read by the player
+// to ec as reference
+func echoReference(ec *EchoCanceller) func(p []byte) {
+	resampler := newLinearResampler(sampleRate, inputSampleRate)
+	return func(p []byte) {
+		samples := make([]float32, len(p)/2)
+		for i := range samples {
+			samples[i] = float32(int16(uint16(p[2*i])|uint16(p[2*i+1])<<8)) / 32768
+		}
+		ec.Reference(resampler.process(downmix(samples, channels)), time.Now())
+	}
+}
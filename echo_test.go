@@ -0,0 +1,113 @@
+package voxaudio
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runEcho plays far in 10ms chunks and captures mic at the same time
+func runEcho(ec *EchoCanceller, t0 time.Time, far, mic []float32) []float32 {
+	const chunk = inputSampleRate / 100
+	var out []float32
+	for i := 0; i+chunk <= len(mic); i += chunk {
+		at := t0.Add(time.Duration(i) * time.Second / inputSampleRate)
+		if i+chunk <= len(far) {
+			ec.Reference(far[i:i+chunk], at)
+		}
+		out = append(out, ec.Cancel(mic[i:i+chunk], at.Add(10*time.Millisecond))...)
+	}
+	return out
+}
+
+// echoSignals returns a played signal and its echo, attenuated and delayed
+func echoSignals(seconds float64, delay int) ([]float32, []float32) {
+	rng := rand.New(rand.NewSource(1))
+	n := int(seconds * inputSampleRate)
+	far := make([]float32, n)
+	mic := make([]float32, n)
+	var smooth float64
+	for i := range far {
+		smooth = 0.7*smooth + 0.3*rng.NormFloat64()
+		far[i] = float32(0.3 * smooth)
+		if i >= delay {
+			mic[i] = 0.5*far[i-delay] + 0.1*far[i-delay+1]
+		}
+	}
+	return far, mic
+}
+
+func TestEchoCanceller(t *testing.T) {
+	delay := 120 * inputSampleRate / 1000
+	far, mic := echoSignals(4, delay)
+	ec := NewEchoCanceller(EchoOptions{})
+	_, ok := ec.Delay()
+	assert.False(t, ok)
+
+	out := runEcho(ec, time.Now(), far, mic)
+	estimated, ok := ec.Delay()
+	require.True(t, ok)
+	assert.InDelta(t, 120*time.Millisecond, estimated, float64(2*time.Millisecond))
+
+	// The echo is gone once the filter converged
+	last := len(out) - inputSampleRate
+	echo := rmsOf(mic[last:])
+	residual := rmsOf(out[last:])
+	assert.Greater(t, 20*math.Log10(echo/residual), 20.0)
+	assert.Greater(t, ec.Reduction(), 20.0)
+}
+
+func TestEchoCancellerKeepsNearSpeech(t *testing.T) {
+	delay := 80 * inputSampleRate / 1000
+	far, mic := echoSignals(4, delay)
+
+	// The speaker talks over the playback in the last second
+	near := make([]float32, len(mic))
+	for i := 3 * inputSampleRate; i < len(mic); i++ {
+		near[i] = float32(0.3 * math.Sin(2*math.Pi*440*float64(i)/inputSampleRate))
+		mic[i] += near[i]
+	}
+	ec := NewEchoCanceller(EchoOptions{})
+	out := runEcho(ec, time.Now(), far, mic)
+
+	start := 3*inputSampleRate + inputSampleRate/2
+	var diff float64
+	for i := start; i < len(out); i++ {
+		diff += math.Pow(float64(out[i]-near[i]), 2)
+	}
+	assert.Less(t, math.Sqrt(diff/float64(len(out)-start)), 0.2*rmsOf(near[start:]), "near-end speech kept")
+	assert.InDelta(t, rmsOf(near[start:]), rmsOf(out[start:]), 0.05*rmsOf(near[start:]))
+}
+
+func TestEchoCancellerBypass(t *testing.T) {
+	far, mic := echoSignals(2, 1000)
+	ec := NewEchoCanceller(EchoOptions{})
+	ec.SetBypass(true)
+	out := runEcho(ec, time.Now(), far, mic)
+	assert.Equal(t, mic[:len(out)], out)
+	_, ok := ec.Delay()
+	assert.True(t, ok, "delay is still estimated")
+}
+
+func TestEchoReferenceTap(t *testing.T) {
+	ec := NewEchoCanceller(EchoOptions{})
+	buffer := &playbackBuffer{tap: echoReference(ec)}
+	pcm := make([]byte, 2*frameSize)
+	for i := 0; i < frameSize; i++ {
+		v := int16(16384)
+		pcm[2*i], pcm[2*i+1] = byte(v), byte(v>>8)
+	}
+	_, _ = buffer.Write(pcm)
+	_, err := buffer.Read(make([]byte, len(pcm)))
+	require.NoError(t, err)
+
+	// 20ms of 48 kHz playback is 480 reference samples at 24 kHz
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	assert.InDelta(t, frameSize/2, len(ec.far), 1)
+	assert.InDelta(t, 0.5, ec.far[len(ec.far)-1], 1e-6)
+}
@@ -0,0 +1,179 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Realtime API server event types handled by the session
+const (
+	EventSessionCreated             = "session.created"
+	EventSessionUpdated             = "session.updated"
+	EventError                      = "error"
+	EventSpeechStarted              = "input_audio_buffer.speech_started"
+	EventSpeechStopped              = "input_audio_buffer.speech_stopped"
+	EventInputTranscriptionDone     = "conversation.item.input_audio_transcription.completed"
+	EventInputTranscriptionFailed   = "conversation.item.input_audio_transcription.failed"
+	EventConversationItemCreated    = "conversation.item.created"
+	EventResponseCreated            = "response.created"
+	EventResponseDone               = "response.done"
+	EventResponseOutputItemAdded    = "response.output_item.added"
+	EventFunctionCallArgumentsDone  = "response.function_call_arguments.done"
+	EventResponseAudioDelta         = "response.audio.delta"
+	EventResponseAudioTranscript    = "response.audio_transcript.delta"
+	EventResponseAudioTranscriptEnd = "response.audio_transcript.done"
+	EventResponseTextDelta          = "response.text.delta"
+	EventResponseTextDone           = "response.text.done"
+	EventOutputAudioStarted         = "output_audio_buffer.started"
+	EventOutputAudioStopped         = "output_audio_buffer.stopped"
+)
+
+// ServerEvent is an event received from the Realtime API over the data channel.
+// Only the commonly used fields are decoded; Raw holds the complete event.
+type ServerEvent struct {
+	Type         string `json:"type"`
+	EventID      string `json:"event_id,omitempty"`
+	ItemID       string `json:"item_id,omitempty"`
+	ResponseID   string `json:"response_id,omitempty"`
+	Delta        string `json:"delta,omitempty"`
+	Transcript   string `json:"transcript,omitempty"`
+	Text         string `json:"text,omitempty"`
+	AudioStartMs int    `json:"audio_start_ms,omitempty"`
+	AudioEndMs   int    `json:"audio_end_ms,omitempty"`
+
+	Raw      json.RawMessage `json:"-"` // Event as received
+	Received time.Time       `json:"-"` // Local receive time
+}
+
+// EventHandler handles a server event. Handlers run on the data channel's
+// goroutine and should return quickly.
+type EventHandler func(evt ServerEvent)
+
+// OnEvent registers a handler for server events of the given type.
+// An empty eventType registers the handler for all events.
+func (s *Session) OnEvent(eventType string, handler EventHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string][]EventHandler)
+	}
+	s.handlers[eventType] = append(s.handlers[eventType], handler)
+}
+
+// handleMessage is the data channel message callback
+func (s *Session) handleMessage(msg webrtc.DataChannelMessage) {
+	s.receiveMessage(msg, 0)
+}
+
+// receiveMessage handles a message of a connection that started at the
+// input position inputBaseMs
+func (s *Session) receiveMessage(msg webrtc.DataChannelMessage, inputBaseMs int64) {
+	if !msg.IsString {
+		return
+	}
+	received := time.Now()
+	s.mu.Lock()
+	log := s.messageLog
+	s.mu.Unlock()
+	if log != nil {
+		log.record(DirectionInbound, msg.Data, received)
+	}
+	if err := s.dispatchEventFrom(msg.Data, received, inputBaseMs); err != nil {
+		fmt.Printf("[DataChannel] Failed to handle message: %v\n", err)
+	}
+}
+
+// dispatchEvent decodes a server event and runs the registered handlers
+func (s *Session) dispatchEvent(data []byte, received time.Time) error {
+	return s.dispatchEventFrom(data, received, 0)
+}
+
+// dispatchEventFrom dispatches an event of a connection that started at the
+// input position inputBaseMs. Its speech positions are made relative to the
+// whole input.
+func (s *Session) dispatchEventFrom(data []byte, received time.Time, inputBaseMs int64) error {
+	var evt ServerEvent
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return fmt.Errorf("invalid event: %w", err)
+	}
+	evt.Raw = append(json.RawMessage(nil), data...)
+	evt.Received = received
+	if inputBaseMs > 0 && (evt.Type == EventSpeechStarted || evt.Type == EventSpeechStopped) {
+		evt.AudioStartMs += int(inputBaseMs)
+		evt.AudioEndMs += int(inputBaseMs)
+	}
+
+	if evt.Type == EventError {
+		fmt.Printf("[Session] Server error: %s\n", string(data))
+	}
+	s.latency.handleEvent(evt, s.inputStartTime())
+	s.handleUsage(evt)
+	s.trackOutputItems(evt)
+	s.handleBargeIn(evt)
+	s.handleToolEvent(evt)
+	s.trackConversation(evt)
+	s.confirmConfig(evt)
+
+	s.mu.Lock()
+	handlers := append([]EventHandler(nil), s.handlers[evt.Type]...)
+	handlers = append(handlers, s.handlers[""]...)
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(evt)
+	}
+	return nil
+}
+
+// sendText sends a client event over the data channel, or to the replay
+// driver when one is attached
+// Note: Events are queued until the data channel can take them
+func (s *Session) sendText(msg string) error {
+	return s.send(msg, outboundControl, nil)
+}
+
+// send queues an event of the given kind; sent is called once it went out
+func (s *Session) send(msg string, kind outboundKind, sent func(at time.Time)) error {
+	s.mu.Lock()
+	sender, dc := s.sender, s.dc
+	s.mu.Unlock()
+
+	switch {
+	case sender == nil && dc == nil:
+		return fmt.Errorf("data channel not opened")
+	case sender == nil:
+		s.outbound().push(outboundMessage{text: msg, kind: kind, sent: sent})
+		return nil
+	}
+	if err := sender(msg); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.logOutbound(msg, now)
+	if sent != nil {
+		sent(now)
+	}
+	return nil
+}
+
+// logOutbound records a sent event in the message log
+func (s *Session) logOutbound(msg string, at time.Time) {
+	s.mu.Lock()
+	log := s.messageLog
+	s.mu.Unlock()
+	if log != nil {
+		log.record(DirectionOutbound, []byte(msg), at)
+	}
+}
+
+// sendEvent encodes and sends a client event
+func (s *Session) sendEvent(evt interface{}) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	return s.sendText(string(b))
+}
@@ -0,0 +1,325 @@
+package voxaudio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeBackend is an in-memory DeviceBackend for machines without audio
+// hardware. Input devices generate their samples with a scripted function
+// and output devices keep everything played to them.
+type FakeBackend struct {
+	mu      sync.Mutex
+	devices []*FakeDevice
+	users   int
+	speed   float64
+}
+
+// NewFakeBackend returns a backend without devices that streams in real time
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{speed: 1}
+}
+
+// FakeDevice is a virtual device of a FakeBackend
+type FakeDevice struct {
+	backend  *FakeBackend
+	info     DeviceInfo
+	generate func(buf []float32) // Fills the buffers of an input stream
+
+	mu       sync.Mutex
+	stream   *fakeStream
+	config   StreamConfig
+	captured []float32
+	buffers  int
+}
+
+// AddInput adds an input device. generate fills each buffer of the stream
+// with interleaved samples; nil generates silence. The first input device
+// added is the default input.
+func (b *FakeBackend) AddInput(name string, sampleRate float64, channels int, generate func(buf []float32)) *FakeDevice {
+	return b.add(DeviceInfo{
+		Name:              name,
+		MaxInputChannels:  channels,
+		DefaultSampleRate: sampleRate,
+		LowInputLatency:   10 * time.Millisecond,
+		HighInputLatency:  40 * time.Millisecond,
+	}, generate)
+}
+
+// AddOutput adds an output device that keeps the samples played to it. The
+// first output device added is the default output.
+func (b *FakeBackend) AddOutput(name string, sampleRate float64, channels int) *FakeDevice {
+	return b.add(DeviceInfo{
+		Name:              name,
+		MaxOutputChannels: channels,
+		DefaultSampleRate: sampleRate,
+		LowOutputLatency:  10 * time.Millisecond,
+		HighOutputLatency: 40 * time.Millisecond,
+	}, nil)
+}
+
+func (b *FakeBackend) add(info DeviceInfo, generate func([]float32)) *FakeDevice {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	info.Index = len(b.devices)
+	info.HostAPI = "Fake"
+	info.DefaultInput = info.MaxInputChannels > 0
+	info.DefaultOutput = info.MaxOutputChannels > 0
+	for _, dev := range b.devices {
+		if dev.info.DefaultInput {
+			info.DefaultInput = false
+		}
+		if dev.info.DefaultOutput {
+			info.DefaultOutput = false
+		}
+	}
+	dev := &FakeDevice{backend: b, info: info, generate: generate}
+	b.devices = append(b.devices, dev)
+	return dev
+}
+
+// SetSpeed sets how fast streams run relative to real time
+// Note: 0 runs them without pausing between buffers
+func (b *FakeBackend) SetSpeed(speed float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.speed = speed
+}
+
+// Users returns the number of Init calls not yet paired with Terminate
+func (b *FakeBackend) Users() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.users
+}
+
+// Init registers a user of the backend
+func (b *FakeBackend) Init() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.users++
+	return nil
+}
+
+// Terminate unregisters a user of the backend
+func (b *FakeBackend) Terminate() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.users > 0 {
+		b.users--
+	}
+}
+
+// Devices lists the virtual devices in the order they were added
+func (b *FakeBackend) Devices() ([]DeviceInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	devices := make([]DeviceInfo, len(b.devices))
+	for i, dev := range b.devices {
+		devices[i] = dev.info
+	}
+	return devices, nil
+}
+
+// OpenInput opens a stream that calls callback with generated samples
+func (b *FakeBackend) OpenInput(config StreamConfig, callback func(in []float32)) (DeviceStream, error) {
+	dev, err := b.device(config, true)
+	if err != nil {
+		return nil, err
+	}
+	return dev.open(config, func(buf []float32) {
+		if dev.generate != nil {
+			dev.generate(buf)
+		}
+		callback(buf)
+	})
+}
+
+// OpenOutput opens a stream that keeps the samples written by callback
+func (b *FakeBackend) OpenOutput(config StreamConfig, callback func(out []float32)) (DeviceStream, error) {
+	dev, err := b.device(config, false)
+	if err != nil {
+		return nil, err
+	}
+	return dev.open(config, func(buf []float32) {
+		callback(buf)
+		dev.mu.Lock()
+		dev.captured = append(dev.captured, buf...)
+		dev.mu.Unlock()
+	})
+}
+
+// device validates config against the device it names
+func (b *FakeBackend) device(config StreamConfig, input bool) (*FakeDevice, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index := config.Device.Index
+	if index < 0 || index >= len(b.devices) {
+		return nil, fmt.Errorf("audio device %d not found", index)
+	}
+	dev := b.devices[index]
+	maxChannels := dev.info.MaxOutputChannels
+	if input {
+		maxChannels = dev.info.MaxInputChannels
+	}
+	if config.Channels <= 0 || config.Channels > maxChannels {
+		return nil, fmt.Errorf("invalid channel count %d for %s", config.Channels, dev.info.Name)
+	}
+	if config.SampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %.0f", config.SampleRate)
+	}
+	return dev, nil
+}
+
+// Info returns the description of the device
+func (d *FakeDevice) Info() DeviceInfo {
+	return d.info
+}
+
+// Config returns the configuration of the open stream
+func (d *FakeDevice) Config() (StreamConfig, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config, d.stream != nil
+}
+
+// Running reports whether a stream of the device is started
+func (d *FakeDevice) Running() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stream != nil && d.stream.stop != nil
+}
+
+// Buffers returns the number of buffers streamed since the device was added
+func (d *FakeDevice) Buffers() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.buffers
+}
+
+// Captured returns a copy of the samples played to an output device
+func (d *FakeDevice) Captured() []float32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]float32(nil), d.captured...)
+}
+
+// open creates the stream of the device; a device has one stream at a time
+func (d *FakeDevice) open(config StreamConfig, process func(buf []float32)) (DeviceStream, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stream != nil {
+		return nil, fmt.Errorf("audio device %s is busy", d.info.Name)
+	}
+	if config.FramesPerBuffer <= 0 {
+		config.FramesPerBuffer = int(config.SampleRate) / 100 // 10ms
+	}
+	d.config = config
+	d.stream = &fakeStream{device: d, process: process}
+	return d.stream, nil
+}
+
+// fakeStream runs the callback of a FakeDevice on its own goroutine
+type fakeStream struct {
+	device  *FakeDevice
+	process func(buf []float32)
+	stop    chan struct{} // Non-nil while started
+	done    chan struct{}
+	closed  bool
+}
+
+func (s *fakeStream) Start() error {
+	d := s.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("stream closed")
+	}
+	if s.stop != nil {
+		return nil
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(d.config, s.stop, s.done)
+	return nil
+}
+
+func (s *fakeStream) run(config StreamConfig, stop, done chan struct{}) {
+	defer close(done)
+	period := time.Duration(float64(config.FramesPerBuffer) / config.SampleRate * float64(time.Second))
+	next := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		buf := make([]float32, config.FramesPerBuffer*config.Channels)
+		s.process(buf)
+		s.device.mu.Lock()
+		s.device.buffers++
+		s.device.mu.Unlock()
+
+		s.device.backend.mu.Lock()
+		speed := s.device.backend.speed
+		s.device.backend.mu.Unlock()
+		if speed <= 0 {
+			continue
+		}
+		next = next.Add(time.Duration(float64(period) / speed))
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// Latency returns the suggested latency, which the fake device always grants
+func (s *fakeStream) Latency() time.Duration {
+	d := s.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config.Latency
+}
+
+func (s *fakeStream) Stop() error {
+	d := s.device
+	d.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop = nil
+	d.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
+
+func (s *fakeStream) Close() error {
+	s.Stop()
+	d := s.device
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		d.stream = nil
+	}
+	return nil
+}
+
+// FakeScript returns an input generator that plays samples once and then
+// silence
+func FakeScript(samples []float32) func(buf []float32) {
+	var mu sync.Mutex
+	pos := 0
+	return func(buf []float32) {
+		mu.Lock()
+		defer mu.Unlock()
+		n := copy(buf, samples[pos:])
+		pos += n
+		clear(buf[n:])
+	}
+}
@@ -0,0 +1,166 @@
+package voxaudio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const realtimeSessionsURL = "https://api.openai.com/v1/realtime/sessions"
+
+// KeyProvider supplies the key that authorizes a realtime connection.
+// It is asked again for every connection, so it can hand out fresh keys.
+type KeyProvider interface {
+	Key(ctx context.Context) (string, error)
+}
+
+// StaticKey is a key used as is, such as an ephemeral key minted elsewhere
+type StaticKey string
+
+func (k StaticKey) Key(ctx context.Context) (string, error) {
+	if k == "" {
+		return "", fmt.Errorf("no API key")
+	}
+	return string(k), nil
+}
+
+// EphemeralKeyOptions configures the minting of ephemeral keys
+type EphemeralKeyOptions struct {
+	Model         string        // Realtime model the keys are minted for
+	Voice         string        // Optional voice of the minted sessions
+	URL           string        // Sessions endpoint, default the OpenAI realtime sessions URL
+	RefreshBefore time.Duration // Mint a new key this long before expiry, default 15s
+	Client        *http.Client  // Default has a 30s timeout
+}
+
+func (o EphemeralKeyOptions) withDefaults() EphemeralKeyOptions {
+	if o.URL == "" {
+		o.URL = realtimeSessionsURL
+	}
+	if o.RefreshBefore <= 0 {
+		o.RefreshBefore = 15 * time.Second
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return o
+}
+
+// EphemeralKeyProvider mints short-lived client secrets with a server-side
+// API key, so the long-lived key never authorizes a connection itself.
+// Keys are cached and minted again shortly before they expire.
+type EphemeralKeyProvider struct {
+	apiKey  string
+	options EphemeralKeyOptions
+	now     func() time.Time
+
+	mu      sync.Mutex
+	key     string
+	expires time.Time
+}
+
+// NewEphemeralKeyProvider returns a provider minting keys with apiKey
+func NewEphemeralKeyProvider(apiKey string, options EphemeralKeyOptions) *EphemeralKeyProvider {
+	return &EphemeralKeyProvider{apiKey: apiKey, options: options.withDefaults(), now: time.Now}
+}
+
+// Key returns the cached key, minting a new one when it is about to expire
+func (p *EphemeralKeyProvider) Key(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.key != "" && p.now().Add(p.options.RefreshBefore).Before(p.expires) {
+		return p.key, nil
+	}
+	key, expires, err := p.mint(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.key, p.expires = key, expires
+	fmt.Printf("[Session] Minted ephemeral key, expires at %s\n", expires.Format(time.TimeOnly))
+	return key, nil
+}
+
+// Expires returns when the cached key expires, zero if none was minted
+func (p *EphemeralKeyProvider) Expires() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expires
+}
+
+// mint requests a new client secret from the sessions endpoint
+func (p *EphemeralKeyProvider) mint(ctx context.Context) (string, time.Time, error) {
+	if p.apiKey == "" {
+		return "", time.Time{}, fmt.Errorf("no API key to mint ephemeral keys")
+	}
+	params := map[string]string{"model": p.options.Model}
+	if p.options.Voice != "" {
+		params["voice"] = p.options.Voice
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode session request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.options.Client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to mint ephemeral key: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read session response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("failed to mint ephemeral key: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var session struct {
+		ClientSecret struct {
+			Value     string `json:"value"`
+			ExpiresAt int64  `json:"expires_at"`
+		} `json:"client_secret"`
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid session response: %w", err)
+	}
+	if session.ClientSecret.Value == "" {
+		return "", time.Time{}, fmt.Errorf("session response has no client secret")
+	}
+	return session.ClientSecret.Value, time.Unix(session.ClientSecret.ExpiresAt, 0), nil
+}
+
+// SetKeyProvider replaces the key passed to NewSession as the source of the
+// keys that authorize connections
+// Note: Takes effect on the next call to Conn
+func (s *Session) SetKeyProvider(provider KeyProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = provider
+}
+
+// connectionKey returns the key for a new connection
+func (s *Session) connectionKey(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	provider := s.keys
+	s.mu.Unlock()
+	if provider == nil {
+		provider = StaticKey(s.ephemeralKey)
+	}
+	key, err := provider.Key(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
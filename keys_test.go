@@ -0,0 +1,101 @@
+package voxaudio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionsServer stands in for the realtime sessions endpoint. Each minted
+// key is valid for a minute from the given clock.
+func sessionsServer(t *testing.T, now func() time.Time) (*httptest.Server, *atomic.Int32) {
+	var minted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			http.Error(w, `{"error":{"message":"invalid api key"}}`, http.StatusUnauthorized)
+			return
+		}
+		var params map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil || params["model"] == "" {
+			http.Error(w, `{"error":{"message":"model is required"}}`, http.StatusBadRequest)
+			return
+		}
+		n := minted.Add(1)
+		fmt.Fprintf(w, `{"id":"sess_%d","model":%q,"client_secret":{"value":"ek_%d","expires_at":%d}}`,
+			n, params["model"], n, now().Add(time.Minute).Unix())
+	}))
+	t.Cleanup(server.Close)
+	return server, &minted
+}
+
+func TestEphemeralKeyProvider(t *testing.T) {
+	clock := time.Unix(1_700_000_000, 0)
+	now := func() time.Time { return clock }
+	server, minted := sessionsServer(t, now)
+
+	p := NewEphemeralKeyProvider("sk-test", EphemeralKeyOptions{Model: "gpt-4o-mini-realtime-preview", URL: server.URL})
+	p.now = now
+	assert.True(t, p.Expires().IsZero())
+
+	key, err := p.Key(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ek_1", key)
+	assert.Equal(t, clock.Add(time.Minute), p.Expires())
+
+	// Cached until shortly before expiry
+	clock = clock.Add(40 * time.Second)
+	key, err = p.Key(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ek_1", key)
+	clock = clock.Add(6 * time.Second)
+	key, err = p.Key(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ek_2", key)
+	assert.Equal(t, int32(2), minted.Load())
+}
+
+func TestEphemeralKeyProviderErrors(t *testing.T) {
+	server, minted := sessionsServer(t, time.Now)
+
+	_, err := NewEphemeralKeyProvider("sk-wrong", EphemeralKeyOptions{Model: "m", URL: server.URL}).Key(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid api key")
+
+	_, err = NewEphemeralKeyProvider("sk-test", EphemeralKeyOptions{URL: server.URL}).Key(context.Background())
+	assert.ErrorContains(t, err, "400")
+
+	_, err = NewEphemeralKeyProvider("", EphemeralKeyOptions{Model: "m", URL: server.URL}).Key(context.Background())
+	assert.Error(t, err)
+	assert.Zero(t, minted.Load())
+
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"sess_1"}`)
+	}))
+	defer empty.Close()
+	_, err = NewEphemeralKeyProvider("sk-test", EphemeralKeyOptions{Model: "m", URL: empty.URL}).Key(context.Background())
+	assert.ErrorContains(t, err, "no client secret")
+}
+
+func TestSessionConnectionKey(t *testing.T) {
+	s := &Session{ephemeralKey: "ek_static"}
+	key, err := s.connectionKey(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ek_static", key)
+
+	server, _ := sessionsServer(t, time.Now)
+	s.SetKeyProvider(NewEphemeralKeyProvider("sk-test", EphemeralKeyOptions{Model: "m", URL: server.URL}))
+	key, err = s.connectionKey(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ek_1", key)
+
+	_, err = (&Session{}).connectionKey(context.Background())
+	assert.Error(t, err)
+}
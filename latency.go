@@ -0,0 +1,296 @@
+package voxaudio
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TurnLatency breaks down the delay between the end of a spoken turn and
+// the start of its translation on the output device
+type TurnLatency struct {
+	ItemID      string    // Input item of the turn
+	ResponseID  string    // Response that translated it
+	SpeechStart time.Time // Estimated time the speaker started
+	SpeechEnd   time.Time // Estimated time the speaker stopped
+
+	Capture  time.Duration // Speech end until the audio reached the session
+	Upload   time.Duration // Until that audio was sent on the data channel
+	Model    time.Duration // Until the server reported the first audio of the response
+	Network  time.Duration // Until the first RTP packet of the response was decoded
+	Playback time.Duration // Until that audio left the output buffer
+	Total    time.Duration
+}
+
+// LatencyPercentiles summarizes one component of the turn latency
+type LatencyPercentiles struct {
+	P50, P90, P99 time.Duration
+}
+
+// LatencySummary aggregates the measured turns of a session
+type LatencySummary struct {
+	Turns    int
+	Capture  LatencyPercentiles
+	Upload   LatencyPercentiles
+	Model    LatencyPercentiles
+	Network  LatencyPercentiles
+	Playback LatencyPercentiles
+	Total    LatencyPercentiles
+}
+
+const (
+	maxLatencyInputs  = 4096 // Uploaded chunks remembered to locate the end of speech
+	maxLatencyTurns   = 16   // Turns waiting for their translation
+	maxLatencyResults = 1000 // Turns kept for the percentiles
+
+	// Audible packets closer than this belong to the same response
+	latencyPlaybackGap = 500 * time.Millisecond
+)
+
+// latencyInput records when a chunk of the uploaded audio was captured and sent
+type latencyInput struct {
+	startMs, endMs int64 // Position in the uploaded input audio
+	received       time.Time
+	sent           time.Time
+}
+
+// latencyTurn is a turn whose translation has not been heard yet
+type latencyTurn struct {
+	TurnLatency
+	uploaded   time.Time // When the end of speech was sent
+	created    time.Time // When the response was created
+	firstAudio time.Time // When the server reported the first audio
+}
+
+// latencyTracker measures the turn latency of a session
+type latencyTracker struct {
+	mu       sync.Mutex
+	inputs   []latencyInput
+	turns    []*latencyTurn
+	results  []TurnLatency
+	handlers []func(TurnLatency)
+
+	playing     bool      // A response is being played
+	lastAudible time.Time // When the last audible packet was decoded
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{}
+}
+
+// addInput records an uploaded chunk covering [startMs, endMs) of the input
+func (l *latencyTracker) addInput(startMs, endMs int64, received, sent time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.inputs) == maxLatencyInputs {
+		l.inputs = append(l.inputs[:0], l.inputs[maxLatencyInputs/2:]...)
+	}
+	l.inputs = append(l.inputs, latencyInput{startMs: startMs, endMs: endMs, received: received, sent: sent})
+}
+
+// locate returns when the audio at ms was spoken, received and sent
+func (l *latencyTracker) locate(ms int64, inputStart time.Time) (spoken, received, sent time.Time) {
+	for i := len(l.inputs) - 1; i >= 0; i-- {
+		in := l.inputs[i]
+		if ms > in.startMs && ms <= in.endMs || ms == 0 && in.startMs == 0 {
+			// The last sample of a chunk was captured when it was received
+			spoken = in.received.Add(-time.Duration(in.endMs-ms) * time.Millisecond)
+			return spoken, in.received, in.sent
+		}
+	}
+	// Not uploaded by this session, fall back to the upload timeline
+	at := inputStart.Add(time.Duration(ms) * time.Millisecond)
+	return at, at, at
+}
+
+// handleEvent follows the turns through the server events
+func (l *latencyTracker) handleEvent(evt ServerEvent, inputStart time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch evt.Type {
+	case EventSpeechStarted:
+		turn := &latencyTurn{}
+		turn.ItemID = evt.ItemID
+		turn.SpeechStart, _, _ = l.locate(int64(evt.AudioStartMs), inputStart)
+		l.addTurn(turn)
+	case EventSpeechStopped:
+		var turn *latencyTurn
+		for _, t := range l.turns {
+			if t.ItemID == evt.ItemID && t.SpeechEnd.IsZero() {
+				turn = t
+			}
+		}
+		if turn == nil {
+			turn = &latencyTurn{}
+			turn.ItemID = evt.ItemID
+			l.addTurn(turn)
+		}
+		spoken, received, sent := l.locate(int64(evt.AudioEndMs), inputStart)
+		turn.SpeechEnd, turn.uploaded = spoken, sent
+		turn.Capture = received.Sub(spoken)
+		turn.Upload = sent.Sub(received)
+	case EventResponseCreated:
+		// The response answers the latest finished turn; older unanswered
+		// turns will not be translated
+		responseID, _ := responseStatus(evt)
+		for i := len(l.turns) - 1; i >= 0; i-- {
+			if answered := l.turns[i]; answered.ResponseID == "" && !answered.SpeechEnd.IsZero() {
+				answered.ResponseID = responseID
+				answered.created = evt.Received
+				l.turns = slices.DeleteFunc(l.turns, func(t *latencyTurn) bool {
+					return t.ResponseID == "" && !t.SpeechEnd.IsZero()
+				})
+				break
+			}
+		}
+	case EventResponseDone:
+		// A cancelled or failed response may never play
+		responseID, status := responseStatus(evt)
+		if status == "cancelled" || status == "failed" {
+			l.turns = slices.DeleteFunc(l.turns, func(t *latencyTurn) bool {
+				return t.ResponseID == responseID
+			})
+		}
+	case EventOutputAudioStopped:
+		l.playing = false
+	case EventResponseAudioDelta, EventOutputAudioStarted:
+		for _, turn := range l.turns {
+			if turn.ResponseID != "" && turn.firstAudio.IsZero() &&
+				(evt.ResponseID == "" || evt.ResponseID == turn.ResponseID) {
+				turn.firstAudio = evt.Received
+				break
+			}
+		}
+	}
+}
+
+// addTurn queues a turn, dropping the oldest when too many are waiting
+func (l *latencyTracker) addTurn(turn *latencyTurn) {
+	if len(l.turns) == maxLatencyTurns {
+		l.turns = l.turns[1:]
+	}
+	l.turns = append(l.turns, turn)
+}
+
+// audioDecoded is called for each audible packet of the output. The first
+// packet after a pause completes the oldest answered turn; buffered is the
+// output queued ahead of it.
+func (l *latencyTracker) audioDecoded(at time.Time, buffered time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	continued := l.playing && at.Sub(l.lastAudible) < latencyPlaybackGap
+	l.lastAudible = at
+	if continued {
+		l.mu.Unlock()
+		return
+	}
+	var turn *latencyTurn
+	for i, t := range l.turns {
+		if t.ResponseID != "" && !t.created.After(at) {
+			turn = t
+			l.turns = append(l.turns[:i:i], l.turns[i+1:]...)
+			break
+		}
+	}
+	if turn == nil {
+		l.mu.Unlock()
+		return
+	}
+	l.playing = true
+
+	firstAudio := turn.firstAudio
+	if firstAudio.IsZero() || firstAudio.After(at) {
+		firstAudio = at // The packet arrived before the event
+	}
+	turn.Model = nonNegative(firstAudio.Sub(turn.uploaded))
+	turn.Network = at.Sub(firstAudio)
+	turn.Playback = buffered
+	turn.Total = turn.Capture + turn.Upload + turn.Model + turn.Network + turn.Playback
+	result := turn.TurnLatency
+
+	if len(l.results) == maxLatencyResults {
+		l.results = l.results[1:]
+	}
+	l.results = append(l.results, result)
+	handlers := slices.Clone(l.handlers)
+	l.mu.Unlock()
+
+	fmt.Printf("[Latency] Turn %s: %dms (capture %dms, upload %dms, model %dms, network %dms, playback %dms)\n",
+		result.ItemID, result.Total.Milliseconds(), result.Capture.Milliseconds(), result.Upload.Milliseconds(),
+		result.Model.Milliseconds(), result.Network.Milliseconds(), result.Playback.Milliseconds())
+	for _, handler := range handlers {
+		handler(result)
+	}
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// summary computes the percentiles of the measured turns
+func (l *latencyTracker) summary() LatencySummary {
+	if l == nil {
+		return LatencySummary{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	component := func(get func(TurnLatency) time.Duration) LatencyPercentiles {
+		values := make([]time.Duration, len(l.results))
+		for i, r := range l.results {
+			values[i] = get(r)
+		}
+		slices.Sort(values)
+		return LatencyPercentiles{
+			P50: percentile(values, 50),
+			P90: percentile(values, 90),
+			P99: percentile(values, 99),
+		}
+	}
+	return LatencySummary{
+		Turns:    len(l.results),
+		Capture:  component(func(r TurnLatency) time.Duration { return r.Capture }),
+		Upload:   component(func(r TurnLatency) time.Duration { return r.Upload }),
+		Model:    component(func(r TurnLatency) time.Duration { return r.Model }),
+		Network:  component(func(r TurnLatency) time.Duration { return r.Network }),
+		Playback: component(func(r TurnLatency) time.Duration { return r.Playback }),
+		Total:    component(func(r TurnLatency) time.Duration { return r.Total }),
+	}
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	return sorted[max(rank, 1)-1]
+}
+
+// OnLatency registers a handler called with the latency of each translated turn
+// Note: Only turns whose translation is played by the local or BlackHole track are measured
+func (s *Session) OnLatency(handler func(TurnLatency)) {
+	if s.latency == nil {
+		return
+	}
+	s.latency.mu.Lock()
+	defer s.latency.mu.Unlock()
+	s.latency.handlers = append(s.latency.handlers, handler)
+}
+
+// LatencySummary returns the latency percentiles of the turns measured so far
+func (s *Session) LatencySummary() LatencySummary {
+	return s.latency.summary()
+}
@@ -0,0 +1,113 @@
+package voxaudio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLatencySession returns a session that uploaded 3 seconds of input in
+// 100ms chunks starting at t0, each sent 5ms after it was captured
+func newLatencySession(t0 time.Time) *Session {
+	s := &Session{latency: newLatencyTracker(), inputStartedAt: t0}
+	for k := int64(0); k < 30; k++ {
+		received := t0.Add(time.Duration(k+1) * 100 * time.Millisecond)
+		s.latency.addInput(k*100, (k+1)*100, received, received.Add(5*time.Millisecond))
+	}
+	return s
+}
+
+func dispatchAt(t *testing.T, s *Session, at time.Time, format string, args ...interface{}) {
+	t.Helper()
+	require.NoError(t, s.dispatchEvent([]byte(fmt.Sprintf(format, args...)), at))
+}
+
+func TestLatencyBreakdown(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newLatencySession(t0)
+	var reported []TurnLatency
+	s.OnLatency(func(l TurnLatency) { reported = append(reported, l) })
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+
+	dispatchAt(t, s, ms(700), `{"type":"input_audio_buffer.speech_started","item_id":"item_1","audio_start_ms":250}`)
+	dispatchAt(t, s, ms(1800), `{"type":"input_audio_buffer.speech_stopped","item_id":"item_1","audio_end_ms":1250}`)
+	dispatchAt(t, s, ms(1900), `{"type":"response.created","response":{"id":"resp_1","status":"in_progress"}}`)
+	s.latency.audioDecoded(ms(1850), 0) // Audio before the response belongs to no turn
+	dispatchAt(t, s, ms(2000), `{"type":"output_audio_buffer.started","response_id":"resp_1"}`)
+	s.latency.audioDecoded(ms(2600), 40*time.Millisecond)
+
+	require.Len(t, reported, 1)
+	got := reported[0]
+	assert.Equal(t, "item_1", got.ItemID)
+	assert.Equal(t, "resp_1", got.ResponseID)
+	assert.Equal(t, ms(250), got.SpeechStart)
+	assert.Equal(t, ms(1250), got.SpeechEnd)
+	assert.Equal(t, 50*time.Millisecond, got.Capture, "rest of the 100ms chunk")
+	assert.Equal(t, 5*time.Millisecond, got.Upload)
+	assert.Equal(t, 695*time.Millisecond, got.Model)
+	assert.Equal(t, 600*time.Millisecond, got.Network)
+	assert.Equal(t, 40*time.Millisecond, got.Playback)
+	assert.Equal(t, 1390*time.Millisecond, got.Total)
+	assert.Equal(t, 1, s.LatencySummary().Turns)
+}
+
+func TestLatencyTurnMatching(t *testing.T) {
+	t0 := time.Now()
+	s := newLatencySession(t0)
+	var reported []TurnLatency
+	s.OnLatency(func(l TurnLatency) { reported = append(reported, l) })
+	ms := func(n int) time.Time { return t0.Add(time.Duration(n) * time.Millisecond) }
+
+	// A cancelled response never plays
+	dispatchAt(t, s, ms(600), `{"type":"input_audio_buffer.speech_stopped","item_id":"item_1","audio_end_ms":500}`)
+	dispatchAt(t, s, ms(700), `{"type":"response.created","response":{"id":"resp_1"}}`)
+	dispatchAt(t, s, ms(800), `{"type":"response.done","response":{"id":"resp_1","status":"cancelled"}}`)
+
+	// Two turns answered while the first translation is still playing
+	dispatchAt(t, s, ms(1100), `{"type":"input_audio_buffer.speech_stopped","item_id":"item_2","audio_end_ms":1000}`)
+	dispatchAt(t, s, ms(1200), `{"type":"response.created","response":{"id":"resp_2"}}`)
+	dispatchAt(t, s, ms(1600), `{"type":"input_audio_buffer.speech_stopped","item_id":"item_3","audio_end_ms":1500}`)
+	dispatchAt(t, s, ms(1700), `{"type":"response.created","response":{"id":"resp_3"}}`)
+	for at := 1300; at < 2000; at += 20 {
+		s.latency.audioDecoded(ms(at), 0)
+	}
+	require.Len(t, reported, 1, "continuous audio is one response")
+	assert.Equal(t, "item_2", reported[0].ItemID)
+
+	// The next response starts after the output stopped
+	dispatchAt(t, s, ms(2000), `{"type":"output_audio_buffer.stopped","response_id":"resp_2"}`)
+	s.latency.audioDecoded(ms(2020), 0)
+	require.Len(t, reported, 2)
+	assert.Equal(t, "item_3", reported[1].ItemID)
+	assert.Zero(t, reported[1].Network, "no audio started event, the packet marks the first audio")
+	assert.Equal(t, 2020*time.Millisecond-1505*time.Millisecond, reported[1].Model)
+
+	// Without the stopped event a pause in the audio also separates responses
+	dispatchAt(t, s, ms(2300), `{"type":"input_audio_buffer.speech_stopped","item_id":"item_4","audio_end_ms":2200}`)
+	dispatchAt(t, s, ms(2400), `{"type":"response.created","response":{"id":"resp_4"}}`)
+	s.latency.audioDecoded(ms(2450), 0)
+	assert.Len(t, reported, 2)
+	s.latency.audioDecoded(ms(3000), 0)
+	require.Len(t, reported, 3)
+	assert.Equal(t, "item_4", reported[2].ItemID)
+}
+
+func TestLatencyPercentiles(t *testing.T) {
+	l := newLatencyTracker()
+	for i := 1; i <= 100; i++ {
+		l.results = append(l.results, TurnLatency{Total: time.Duration(i) * time.Millisecond})
+	}
+	summary := l.summary()
+	assert.Equal(t, 100, summary.Turns)
+	assert.Equal(t, LatencyPercentiles{P50: 50 * time.Millisecond, P90: 90 * time.Millisecond, P99: 99 * time.Millisecond}, summary.Total)
+	assert.Equal(t, LatencyPercentiles{}, summary.Capture)
+
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+	assert.Equal(t, 7*time.Millisecond, percentile([]time.Duration{7 * time.Millisecond}, 99))
+
+	// Sessions built without a tracker report nothing
+	assert.Equal(t, LatencySummary{}, (&Session{}).LatencySummary())
+}
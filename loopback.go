@@ -19,21 +19,30 @@ func contains(s, substr string) bool {
 
 // LoopbackRecorder captures audio samples from specified loopback device.
 type LoopbackRecorder struct {
-	mu       sync.Mutex
-	stream   *portaudio.Stream
-	Samples  chan []float32
-	isClosed bool // Add flag to track if channel is closed
+	mu         sync.Mutex
+	backend    DeviceBackend
+	stream     DeviceStream
+	Samples    chan []float32
+	SampleRate int  // Sample rate of the opened stream, set by Start
+	Channels   int  // Interleaved channels per sample frame, set by Start
+	isClosed   bool // Add flag to track if channel is closed
 }
 
-// NewLoopbackRecorder initializes PortAudio and returns an instance.
+// NewLoopbackRecorder initializes the device backend and returns an instance.
 func NewLoopbackRecorder() (*LoopbackRecorder, error) {
-	if err := SafePortAudioInit(); err != nil {
+	return NewLoopbackRecorderWithBackend(currentDeviceBackend())
+}
+
+// NewLoopbackRecorderWithBackend returns a recorder that captures from the devices of backend.
+func NewLoopbackRecorderWithBackend(backend DeviceBackend) (*LoopbackRecorder, error) {
+	if err := backend.Init(); err != nil {
 		return nil, err
 	}
-	return &LoopbackRecorder{Samples: make(chan []float32, 1024), isClosed: false}, nil
+	return &LoopbackRecorder{backend: backend, Samples: make(chan []float32, 1024), isClosed: false}, nil
 }
 
 // ListDevices lists all PortAudio devices and their indices.
+// Note: Always enumerates PortAudio, use Devices for the recorder's backend
 func (r *LoopbackRecorder) ListDevices() ([]*portaudio.HostApiInfo, error) {
 	apis, err := portaudio.HostApis() // Enumerate all Host APIs (e.g., CoreAudio)
 	if err != nil {
@@ -42,49 +51,26 @@ func (r *LoopbackRecorder) ListDevices() ([]*portaudio.HostApiInfo, error) {
 	return apis, nil
 }
 
+// Devices lists the devices of the recorder's backend.
+func (r *LoopbackRecorder) Devices() ([]DeviceInfo, error) {
+	return r.backend.Devices()
+}
+
 // Start opens loopback input stream based on device name and begins capture.
 func (r *LoopbackRecorder) Start(deviceName string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Enumerate all devices, look for input device with matching name
-	var selected *portaudio.DeviceInfo
-	apis, err := portaudio.HostApis()
+	// Enumerate all devices, look for input device with matching name,
+	// then for one whose name contains it
+	devices, err := r.backend.Devices()
 	if err != nil {
 		return err
 	}
-
-	// Exact device name match
-	for _, api := range apis {
-		for _, dev := range api.Devices {
-			if dev.MaxInputChannels > 0 && dev.Name == deviceName {
-				selected = dev
-				break
-			}
-		}
-		if selected != nil {
-			break
-		}
-	}
-
-	// If no exact match found, try partial match (input device names usually contain relevant information)
-	if selected == nil && deviceName != "" {
-		for _, api := range apis {
-			for _, dev := range api.Devices {
-				if dev.MaxInputChannels > 0 && contains(dev.Name, deviceName) {
-					selected = dev
-					fmt.Printf("Found partial match device: %s\n", dev.Name)
-					break
-				}
-			}
-			if selected != nil {
-				break
-			}
-		}
-	}
+	selected, ok := findInputDevice(devices, deviceName)
 
 	// If device still not found, return error
-	if selected == nil {
+	if !ok {
 		return fmt.Errorf("specified input device not found: %s", deviceName)
 	}
 
@@ -93,13 +79,16 @@ func (r *LoopbackRecorder) Start(deviceName string) error {
 	const framesPerBuffer = 512 // Small value to reduce latency, but large enough to avoid frame drops
 
 	// Use low latency settings instead of high latency configuration
-	params := portaudio.LowLatencyParameters(selected, nil)
-	params.Input.Channels = selected.MaxInputChannels
-	params.SampleRate = selected.DefaultSampleRate
-	params.FramesPerBuffer = framesPerBuffer
+	config := StreamConfig{
+		Device:          selected,
+		Channels:        selected.MaxInputChannels,
+		SampleRate:      selected.DefaultSampleRate,
+		FramesPerBuffer: framesPerBuffer,
+		Latency:         selected.LowInputLatency,
+	}
 
 	// Open stream and set callback
-	stream, err := portaudio.OpenStream(params, func(input []float32) {
+	stream, err := r.backend.OpenInput(config, func(input []float32) {
 		// Use independent copy instead of shared slice
 		sampleCopy := make([]float32, len(input))
 		copy(sampleCopy, input)
@@ -118,10 +107,13 @@ func (r *LoopbackRecorder) Start(deviceName string) error {
 		return fmt.Errorf("failed to open stream: %w", err)
 	}
 	r.stream = stream
+	r.SampleRate = int(selected.DefaultSampleRate)
+	r.Channels = selected.MaxInputChannels
 
 	// Start stream and check for errors
 	if err := r.stream.Start(); err != nil {
 		r.stream.Close()
+		r.stream = nil
 		return fmt.Errorf("failed to start stream: %w", err)
 	}
 
@@ -146,8 +138,7 @@ func (r *LoopbackRecorder) Stop() error {
 	if !r.isClosed {
 		close(r.Samples)
 		r.isClosed = true
+		r.backend.Terminate()
 	}
-
-	SafePortAudioTerminate()
 	return nil
 }
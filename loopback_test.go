@@ -2,87 +2,52 @@ package voxaudio
 
 import (
 	"fmt"
-	"os"
 	"testing"
 	"time"
 
-	"github.com/go-audio/audio"
-	"github.com/go-audio/wav"
+	"voxworld/wavfile"
 )
 
 func saveToWav(path string, samplesChan <-chan []float32, sampleRate, numChannels int) error {
-	// 1. Create output file
-	outFile, err := os.Create(path)
+	// 1. Create output file: 16-bit, PCM, multi-channel
+	writer, err := wavfile.Create(path, wavfile.Format{
+		SampleRate:   sampleRate,
+		Channels:     numChannels,
+		SampleFormat: wavfile.PCM16,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create WAV file: %w", err)
-	}
-	defer outFile.Close()
-
-	// 2. Initialize WAV encoder: 16-bit, PCM, multi-channel
-	encoder := wav.NewEncoder(outFile, sampleRate, 16, numChannels, 1) // PCM encoding mode
-	defer encoder.Close()
-
-	// Calculate total sample count to pre-allocate buffer
-	// A reasonable size to avoid frequent memory allocation
-	var samplesBuffer [][]float32
-	for raw := range samplesChan {
-		samplesBuffer = append(samplesBuffer, raw)
-	}
-
-	// Ensure all sample blocks are the same size to avoid jitter
-	bufferSize := 0
-	if len(samplesBuffer) > 0 {
-		// Use first sample block size as standard
-		bufferSize = len(samplesBuffer[0])
-	} else {
-		return fmt.Errorf("no audio samples received")
-	}
-
-	// Create uniformly sized PCM buffer
-	buf := &audio.IntBuffer{
-		Data:           make([]int, bufferSize),
-		Format:         &audio.Format{SampleRate: sampleRate, NumChannels: numChannels},
-		SourceBitDepth: 16,
+		return err
 	}
+	defer writer.Close()
 
 	// Apply slight smoothing to reduce potential noise and jitter
 	// Create a simple moving average filter
 	const smoothFactor = 0.2 // Smoothing factor, between 0-1, larger means more smoothing
 	var prevSample float32 = 0
 
-	for _, raw := range samplesBuffer {
-		// Ensure data doesn't overflow
-		processLength := len(raw)
-		if processLength > bufferSize {
-			processLength = bufferSize
-		}
+	var received bool
+	for raw := range samplesChan {
+		received = true
 
 		// Use simple moving average to smooth audio data
-		for i := 0; i < processLength; i++ {
-			// Apply smoothing
-			smoothed := raw[i]*(1-smoothFactor) + prevSample*smoothFactor
-			prevSample = smoothed
-
-			// Clipping
-			if smoothed > 1.0 {
-				smoothed = 1.0
-			} else if smoothed < -1.0 {
-				smoothed = -1.0
-			}
-
-			// Convert to 16-bit integer
-			buf.Data[i] = int(smoothed * 32767) // Scale to int16 range
+		smoothed := make([]float32, len(raw)-len(raw)%numChannels)
+		for i := range smoothed {
+			smoothed[i] = raw[i]*(1-smoothFactor) + prevSample*smoothFactor
+			prevSample = smoothed[i]
 		}
 
-		// Write to WAV file
-		if err := encoder.Write(buf); err != nil {
+		// Write to WAV file (the writer clips to [-1.0, 1.0])
+		if err := writer.WriteFloat32(smoothed); err != nil {
 			return fmt.Errorf("failed to write WAV data: %w", err)
 		}
 	}
+	if !received {
+		return fmt.Errorf("no audio samples received")
+	}
 
-	// 4. Complete and close encoder (updates file header)
-	if err := encoder.Close(); err != nil {
-		return fmt.Errorf("failed to close WAV encoder: %w", err)
+	// 2. Complete and close writer (updates file header)
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close WAV writer: %w", err)
 	}
 	return nil
 }
@@ -0,0 +1,170 @@
+package voxaudio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction of a data channel message
+const (
+	DirectionInbound  = "in"  // Server event
+	DirectionOutbound = "out" // Client event
+)
+
+// LoggedMessage is one line of a message log
+type LoggedMessage struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"dir"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Type returns the event type of the message
+func (m LoggedMessage) Type() string {
+	var evt struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(m.Data, &evt)
+	return evt.Type
+}
+
+// MessageLog writes the data channel traffic of a session as JSONL, one
+// LoggedMessage per line. The audio of input_audio_buffer.append events is
+// replaced by its size unless SetIncludeAudio is called.
+type MessageLog struct {
+	mu           sync.Mutex
+	w            io.Writer
+	closer       io.Closer
+	includeAudio bool
+	err          error
+}
+
+// CreateMessageLog creates the log file at path
+func CreateMessageLog(path string) (*MessageLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message log: %w", err)
+	}
+	log := NewMessageLog(file)
+	log.closer = file
+	return log, nil
+}
+
+// NewMessageLog returns a log that writes to w
+func NewMessageLog(w io.Writer) *MessageLog {
+	return &MessageLog{w: w}
+}
+
+// SetIncludeAudio keeps the uploaded audio in the log
+// Note: An hour of input audio takes about 230 MB
+func (l *MessageLog) SetIncludeAudio(include bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.includeAudio = include
+}
+
+// record appends a message; the first write error is kept and returned by Close
+func (l *MessageLog) record(direction string, data []byte, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+	if !l.includeAudio && direction == DirectionOutbound {
+		data = omitAudio(data)
+	}
+
+	msg := LoggedMessage{Time: at, Direction: direction, Data: data}
+	if !json.Valid(data) {
+		// Keep malformed messages as a JSON string
+		quoted, _ := json.Marshal(string(data))
+		msg.Data = quoted
+	}
+	line, err := json.Marshal(msg)
+	if err == nil {
+		_, err = l.w.Write(append(line, '\n'))
+	}
+	if err != nil {
+		l.err = fmt.Errorf("failed to write message log: %w", err)
+		fmt.Printf("[DataChannel] %v\n", l.err)
+	}
+}
+
+// omitAudio replaces the audio of an append event with its decoded size
+func omitAudio(data []byte) []byte {
+	if !bytes.Contains(data, []byte(`"input_audio_buffer.append"`)) {
+		return data
+	}
+	var evt struct {
+		Type  string `json:"type"`
+		Audio string `json:"audio"`
+	}
+	if json.Unmarshal(data, &evt) != nil || evt.Type != "input_audio_buffer.append" {
+		return data
+	}
+	padding := len(evt.Audio) - len(strings.TrimRight(evt.Audio, "="))
+	short, _ := json.Marshal(map[string]interface{}{
+		"type":        evt.Type,
+		"audio_bytes": base64.StdEncoding.DecodedLen(len(evt.Audio)) - padding,
+	})
+	return short
+}
+
+// Close closes the log file if it was created by CreateMessageLog
+func (l *MessageLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	if l.closer != nil {
+		if cerr := l.closer.Close(); err == nil {
+			err = cerr
+		}
+		l.closer = nil
+	}
+	return err
+}
+
+// SetMessageLog records the data channel traffic to log, nil stops recording
+func (s *Session) SetMessageLog(log *MessageLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messageLog = log
+}
+
+// ReadMessageLog parses a JSONL message log
+func ReadMessageLog(r io.Reader) ([]LoggedMessage, error) {
+	var messages []LoggedMessage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var msg LoggedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("invalid message log line %d: %w", line, err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read message log: %w", err)
+	}
+	return messages, nil
+}
+
+// LoadMessageLog reads the message log at path
+func LoadMessageLog(path string) ([]LoggedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open message log: %w", err)
+	}
+	defer file.Close()
+	return ReadMessageLog(file)
+}
@@ -0,0 +1,335 @@
+package voxaudio
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AudioSink receives 48 kHz mono audio, such as a wavfile.Writer, an
+// OggOpusEncoder created for 48 kHz mono or a DeviceSink
+type AudioSink interface {
+	WriteFloat32(samples []float32) error
+	Close() error
+}
+
+// VoiceOverOptions configures a VoiceOverMixer
+type VoiceOverOptions struct {
+	OriginalLevel    float64       // Gain of the original in dB while nothing is translated, default 0
+	DuckedLevel      float64       // Gain of the original in dB under the translation, default -18
+	TranslationLevel float64       // Gain of the translation in dB, default 0
+	Threshold        float64       // Translation level in dBFS that ducks the original, default -45
+	Attack           time.Duration // Time constant of ducking, default 80ms
+	Release          time.Duration // Time constant of the original returning, default 600ms
+	Hold             time.Duration // Pause in the translation before the original returns, default 400ms
+	MaxBuffered      time.Duration // Translation waiting to be mixed, older audio is dropped, default 2s
+}
+
+func (o VoiceOverOptions) withDefaults() VoiceOverOptions {
+	if o.DuckedLevel == 0 {
+		o.DuckedLevel = -18
+	}
+	if o.Threshold == 0 {
+		o.Threshold = -45
+	}
+	if o.Attack <= 0 {
+		o.Attack = 80 * time.Millisecond
+	}
+	if o.Release <= 0 {
+		o.Release = 600 * time.Millisecond
+	}
+	if o.Hold <= 0 {
+		o.Hold = 400 * time.Millisecond
+	}
+	if o.MaxBuffered <= 0 {
+		o.MaxBuffered = 2 * time.Second
+	}
+	return o
+}
+
+// VoiceOverMixer mixes the captured input under the decoded translation,
+// like a TV voice-over: the original is ducked while the translation plays
+// and returns in its pauses. The captured input drives the timing; the
+// translation is buffered until the input reaches it. The mix is written
+// to a sink as 48 kHz mono.
+type VoiceOverMixer struct {
+	sink AudioSink
+
+	mu              sync.Mutex
+	options         VoiceOverOptions
+	attack, release float64 // Smoothing coefficients of the ducking
+	hold            int     // Samples of the hold
+	detector        float64 // Short-term mean square of the translation
+	quiet           int     // Samples since the translation was above the threshold
+	gain            float64 // Current gain of the original in dB
+	format          AudioFormat
+	resampler       *linearResampler // Of the original to 48 kHz
+	translation     []float32
+	dropped         int64 // Translation samples dropped
+	closed          bool
+}
+
+// NewVoiceOverMixer returns a mixer writing to sink, which it closes on Close
+func NewVoiceOverMixer(sink AudioSink, options VoiceOverOptions) *VoiceOverMixer {
+	m := &VoiceOverMixer{sink: sink}
+	m.setOptions(options)
+	m.gain = m.options.OriginalLevel
+	m.quiet = m.hold
+	return m
+}
+
+// SetOptions changes the levels and timing while mixing
+func (m *VoiceOverMixer) SetOptions(options VoiceOverOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setOptions(options)
+}
+
+// setOptions applies options; m.mu must be held unless m is new
+func (m *VoiceOverMixer) setOptions(options VoiceOverOptions) {
+	m.options = options.withDefaults()
+	m.attack = smoothing(m.options.Attack, sampleRate)
+	m.release = smoothing(m.options.Release, sampleRate)
+	m.hold = int(m.options.Hold.Seconds() * sampleRate)
+}
+
+// Ducking returns the current gain of the original in dB
+func (m *VoiceOverMixer) Ducking() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gain
+}
+
+// Dropped returns the duration of translation dropped because the input fell behind
+func (m *VoiceOverMixer) Dropped() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Duration(m.dropped) * time.Second / sampleRate
+}
+
+// Translation queues decoded 48 kHz mono translation to be mixed
+func (m *VoiceOverMixer) Translation(samples []float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.translation = append(m.translation, samples...)
+	if limit := int(m.options.MaxBuffered.Seconds() * sampleRate); len(m.translation) > limit {
+		drop := len(m.translation) - limit
+		m.dropped += int64(drop)
+		m.translation = append(m.translation[:0], m.translation[drop:]...)
+	}
+}
+
+// Original mixes a frame of captured input with the queued translation and
+// writes the mix to the sink
+func (m *VoiceOverMixer) Original(frame Frame) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	if frame.Format.SampleRate <= 0 {
+		return fmt.Errorf("invalid original format: %d Hz", frame.Format.SampleRate)
+	}
+	if frame.Format != m.format {
+		m.format = frame.Format
+		m.resampler = newLinearResampler(frame.Format.SampleRate, sampleRate)
+	}
+	original := downmix(frame.Samples, max(frame.Format.Channels, 1))
+	if frame.Format.SampleRate != sampleRate {
+		original = m.resampler.process(original)
+	}
+	return m.sink.WriteFloat32(m.mix(original))
+}
+
+// mix returns the original ducked under as much translation as it is long
+func (m *VoiceOverMixer) mix(original []float32) []float32 {
+	const detectorTime = 10 * time.Millisecond
+	detector := smoothing(detectorTime, sampleRate)
+	translationGain := dbToGain(m.options.TranslationLevel)
+
+	out := make([]float32, len(original))
+	n := min(len(original), len(m.translation))
+	for i, sample := range original {
+		var translated float64
+		if i < n {
+			translated = float64(m.translation[i])
+		}
+
+		// Duck while the translation is above the threshold and through the hold
+		m.detector = detector*m.detector + (1-detector)*translated*translated
+		if decibels(m.detector) > m.options.Threshold {
+			m.quiet = 0
+		} else if m.quiet < m.hold {
+			m.quiet++
+		}
+		target := m.options.OriginalLevel
+		if m.quiet < m.hold {
+			target = m.options.DuckedLevel
+		}
+		coef := m.release
+		if target < m.gain {
+			coef = m.attack
+		}
+		m.gain = coef*m.gain + (1-coef)*target
+
+		mixed := float64(sample)*dbToGain(m.gain) + translated*translationGain
+		out[i] = float32(math.Max(-1, math.Min(1, mixed)))
+	}
+	m.translation = append(m.translation[:0], m.translation[n:]...)
+	return out
+}
+
+// Close writes the translation still queued and closes the sink
+func (m *VoiceOverMixer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	var err error
+	if len(m.translation) > 0 {
+		err = m.sink.WriteFloat32(m.mix(make([]float32, len(m.translation))))
+	}
+	if cerr := m.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// DeviceSink plays 48 kHz mono audio on an output device, such as a
+// virtual cable feeding a live stream
+type DeviceSink struct {
+	backend DeviceBackend
+	stream  DeviceStream
+
+	mu      sync.Mutex
+	pending []float32
+	closed  bool
+}
+
+// maxDevicePending bounds the audio waiting for the device (1 second)
+const maxDevicePending = sampleRate
+
+// NewDeviceSink opens the first output device whose name contains name,
+// empty for the first one, on backend; nil uses the backend set by SetDeviceBackend
+func NewDeviceSink(backend DeviceBackend, name string) (*DeviceSink, error) {
+	if backend == nil {
+		backend = currentDeviceBackend()
+	}
+	if err := backend.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize audio backend: %w", err)
+	}
+	devices, err := backend.Devices()
+	if err != nil {
+		backend.Terminate()
+		return nil, fmt.Errorf("failed to get audio devices: %w", err)
+	}
+	device, ok := findOutputDevice(devices, name)
+	if !ok {
+		backend.Terminate()
+		return nil, fmt.Errorf("no output device matching %q", name)
+	}
+
+	sink := &DeviceSink{backend: backend}
+	sink.stream, err = backend.OpenOutput(StreamConfig{
+		Device:          device,
+		Channels:        channels,
+		SampleRate:      float64(sampleRate),
+		FramesPerBuffer: frameSize,
+		Latency:         10 * time.Millisecond,
+	}, sink.fill)
+	if err != nil {
+		backend.Terminate()
+		return nil, fmt.Errorf("failed to open audio stream: %w", err)
+	}
+	if err := sink.stream.Start(); err != nil {
+		sink.stream.Close()
+		backend.Terminate()
+		return nil, fmt.Errorf("failed to start audio stream: %w", err)
+	}
+	fmt.Printf("[Audio] Playing the mix on %s\n", device.Name)
+	return sink, nil
+}
+
+// fill is the stream callback, playing silence when no audio is pending
+func (d *DeviceSink) fill(out []float32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := copy(out, d.pending)
+	clear(out[n:])
+	d.pending = append(d.pending[:0], d.pending[n:]...)
+}
+
+// WriteFloat32 queues samples for the device, dropping the oldest beyond a second
+func (d *DeviceSink) WriteFloat32(samples []float32) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return fmt.Errorf("device sink closed")
+	}
+	d.pending = append(d.pending, samples...)
+	if drop := len(d.pending) - maxDevicePending; drop > 0 {
+		d.pending = append(d.pending[:0], d.pending[drop:]...)
+	}
+	return nil
+}
+
+// Close stops the stream and releases the backend
+func (d *DeviceSink) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	err := d.stream.Stop()
+	if cerr := d.stream.Close(); err == nil {
+		err = cerr
+	}
+	d.backend.Terminate()
+	return err
+}
+
+// SetVoiceOver mixes the captured input under the translation with m, nil
+// disables. The session feeds it; closing it is left to the caller.
+func (s *Session) SetVoiceOver(m *VoiceOverMixer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.voiceOver = m
+}
+
+// voiceOverMixer returns the configured mixer, nil if none
+func (s *Session) voiceOverMixer() *VoiceOverMixer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.voiceOver
+}
+
+// mixOriginal passes captured input to the voice-over mixer
+func (s *Session) mixOriginal(frame Frame) {
+	if m := s.voiceOverMixer(); m != nil {
+		if err := m.Original(frame); err != nil {
+			fmt.Printf("[Audio] Failed to write voice-over mix: %v\n", err)
+		}
+	}
+}
+
+// mixTranslation passes decoded PCM16 translation to the voice-over mixer
+func (s *Session) mixTranslation(pcm []int16) {
+	m := s.voiceOverMixer()
+	if m == nil {
+		return
+	}
+	samples := make([]float32, len(pcm))
+	for i, v := range pcm {
+		samples[i] = float32(v) / 32767.0
+	}
+	m.Translation(samples)
+}
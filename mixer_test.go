@@ -0,0 +1,145 @@
+package voxaudio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink keeps the audio written to it
+type memorySink struct {
+	samples []float32
+	closed  bool
+}
+
+func (s *memorySink) WriteFloat32(samples []float32) error {
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// constant returns seconds of 48 kHz samples at value
+func constant(value float32, seconds float64) []float32 {
+	out := make([]float32, int(seconds*sampleRate))
+	for i := range out {
+		out[i] = value
+	}
+	return out
+}
+
+func TestVoiceOverDucking(t *testing.T) {
+	sink := &memorySink{}
+	m := NewVoiceOverMixer(sink, VoiceOverOptions{DuckedLevel: -20, Hold: 100 * time.Millisecond})
+
+	// The translation plays from 0.5s to 1.5s over a constant original
+	original := constant(0.5, 5)
+	translation := append(make([]float32, sampleRate/2), outputSine(440, 0.3, 0, 1)...)
+	m.Translation(translation)
+	for i := 0; i < len(original); i += frameSize {
+		require.NoError(t, m.Original(Frame{Samples: original[i : i+frameSize], Format: outputFormat}))
+	}
+	require.Len(t, sink.samples, len(original))
+
+	// Before: the original alone; during: ducked under the translation
+	assert.InDelta(t, 0.5, sink.samples[sampleRate/4], 1e-3)
+	during := sink.samples[sampleRate : sampleRate+sampleRate/10]
+	var ducked float64
+	for i, sample := range during {
+		ducked += float64(sample) - float64(translation[sampleRate+i])
+	}
+	assert.InDelta(t, 0.05, ducked/float64(len(during)), 5e-3)
+
+	// After the hold and release the original is back
+	assert.InDelta(t, 0.5, sink.samples[len(sink.samples)-1], 0.01)
+	assert.InDelta(t, 0, m.Ducking(), 0.2)
+}
+
+func TestVoiceOverAttackRelease(t *testing.T) {
+	sink := &memorySink{}
+	options := VoiceOverOptions{DuckedLevel: -20, Attack: 20 * time.Millisecond, Release: time.Second, Hold: 10 * time.Millisecond}
+	m := NewVoiceOverMixer(sink, options)
+	m.Translation(constant(0.1, 0.5))
+	require.NoError(t, m.Original(Frame{Samples: constant(0, 0.5), Format: outputFormat}))
+	assert.InDelta(t, -20, m.Ducking(), 0.5, "fast attack")
+
+	require.NoError(t, m.Original(Frame{Samples: constant(0, 0.3), Format: outputFormat}))
+	assert.Less(t, m.Ducking(), -10.0, "slow release")
+
+	// Levels change at runtime
+	options.Release = 10 * time.Millisecond
+	m.SetOptions(options)
+	require.NoError(t, m.Original(Frame{Samples: constant(0, 0.3), Format: outputFormat}))
+	assert.InDelta(t, 0, m.Ducking(), 0.1)
+}
+
+func TestVoiceOverFormatAndBuffering(t *testing.T) {
+	sink := &memorySink{}
+	m := NewVoiceOverMixer(sink, VoiceOverOptions{MaxBuffered: time.Second})
+
+	// 24 kHz stereo input becomes 48 kHz mono
+	stereo := make([]float32, 2*480)
+	require.NoError(t, m.Original(Frame{Samples: stereo, Format: AudioFormat{SampleRate: 24000, Channels: 2}}))
+	assert.InDelta(t, 960, len(sink.samples), 2)
+
+	// A frame without a sample rate is rejected instead of resampled
+	assert.Error(t, m.Original(Frame{Samples: stereo, Format: AudioFormat{Channels: 2}}))
+
+	// The oldest translation beyond the limit is dropped
+	m.Translation(constant(0.1, 1.5))
+	assert.Equal(t, 500*time.Millisecond, m.Dropped())
+
+	// Close writes the rest and closes the sink
+	written := len(sink.samples)
+	require.NoError(t, m.Close())
+	assert.True(t, sink.closed)
+	assert.Equal(t, sampleRate, len(sink.samples)-written)
+	m.Translation(constant(0.1, 0.1))
+	require.NoError(t, m.Original(Frame{Samples: constant(0, 0.1), Format: outputFormat}))
+	assert.Equal(t, written+sampleRate, len(sink.samples), "closed mixer ignores audio")
+}
+
+func TestDeviceSink(t *testing.T) {
+	backend := NewFakeBackend()
+	device := backend.AddOutput("Virtual Cable", sampleRate, 2)
+	_, err := NewDeviceSink(backend, "Missing")
+	require.Error(t, err)
+	assert.Equal(t, 0, backend.Users())
+
+	sink, err := NewDeviceSink(backend, "Virtual")
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteFloat32(constant(0.25, 0.02)))
+	require.Eventually(t, func() bool {
+		for _, sample := range device.Captured() {
+			if sample == 0.25 {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, sink.Close())
+	require.NoError(t, sink.Close())
+	assert.False(t, device.Running())
+	assert.Equal(t, 0, backend.Users())
+	assert.Error(t, sink.WriteFloat32([]float32{0}))
+}
+
+func TestSessionVoiceOver(t *testing.T) {
+	s := &Session{}
+	s.mixTranslation([]int16{100})
+	s.mixOriginal(Frame{Samples: []float32{0}, Format: outputFormat})
+
+	sink := &memorySink{}
+	s.SetVoiceOver(NewVoiceOverMixer(sink, VoiceOverOptions{}))
+	s.mixTranslation([]int16{16384, 16384})
+	s.mixOriginal(Frame{Samples: []float32{0, 0, 0}, Format: outputFormat})
+	require.Len(t, sink.samples, 3)
+	assert.InDelta(t, 0.5, sink.samples[0], 1e-3)
+	assert.Zero(t, sink.samples[2])
+}
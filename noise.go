@@ -0,0 +1,245 @@
+package voxaudio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// NoiseSuppressor removes background noise from the captured audio before
+// it is uploaded. Frames are 24 kHz mono.
+type NoiseSuppressor interface {
+	// Process returns the denoised samples, as many as the frame holds
+	Processor
+	// SetBypass passes the audio through unchanged while enabled
+	SetBypass(bypass bool)
+	// Reduction returns the energy removed over the last second, in dB
+	Reduction() float64
+}
+
+// noiseSuppressors are the available suppressors by name
+var noiseSuppressors = map[string]func() (NoiseSuppressor, error){
+	"spectral": func() (NoiseSuppressor, error) { return NewSpectralSubtractor(SpectralOptions{}), nil },
+}
+
+// NewNoiseSuppressor returns a suppressor by name: "spectral", or "rnnoise"
+// when built with the rnnoise tag
+func NewNoiseSuppressor(name string) (NoiseSuppressor, error) {
+	newSuppressor, ok := noiseSuppressors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown noise suppressor %q, available: %v", name, NoiseSuppressors())
+	}
+	return newSuppressor()
+}
+
+// NoiseSuppressors returns the names of the available suppressors
+func NoiseSuppressors() []string {
+	names := make([]string, 0, len(noiseSuppressors))
+	for name := range noiseSuppressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetNoiseSuppressor runs the captured audio through ns before upload, nil disables
+// Note: ns is the StageNoise stage of Processors
+func (s *Session) SetNoiseSuppressor(ns NoiseSuppressor) {
+	if ns == nil {
+		s.setStage(StageNoise, nil)
+		return
+	}
+	s.setStage(StageNoise, ns)
+}
+
+// noiseReduction returns the reduction of the configured suppressor
+func (s *Session) noiseReduction() (float64, bool) {
+	ns, ok := stageOf[NoiseSuppressor](s, StageNoise)
+	if !ok {
+		return 0, false
+	}
+	return ns.Reduction(), true
+}
+
+// SpectralOptions configures a SpectralSubtractor
+type SpectralOptions struct {
+	OverSubtraction float64 // Multiple of the noise estimate removed, default 2
+	Floor           float64 // Lowest gain of a frequency bin, default 0.1 (-20 dB)
+	LearnFrames     int     // Frames averaged into the first noise estimate, default 10
+}
+
+func (o SpectralOptions) withDefaults() SpectralOptions {
+	if o.OverSubtraction <= 0 {
+		o.OverSubtraction = 2
+	}
+	if o.Floor <= 0 {
+		o.Floor = 0.1
+	}
+	if o.LearnFrames <= 0 {
+		o.LearnFrames = 10
+	}
+	return o
+}
+
+const (
+	spectralSize = 512              // FFT size, about 21ms at 24 kHz
+	spectralHop  = spectralSize / 2 // 50% overlap
+)
+
+// SpectralSubtractor suppresses stationary noise by subtracting a running
+// estimate of the noise spectrum from each frame.
+// Note: Delays the audio by spectralSize samples
+type SpectralSubtractor struct {
+	options SpectralOptions
+	window  []float64 // Square root Hann, applied before and after the FFT
+
+	mu       sync.Mutex
+	bypass   bool
+	input    []float32 // Samples not yet in a full frame, with the previous hop
+	output   []float32 // Overlap-add of the processed frames
+	ready    []float32 // Finished samples not yet returned
+	noise    []float64 // Noise power by bin
+	frames   int       // Frames seen
+	inPower  float64   // Decaying energy of the input
+	outPower float64   // Decaying energy of the output
+}
+
+// NewSpectralSubtractor returns a spectral subtraction suppressor
+func NewSpectralSubtractor(options SpectralOptions) *SpectralSubtractor {
+	window := make([]float64, spectralSize)
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/spectralSize))
+	}
+	return &SpectralSubtractor{
+		options: options.withDefaults(),
+		window:  window,
+		input:   make([]float32, spectralHop),
+		output:  make([]float32, spectralSize),
+		ready:   make([]float32, spectralSize-spectralHop),
+		noise:   make([]float64, spectralSize/2+1),
+	}
+}
+
+func (ss *SpectralSubtractor) SetBypass(bypass bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.bypass = bypass
+}
+
+func (ss *SpectralSubtractor) Reduction() float64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.inPower == 0 || ss.outPower == 0 {
+		return 0
+	}
+	return 10 * math.Log10(ss.inPower/ss.outPower)
+}
+
+func (ss *SpectralSubtractor) Process(frame Frame) []float32 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	samples := frame.Samples
+	ss.input = append(ss.input, samples...)
+	for len(ss.input) >= spectralSize {
+		ss.processFrame(ss.input[:spectralSize])
+		ss.input = ss.input[spectralHop:]
+	}
+	ss.input = slices.Clip(ss.input)
+
+	out := make([]float32, len(samples))
+	ss.ready = ss.ready[copy(out, ss.ready):]
+	return out
+}
+
+// processFrame denoises one frame and appends a finished hop to ready
+func (ss *SpectralSubtractor) processFrame(frame []float32) {
+	spectrum := make([]complex128, spectralSize)
+	for i, sample := range frame {
+		spectrum[i] = complex(float64(sample)*ss.window[i], 0)
+	}
+	fft(spectrum, false)
+
+	// Keep a running noise estimate from the bins that look like noise; it
+	// creeps up elsewhere so a louder background is eventually learned
+	ss.frames++
+	for k := range ss.noise {
+		power := real(spectrum[k])*real(spectrum[k]) + imag(spectrum[k])*imag(spectrum[k])
+		switch {
+		case ss.frames <= ss.options.LearnFrames:
+			ss.noise[k] += (power - ss.noise[k]) / float64(ss.frames)
+		case power < 4*ss.noise[k]:
+			ss.noise[k] = 0.95*ss.noise[k] + 0.05*power
+		default:
+			ss.noise[k] *= 1.001
+		}
+		if ss.bypass {
+			continue
+		}
+		gain := ss.options.Floor
+		if power > 0 {
+			gain = math.Max(math.Sqrt(math.Max(1-ss.options.OverSubtraction*ss.noise[k]/power, 0)), ss.options.Floor)
+		}
+		spectrum[k] *= complex(gain, 0)
+		if k > 0 && k < spectralSize/2 {
+			spectrum[spectralSize-k] = cmplx.Conj(spectrum[k])
+		}
+	}
+	fft(spectrum, true)
+
+	// Overlap-add, the first hop is then complete
+	for i := range ss.output {
+		ss.output[i] += float32(real(spectrum[i]) * ss.window[i])
+	}
+	done := ss.output[:spectralHop]
+	ss.ready = append(ss.ready, done...)
+	ss.output = append(ss.output[spectralHop:], make([]float32, spectralHop)...)
+
+	// Measure over about a second of audio
+	var in, out float64
+	for i := 0; i < spectralHop; i++ {
+		in += float64(frame[i]) * float64(frame[i])
+		out += float64(done[i]) * float64(done[i])
+	}
+	const decay = 1 - float64(spectralHop)/inputSampleRate
+	ss.inPower = ss.inPower*decay + in
+	ss.outPower = ss.outPower*decay + out
+}
+
+// fft transforms x in place with an iterative radix-2 FFT; len(x) must be a
+// power of two. The inverse transform is scaled by 1/len(x).
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
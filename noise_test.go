@@ -0,0 +1,99 @@
+package voxaudio
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, 64)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*5*float64(i)/64), 0)
+	}
+	orig := append([]complex128(nil), x...)
+	fft(x, false)
+	assert.InDelta(t, 32, cmplx.Abs(x[5]), 1e-9)
+	assert.InDelta(t, 32, cmplx.Abs(x[59]), 1e-9)
+	assert.InDelta(t, 0, cmplx.Abs(x[6]), 1e-9)
+
+	fft(x, true)
+	for i := range x {
+		assert.InDelta(t, real(orig[i]), real(x[i]), 1e-9)
+	}
+}
+
+// suppressChunks runs in through ns in 10ms chunks
+func suppressChunks(ns NoiseSuppressor, in []float32) []float32 {
+	var out []float32
+	for len(in) > 0 {
+		n := min(240, len(in))
+		out = append(out, ns.Process(Frame{Samples: in[:n], Format: uploadFormat})...)
+		in = in[n:]
+	}
+	return out
+}
+
+func rmsOf(samples []float32) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestSpectralSubtractorBypass(t *testing.T) {
+	ss := NewSpectralSubtractor(SpectralOptions{})
+	ss.SetBypass(true)
+	rng := rand.New(rand.NewSource(1))
+	in := make([]float32, inputSampleRate/2)
+	for i := range in {
+		in[i] = float32(rng.Float64()*2-1) * 0.3
+	}
+
+	// Passed through unchanged, after the delay of one frame
+	out := suppressChunks(ss, in)
+	require.Len(t, out, len(in))
+	for i := spectralSize; i < len(out); i++ {
+		require.InDelta(t, in[i-spectralSize], out[i], 1e-5, "sample %d", i)
+	}
+	assert.InDelta(t, 0, ss.Reduction(), 0.01)
+}
+
+func TestSpectralSubtractorReducesNoise(t *testing.T) {
+	ss := NewSpectralSubtractor(SpectralOptions{})
+	rng := rand.New(rand.NewSource(1))
+
+	// A second of noise, then a tone over the same noise
+	in := make([]float32, 2*inputSampleRate)
+	for i := range in {
+		in[i] = float32(rng.NormFloat64() * 0.02)
+		if i >= inputSampleRate {
+			in[i] += float32(0.3 * math.Sin(2*math.Pi*1000*float64(i)/inputSampleRate))
+		}
+	}
+	out := suppressChunks(ss, in)
+	require.Len(t, out, len(in))
+
+	noiseIn := rmsOf(in[inputSampleRate/2 : inputSampleRate])
+	noiseOut := rmsOf(out[inputSampleRate/2+spectralSize : inputSampleRate])
+	assert.Greater(t, 20*math.Log10(noiseIn/noiseOut), 6.0, "noise reduced")
+
+	toneIn := rmsOf(in[3*inputSampleRate/2:])
+	toneOut := rmsOf(out[3*inputSampleRate/2+spectralSize:])
+	assert.InDelta(t, 0, 20*math.Log10(toneIn/toneOut), 1, "speech band kept")
+	assert.Greater(t, ss.Reduction(), 0.0)
+}
+
+func TestNewNoiseSuppressor(t *testing.T) {
+	ns, err := NewNoiseSuppressor("spectral")
+	require.NoError(t, err)
+	assert.IsType(t, &SpectralSubtractor{}, ns)
+	_, err = NewNoiseSuppressor("bogus")
+	assert.ErrorContains(t, err, "spectral")
+	assert.Contains(t, NoiseSuppressors(), "spectral")
+}
@@ -0,0 +1,337 @@
+package voxaudio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// outputFormat is the format of the decoded remote audio
+var outputFormat = AudioFormat{SampleRate: sampleRate, Channels: channels}
+
+// NormalizerOptions configures a LoudnessNormalizer
+type NormalizerOptions struct {
+	Target    float64       // Short-term loudness aimed for in LUFS, default -23 (EBU R128)
+	MaxGain   float64       // Highest gain in dB, default 20
+	MinGain   float64       // Lowest gain in dB, default -20
+	Smoothing time.Duration // Time constant of gain changes, default 1s
+	Gate      float64       // 100ms blocks below this loudness are silence and left out, default -50
+	Ceiling   float64       // True peak limit in dBTP, default -1
+	Lookahead time.Duration // How far ahead the limiter reduces the gain, default 5ms
+	Release   time.Duration // Time constant of the limiter recovering, default 100ms
+}
+
+func (o NormalizerOptions) withDefaults() NormalizerOptions {
+	if o.Target == 0 {
+		o.Target = -23
+	}
+	if o.MaxGain == 0 {
+		o.MaxGain = 20
+	}
+	if o.MinGain == 0 {
+		o.MinGain = -20
+	}
+	if o.Smoothing <= 0 {
+		o.Smoothing = time.Second
+	}
+	if o.Gate == 0 {
+		o.Gate = -50
+	}
+	if o.Ceiling == 0 {
+		o.Ceiling = -1
+	}
+	if o.Lookahead <= 0 {
+		o.Lookahead = 5 * time.Millisecond
+	}
+	if o.Release <= 0 {
+		o.Release = 100 * time.Millisecond
+	}
+	return o
+}
+
+const (
+	loudnessBlock  = 100 * time.Millisecond // Measurement block
+	shortTermTime  = 3 * time.Second        // EBU R128 short-term window
+	shortTermCount = int(shortTermTime / loudnessBlock)
+)
+
+// LoudnessNormalizer brings the translated audio to a target EBU R128
+// short-term loudness, so voices and responses play at the same level, and
+// keeps the true peak below a ceiling. Frames are mono at any sample rate.
+// Note: The limiter delays the audio by the lookahead
+type LoudnessNormalizer struct {
+	options NormalizerOptions
+
+	mu        sync.Mutex
+	rate      int
+	smoothing float64 // Gain smoothing coefficient at rate
+	weighting *kWeighting
+	blockSize int
+	block     float64   // Sum of squares of the current block
+	blockFill int       // Samples in the current block
+	blocks    []float64 // Mean squares of the blocks of the window, 0 when gated
+	next      int       // Oldest block
+	shortTerm float64   // Loudness of the window in LUFS
+	target    float64   // Gain reaching the target in dB
+	gain      float64   // Current gain in dB
+	limiter   *truePeakLimiter
+	bypass    bool
+}
+
+// NewLoudnessNormalizer returns a normalizer starting at unity gain
+func NewLoudnessNormalizer(options NormalizerOptions) *LoudnessNormalizer {
+	n := &LoudnessNormalizer{
+		options:   options.withDefaults(),
+		blocks:    make([]float64, shortTermCount),
+		shortTerm: math.Inf(-1),
+	}
+	n.configure(sampleRate)
+	return n
+}
+
+// configure sets up the measurement and limiter for a sample rate; n.mu
+// must be held unless n is new
+func (n *LoudnessNormalizer) configure(rate int) {
+	n.rate = rate
+	n.smoothing = smoothing(n.options.Smoothing, rate)
+	n.weighting = newKWeighting(rate)
+	n.blockSize = int(int64(rate) * int64(loudnessBlock) / int64(time.Second))
+	n.block, n.blockFill = 0, 0
+	n.limiter = newTruePeakLimiter(rate, dbToGain(n.options.Ceiling), n.options.Lookahead, n.options.Release)
+}
+
+// SetTarget changes the target loudness in LUFS
+func (n *LoudnessNormalizer) SetTarget(target float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.options.Target = target
+	n.updateTarget()
+}
+
+// SetBypass passes the audio through unchanged while enabled; the loudness is still measured
+func (n *LoudnessNormalizer) SetBypass(bypass bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.bypass = bypass
+}
+
+// Loudness returns the short-term loudness of the input in LUFS, leaving out silence
+func (n *LoudnessNormalizer) Loudness() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.shortTerm
+}
+
+// Gain returns the current gain in dB, before limiting
+func (n *LoudnessNormalizer) Gain() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.gain
+}
+
+// Process returns the samples of a frame brought to the target loudness
+func (n *LoudnessNormalizer) Process(frame Frame) []float32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if rate := frame.Format.SampleRate; rate > 0 && rate != n.rate {
+		n.configure(rate)
+	}
+	out := make([]float32, len(frame.Samples))
+	for i, sample := range frame.Samples {
+		x := float64(sample)
+		weighted := n.weighting.process(x)
+		n.block += weighted * weighted
+		if n.blockFill++; n.blockFill == n.blockSize {
+			n.endBlock()
+		}
+		n.gain = n.smoothing*n.gain + (1-n.smoothing)*n.target
+		if n.bypass {
+			out[i] = sample
+			continue
+		}
+		out[i] = float32(n.limiter.process(x * dbToGain(n.gain)))
+	}
+	return out
+}
+
+// endBlock adds the finished block to the short-term window
+func (n *LoudnessNormalizer) endBlock() {
+	meanSquare := n.block / float64(n.blockSize)
+	n.block, n.blockFill = 0, 0
+	if loudness(meanSquare) < n.options.Gate {
+		meanSquare = 0
+	}
+	n.blocks[n.next] = meanSquare
+	n.next = (n.next + 1) % len(n.blocks)
+
+	// Silence holds the measurement and the gain
+	var sum float64
+	var count int
+	for _, block := range n.blocks {
+		if block > 0 {
+			sum += block
+			count++
+		}
+	}
+	if count == 0 {
+		return
+	}
+	n.shortTerm = loudness(sum / float64(count))
+	n.updateTarget()
+}
+
+// updateTarget sets the gain reaching the target from the measured loudness
+func (n *LoudnessNormalizer) updateTarget() {
+	if math.IsInf(n.shortTerm, -1) {
+		return
+	}
+	n.target = math.Max(n.options.MinGain, math.Min(n.options.MaxGain, n.options.Target-n.shortTerm))
+}
+
+const (
+	truePeakOversample = 4  // ITU-R BS.1770 true peak oversampling
+	truePeakTaps       = 12 // Interpolation taps per phase
+)
+
+// truePeakPhases are the windowed sinc interpolators of the positions
+// between two samples
+var truePeakPhases = func() [truePeakOversample - 1][truePeakTaps]float64 {
+	var phases [truePeakOversample - 1][truePeakTaps]float64
+	half := truePeakTaps / 2
+	for k := range phases {
+		frac := float64(k+1) / truePeakOversample
+		var sum float64
+		for j := range phases[k] {
+			u := frac - float64(j-half+1)
+			c := 1.0
+			if u != 0 {
+				c = math.Sin(math.Pi*u) / (math.Pi * u)
+			}
+			c *= 0.5 * (1 + math.Cos(math.Pi*u/float64(half)))
+			phases[k][j] = c
+			sum += c
+		}
+		for j := range phases[k] {
+			phases[k][j] /= sum
+		}
+	}
+	return phases
+}()
+
+// truePeakLimiter keeps the true peak, including the peaks between
+// samples, below a ceiling. The gain falls over the lookahead so it
+// reaches the required reduction at the peak, and recovers with the release.
+type truePeakLimiter struct {
+	ceiling float64
+	release float64 // Smoothing coefficient of increases
+
+	history   [truePeakTaps]float64 // Newest input samples
+	lookahead int
+	minima    []lookaheadGain // Increasing required gains of the lookahead
+	position  int64
+	averaged  []float64 // Minimum gains of the lookahead, averaged to ramp down
+	sum       float64
+	slot      int
+	envelope  float64
+	line      []float64 // Samples waiting for their gain
+	linePos   int
+}
+
+type lookaheadGain struct {
+	position int64
+	gain     float64
+}
+
+func newTruePeakLimiter(rate int, ceiling float64, lookahead, release time.Duration) *truePeakLimiter {
+	n := max(int(int64(rate)*int64(lookahead)/int64(time.Second)), 1)
+	l := &truePeakLimiter{
+		ceiling:   ceiling,
+		release:   smoothing(release, rate),
+		lookahead: n,
+		averaged:  make([]float64, n),
+		sum:       float64(n),
+		envelope:  1,
+		line:      make([]float64, truePeakTaps/2+n-1),
+	}
+	for i := range l.averaged {
+		l.averaged[i] = 1
+	}
+	return l
+}
+
+// delay returns the latency of the limiter in samples
+func (l *truePeakLimiter) delay() int {
+	return len(l.line)
+}
+
+// truePeak returns the highest absolute value at and after the sample
+// half the taps ago, up to the next sample
+func (l *truePeakLimiter) truePeak() float64 {
+	peak := math.Abs(l.history[truePeakTaps/2-1])
+	for _, phase := range truePeakPhases {
+		var y float64
+		for j, c := range phase {
+			y += c * l.history[j]
+		}
+		peak = math.Max(peak, math.Abs(y))
+	}
+	return peak
+}
+
+// process takes a sample and returns the limited sample the delay ago
+func (l *truePeakLimiter) process(x float64) float64 {
+	copy(l.history[:], l.history[1:])
+	l.history[truePeakTaps-1] = x
+
+	// The gain the sample needs, as the minimum over the lookahead
+	required := 1.0
+	if peak := l.truePeak(); peak > l.ceiling {
+		required = l.ceiling / peak
+	}
+	for len(l.minima) > 0 && l.minima[len(l.minima)-1].gain >= required {
+		l.minima = l.minima[:len(l.minima)-1]
+	}
+	l.minima = append(l.minima, lookaheadGain{l.position, required})
+	if l.minima[0].position <= l.position-int64(l.lookahead) {
+		l.minima = l.minima[1:]
+	}
+	l.position++
+
+	// Ramp down over the lookahead, recover with the release
+	l.sum += l.minima[0].gain - l.averaged[l.slot]
+	l.averaged[l.slot] = l.minima[0].gain
+	l.slot = (l.slot + 1) % len(l.averaged)
+	gain := math.Min(l.sum/float64(len(l.averaged)), 1)
+	if gain < l.envelope {
+		l.envelope = gain
+	} else {
+		l.envelope = l.release*l.envelope + (1-l.release)*gain
+	}
+
+	if len(l.line) == 0 {
+		return x * l.envelope
+	}
+	delayed := l.line[l.linePos]
+	l.line[l.linePos] = x
+	l.linePos = (l.linePos + 1) % len(l.line)
+	return delayed * l.envelope
+}
+
+// SetLoudnessNormalizer normalizes the translated audio with n before it
+// reaches the speaker, BlackHole or the recording, nil disables
+// Note: n is the StageLoudness stage of OutputProcessors. With an output stage
+// set before the track starts, RecordOggOpus encodes the processed audio
+// instead of remuxing the packets; packet sinks receive the undecoded audio
+func (s *Session) SetLoudnessNormalizer(n *LoudnessNormalizer) {
+	if n == nil {
+		s.setOutputStage(StageLoudness, nil)
+		return
+	}
+	s.setOutputStage(StageLoudness, n)
+}
+
+// loudnessNormalizer returns the configured normalizer, nil if none
+func (s *Session) loudnessNormalizer() *LoudnessNormalizer {
+	n, _ := s.OutputProcessors().Get(StageLoudness).(*LoudnessNormalizer)
+	return n
+}
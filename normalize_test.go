@@ -0,0 +1,169 @@
+package voxaudio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outputSine returns seconds of a sine wave at 48 kHz
+func outputSine(freq, amplitude, phase, seconds float64) []float32 {
+	out := make([]float32, int(seconds*sampleRate))
+	for i := range out {
+		out[i] = float32(amplitude * math.Sin(2*math.Pi*freq*float64(i)/sampleRate+phase))
+	}
+	return out
+}
+
+func normalizeFrames(n *LoudnessNormalizer, in []float32) []float32 {
+	var out []float32
+	for len(in) > 0 {
+		size := min(frameSize, len(in))
+		out = append(out, n.Process(Frame{Samples: in[:size], Format: outputFormat})...)
+		in = in[size:]
+	}
+	return out
+}
+
+// measureLoudness returns the loudness of samples at 48 kHz in LUFS
+func measureLoudness(samples []float32) float64 {
+	k := newKWeighting(sampleRate)
+	var sum float64
+	for _, sample := range samples {
+		y := k.process(float64(sample))
+		sum += y * y
+	}
+	return loudness(sum / float64(len(samples)))
+}
+
+// oversampledPeak estimates the true peak by 16x sinc interpolation
+func oversampledPeak(samples []float32) float64 {
+	var peak float64
+	for i := 32; i < len(samples)-32; i++ {
+		for k := 0; k < 16; k++ {
+			t := float64(i) + float64(k)/16
+			var y float64
+			for j := i - 32; j <= i+32; j++ {
+				u := t - float64(j)
+				c := 1.0
+				if u != 0 {
+					c = math.Sin(math.Pi*u) / (math.Pi * u)
+				}
+				y += c * float64(samples[j])
+			}
+			peak = math.Max(peak, math.Abs(y))
+		}
+	}
+	return peak
+}
+
+func TestLoudnessNormalizerReachesTarget(t *testing.T) {
+	n := NewLoudnessNormalizer(NormalizerOptions{Target: -23})
+
+	// A quiet voice, a pause, then a loud one
+	in := outputSine(440, 0.02, 0, 10)
+	in = append(in, make([]float32, sampleRate)...)
+	in = append(in, outputSine(440, 0.5, 0, 10)...)
+	out := normalizeFrames(n, in)
+
+	quiet := out[8*sampleRate : 10*sampleRate]
+	assert.InDelta(t, -23, measureLoudness(quiet), 1)
+	loud := out[len(out)-2*sampleRate:]
+	assert.InDelta(t, -23, measureLoudness(loud), 1)
+	assert.InDelta(t, -23, measureLoudness(in[len(in)-sampleRate:])+n.Gain(), 0.5)
+	assert.InDelta(t, measureLoudness(in[len(in)-sampleRate:]), n.Loudness(), 0.5)
+
+	// Silence holds the measurement and the gain
+	level, gain := n.Loudness(), n.Gain()
+	normalizeFrames(n, make([]float32, 2*sampleRate))
+	assert.InDelta(t, level, n.Loudness(), 0.5)
+	assert.InDelta(t, gain, n.Gain(), 0.5)
+
+	n.SetBypass(true)
+	tone := outputSine(440, 0.5, 0, 0.1)
+	assert.Equal(t, tone, normalizeFrames(n, tone))
+}
+
+func TestLoudnessNormalizerSetTarget(t *testing.T) {
+	n := NewLoudnessNormalizer(NormalizerOptions{Target: -23})
+	normalizeFrames(n, outputSine(440, 0.05, 0, 6))
+	n.SetTarget(-16)
+	out := normalizeFrames(n, outputSine(440, 0.05, 0, 10))
+	assert.InDelta(t, -16, measureLoudness(out[len(out)-sampleRate:]), 1)
+}
+
+func TestTruePeakLimiter(t *testing.T) {
+	// A quarter sample rate sine between the samples: every sample is at
+	// -3 dBFS but the true peak is 0 dBTP
+	in := outputSine(sampleRate/4, 1, math.Pi/4, 0.5)
+	l := newTruePeakLimiter(sampleRate, dbToGain(-1), 5*time.Millisecond, 100*time.Millisecond)
+	out := make([]float32, len(in))
+	for i, sample := range in {
+		out[i] = float32(l.process(float64(sample)))
+	}
+	require.Greater(t, l.delay(), 0)
+	settled := out[sampleRate/10:]
+	assert.InDelta(t, -1, 20*math.Log10(oversampledPeak(settled)), 0.3)
+}
+
+func TestTruePeakLimiterBurst(t *testing.T) {
+	// A loud burst after a quiet passage is caught by the lookahead
+	in := append(outputSine(1000, 0.05, 0, 0.2), outputSine(3000, 1.5, 0.3, 0.2)...)
+	l := newTruePeakLimiter(sampleRate, dbToGain(-1), 5*time.Millisecond, 100*time.Millisecond)
+	out := make([]float32, len(in))
+	for i, sample := range in {
+		out[i] = float32(l.process(float64(sample)))
+	}
+	assert.LessOrEqual(t, 20*math.Log10(oversampledPeak(out)), -0.9)
+
+	// The quiet passage is untouched, only delayed
+	d := l.delay()
+	for i := d; i < sampleRate/10; i++ {
+		assert.InDelta(t, in[i-d], out[i], 1e-6)
+	}
+}
+
+func TestSessionOutputStages(t *testing.T) {
+	s := &Session{}
+	pcm := []int16{1000, -2000, 3000}
+	s.processOutput(pcm)
+	assert.Equal(t, []int16{1000, -2000, 3000}, pcm, "no stages, unchanged")
+
+	s.OutputProcessors().Add("custom", &scaleProcessor{factor: 2})
+	s.SetLoudnessNormalizer(NewLoudnessNormalizer(NormalizerOptions{}))
+	assert.Equal(t, []string{StageLoudness, "custom"}, s.OutputProcessors().Names())
+	assert.NotNil(t, s.loudnessNormalizer())
+
+	s.SetLoudnessNormalizer(nil)
+	s.processOutput(pcm)
+	assert.Equal(t, []int16{2000, -4000, 6000}, pcm)
+	assert.Nil(t, s.loudnessNormalizer())
+}
+
+// resizeProcessor returns n times as many samples as it is given
+type resizeProcessor float64
+
+func (p resizeProcessor) Process(frame Frame) []float32 {
+	out := make([]float32, int(float64(len(frame.Samples))*float64(p)))
+	for i := range out {
+		out[i] = 0.5
+	}
+	return out
+}
+
+func TestSessionOutputStagesLength(t *testing.T) {
+	s := &Session{}
+	s.OutputProcessors().Add("longer", resizeProcessor(2))
+	pcm := []int16{1000, -2000, 3000, -4000}
+	require.NotPanics(t, func() { s.processOutput(pcm) })
+	assert.Equal(t, []int16{16383, 16383, 16383, 16383}, pcm)
+
+	s.OutputProcessors().Remove("longer")
+	s.OutputProcessors().Add("shorter", resizeProcessor(0.5))
+	pcm = []int16{1000, -2000, 3000, -4000}
+	s.processOutput(pcm)
+	assert.Equal(t, []int16{16383, 16383, 3000, -4000}, pcm)
+}
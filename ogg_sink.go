@@ -0,0 +1,163 @@
+package voxaudio
+
+import (
+	"fmt"
+
+	"github.com/hraban/opus"
+	"github.com/pion/rtp"
+
+	"voxworld/oggopus"
+)
+
+// RecordFormat selects how the translated audio is saved to disk
+type RecordFormat int
+
+const (
+	RecordWAV     RecordFormat = iota // Decoded 16-bit PCM in a WAV file (default)
+	RecordOggOpus                     // Opus packets remuxed into an Ogg file, re-encoded if the output is processed
+	RecordNone                        // Do not save the translated audio
+)
+
+// maxGapSamples bounds the silence inserted for an RTP timestamp jump (10 minutes);
+// larger jumps are treated as a timestamp reset
+const maxGapSamples = 10 * 60 * sampleRate
+
+// PacketSink receives the undecoded Opus packets of the remote audio track
+type PacketSink interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// OggOpusSink remuxes RTP Opus packets into an Ogg Opus file without re-encoding.
+// Gaps in the RTP timestamps are filled with silence so the file keeps the
+// timing of the session.
+type OggOpusSink struct {
+	writer        *oggopus.Writer
+	nextTimestamp uint32
+	started       bool
+}
+
+// NewOggOpusSink creates the Ogg Opus file at path
+func NewOggOpusSink(path string) (*OggOpusSink, error) {
+	writer, err := oggopus.Create(path, sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+	return &OggOpusSink{writer: writer}, nil
+}
+
+// WriteRTP appends the Opus payload of packet to the file
+func (s *OggOpusSink) WriteRTP(packet *rtp.Packet) error {
+	if len(packet.Payload) == 0 {
+		return nil
+	}
+	samples, err := oggopus.PacketDuration(packet.Payload)
+	if err != nil {
+		return err
+	}
+
+	if s.started {
+		gap := int32(packet.Timestamp - s.nextTimestamp)
+		if gap < 0 {
+			return nil // Duplicate or reordered packet
+		}
+		if gap <= maxGapSamples {
+			for ; gap >= oggopus.SilenceSamples; gap -= oggopus.SilenceSamples {
+				if err := s.writer.WritePacket(oggopus.SilencePacket); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	s.started = true
+	s.nextTimestamp = packet.Timestamp + uint32(samples)
+	return s.writer.WritePacket(packet.Payload)
+}
+
+// Seconds returns the duration of the audio written so far
+func (s *OggOpusSink) Seconds() float64 {
+	return s.writer.Duration().Seconds()
+}
+
+// Close finishes the Ogg stream and closes the file
+func (s *OggOpusSink) Close() error {
+	return s.writer.Close()
+}
+
+// OggOpusEncoder encodes captured PCM audio into an Ogg Opus file.
+// Input of any rate and channel count is mixed down to 48 kHz mono.
+type OggOpusEncoder struct {
+	writer    *oggopus.Writer
+	encoder   *opus.Encoder
+	resampler *linearResampler
+	channels  int
+	pending   []float32 // 48 kHz mono samples not yet encoded
+	packet    []byte
+}
+
+// NewOggOpusEncoder creates the Ogg Opus file at path for audio captured at
+// inputRate with inputChannels interleaved channels
+func NewOggOpusEncoder(path string, inputRate, inputChannels int) (*OggOpusEncoder, error) {
+	if inputRate <= 0 || inputChannels <= 0 {
+		return nil, fmt.Errorf("invalid input format: %d Hz, %d channels", inputRate, inputChannels)
+	}
+	encoder, err := opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Opus encoder: %w", err)
+	}
+	writer, err := oggopus.Create(path, inputRate, channels)
+	if err != nil {
+		return nil, err
+	}
+	return &OggOpusEncoder{
+		writer:    writer,
+		encoder:   encoder,
+		resampler: newLinearResampler(inputRate, sampleRate),
+		channels:  inputChannels,
+		packet:    make([]byte, maxDataBytes),
+	}, nil
+}
+
+// WriteFloat32 encodes interleaved samples as complete 20ms Opus frames
+func (e *OggOpusEncoder) WriteFloat32(samples []float32) error {
+	mono := e.resampler.process(downmix(samples, e.channels))
+	e.pending = append(e.pending, mono...)
+
+	offset := 0
+	for ; len(e.pending)-offset >= opusFrameSize; offset += opusFrameSize {
+		if err := e.encodeFrame(e.pending[offset : offset+opusFrameSize]); err != nil {
+			return err
+		}
+	}
+	// Move the remainder to the front to keep the buffer from growing
+	e.pending = append(e.pending[:0], e.pending[offset:]...)
+	return nil
+}
+
+func (e *OggOpusEncoder) encodeFrame(frame []float32) error {
+	n, err := e.encoder.EncodeFloat32(frame, e.packet)
+	if err != nil {
+		return fmt.Errorf("failed to encode audio: %w", err)
+	}
+	return e.writer.WritePacket(e.packet[:n])
+}
+
+// Seconds returns the duration of the audio written so far
+func (e *OggOpusEncoder) Seconds() float64 {
+	return e.writer.Duration().Seconds()
+}
+
+// Close encodes any remaining audio, padded with silence, and closes the file
+func (e *OggOpusEncoder) Close() error {
+	var err error
+	if len(e.pending) > 0 {
+		frame := make([]float32, opusFrameSize)
+		copy(frame, e.pending)
+		e.pending = e.pending[:0]
+		err = e.encodeFrame(frame)
+	}
+	if cerr := e.writer.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package voxaudio
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"voxworld/oggopus"
+)
+
+// readOggGranule returns the final granule position of an Ogg Opus file
+func readOggGranule(t *testing.T, path string) uint64 {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	reader, _, err := oggreader.NewWith(file)
+	require.NoError(t, err)
+	var granule uint64
+	for {
+		_, page, err := reader.ParseNextPage()
+		if err == io.EOF {
+			return granule
+		}
+		require.NoError(t, err)
+		granule = page.GranulePosition
+	}
+}
+
+func TestOggOpusSinkFillsGaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.opus")
+	sink, err := NewOggOpusSink(path)
+	require.NoError(t, err)
+
+	packet := func(ts uint32) *rtp.Packet {
+		return &rtp.Packet{Header: rtp.Header{Timestamp: ts}, Payload: oggopus.SilencePacket}
+	}
+	require.NoError(t, sink.WriteRTP(packet(1000)))
+	require.NoError(t, sink.WriteRTP(packet(1960)))
+	require.NoError(t, sink.WriteRTP(packet(1960)))      // Duplicate is dropped
+	require.NoError(t, sink.WriteRTP(packet(1960+4800))) // 80ms gap
+	require.NoError(t, sink.WriteRTP(&rtp.Packet{}))     // Empty payload is ignored
+	assert.Error(t, sink.WriteRTP(&rtp.Packet{Payload: []byte{0xFB}}))
+	require.NoError(t, sink.Close())
+
+	assert.InDelta(t, 0.14-0.0065, sink.Seconds(), 1e-9)
+	assert.Equal(t, uint64(7*960), readOggGranule(t, path))
+}
+
+func TestOggOpusEncoder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.opus")
+	encoder, err := NewOggOpusEncoder(path, 44100, 2)
+	require.NoError(t, err)
+
+	// One second of stereo audio in 10ms chunks
+	chunk := make([]float32, 441*2)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, encoder.WriteFloat32(chunk))
+	}
+	require.NoError(t, encoder.Close())
+
+	assert.InDelta(t, 1.0, encoder.Seconds(), 0.021)
+	assert.Equal(t, uint64(50*960), readOggGranule(t, path))
+
+	_, err = NewOggOpusEncoder(path, 0, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package oggopus
+
+import "errors"
+
+// ErrInvalidPacket is returned for packets whose TOC byte cannot be parsed.
+var ErrInvalidPacket = errors.New("oggopus: invalid Opus packet")
+
+// SilencePacket is a 20 ms CELT packet that decodes to digital silence.
+// It is used to fill gaps in a stream without running an encoder.
+var SilencePacket = []byte{0xF8, 0xFF, 0xFE}
+
+// SilenceSamples is the duration of SilencePacket at 48 kHz.
+const SilenceSamples = 960
+
+// Frame sizes at 48 kHz indexed by the TOC configuration number (RFC 6716, 3.1)
+var frameSamples = [32]int{
+	480, 960, 1920, 2880, // SILK NB
+	480, 960, 1920, 2880, // SILK MB
+	480, 960, 1920, 2880, // SILK WB
+	480, 960, // Hybrid SWB
+	480, 960, // Hybrid FB
+	120, 240, 480, 960, // CELT NB
+	120, 240, 480, 960, // CELT WB
+	120, 240, 480, 960, // CELT SWB
+	120, 240, 480, 960, // CELT FB
+}
+
+// PacketDuration returns the number of 48 kHz samples encoded in packet.
+func PacketDuration(packet []byte) (int, error) {
+	if len(packet) == 0 {
+		return 0, ErrInvalidPacket
+	}
+	toc := packet[0]
+	var frames int
+	switch toc & 0x03 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0, ErrInvalidPacket
+		}
+		frames = int(packet[1] & 0x3F)
+	}
+	samples := frames * frameSamples[toc>>3]
+	// A packet may not exceed 120 ms
+	if samples == 0 || samples > 5760 {
+		return 0, ErrInvalidPacket
+	}
+	return samples, nil
+}
@@ -0,0 +1,199 @@
+package oggopus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Ogg page header flag for a page that continues the previous packet
+const pageContinued = 0x01
+
+// ErrFormat is returned when the stream is not valid Ogg Opus.
+var ErrFormat = errors.New("oggopus: invalid format")
+
+// Header is the identification header (OpusHead) of a stream.
+type Header struct {
+	Channels   int
+	PreSkip    int // Samples at 48 kHz to discard at the start of decoding
+	SampleRate int // Rate of the original audio, informational only
+	OutputGain int // Q7.8 dB gain to apply when decoding
+}
+
+// Reader demuxes the Opus packets of the first logical stream of an Ogg file.
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	header Header
+
+	serial  uint32
+	started bool
+	packets [][]byte // Complete packets of the current page
+	partial []byte   // Packet continuing on the next page
+	eos     bool
+}
+
+// Open opens the named file for reading.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Ogg file: %w", err)
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader reads the OpusHead and OpusTags headers from r and returns a
+// Reader positioned at the first audio packet.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+
+	head, err := rd.ReadPacket()
+	if err != nil {
+		return nil, formatError("missing OpusHead: %v", err)
+	}
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, formatError("missing OpusHead")
+	}
+	if head[8]&0xF0 != 0 {
+		return nil, formatError("unsupported version %d", head[8])
+	}
+	rd.header = Header{
+		Channels:   int(head[9]),
+		PreSkip:    int(binary.LittleEndian.Uint16(head[10:])),
+		SampleRate: int(binary.LittleEndian.Uint32(head[12:])),
+		OutputGain: int(int16(binary.LittleEndian.Uint16(head[16:]))),
+	}
+	if rd.header.Channels == 0 {
+		return nil, formatError("invalid channel count 0")
+	}
+
+	tags, err := rd.ReadPacket()
+	if err != nil {
+		return nil, formatError("missing OpusTags: %v", err)
+	}
+	if !bytes.HasPrefix(tags, []byte("OpusTags")) {
+		return nil, formatError("missing OpusTags")
+	}
+	return rd, nil
+}
+
+func formatError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, args...))
+}
+
+// Header returns the identification header of the stream.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// ReadPacket returns the next Opus packet. At the end of the stream it
+// returns nil, io.EOF.
+func (r *Reader) ReadPacket() ([]byte, error) {
+	for len(r.packets) == 0 {
+		if r.eos {
+			return nil, io.EOF
+		}
+		if err := r.readPage(); err != nil {
+			return nil, err
+		}
+	}
+	packet := r.packets[0]
+	r.packets = r.packets[1:]
+	return packet, nil
+}
+
+// readPage reads the next page of the stream and splits it into packets
+func (r *Reader) readPage() error {
+	var header [27]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.EOF {
+			// Tolerate a missing end-of-stream page, but not a cut packet
+			r.eos = true
+			if len(r.partial) > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return io.EOF
+		}
+		return err
+	}
+	if !bytes.Equal(header[:4], []byte("OggS")) || header[4] != 0 {
+		return formatError("invalid page header")
+	}
+	flags := header[5]
+	serial := binary.LittleEndian.Uint32(header[14:])
+
+	segments := make([]byte, header[26])
+	if _, err := io.ReadFull(r.r, segments); err != nil {
+		return noEOF(err)
+	}
+	size := 0
+	for _, s := range segments {
+		size += int(s)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return noEOF(err)
+	}
+
+	page := make([]byte, 0, 27+len(segments)+len(body))
+	page = append(page, header[:]...)
+	page = append(page, segments...)
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:], 0)
+	if crc(page) != binary.LittleEndian.Uint32(header[22:]) {
+		return formatError("page checksum mismatch")
+	}
+
+	if !r.started {
+		if flags&pageBOS == 0 {
+			return formatError("missing beginning of stream")
+		}
+		r.serial = serial
+		r.started = true
+	}
+	if serial != r.serial {
+		return nil // Page of another logical stream
+	}
+	if flags&pageContinued == 0 && len(r.partial) > 0 {
+		return formatError("packet not continued")
+	}
+
+	offset := 0
+	for _, s := range segments {
+		r.partial = append(r.partial, body[offset:offset+int(s)]...)
+		offset += int(s)
+		if s < 255 {
+			r.packets = append(r.packets, r.partial)
+			r.partial = nil
+		}
+	}
+	if flags&pageEOS != 0 {
+		r.eos = true
+	}
+	return nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Close closes the underlying file if it was opened by Open.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package oggopus
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.opus")
+	w, err := Create(path, 16000, 2)
+	require.NoError(t, err)
+
+	var packets [][]byte
+	for i := 0; i < 120; i++ {
+		packet := append([]byte{0xF8}, bytes.Repeat([]byte{byte(i)}, i*5)...) // Up to 596 bytes
+		packets = append(packets, packet)
+		require.NoError(t, w.WritePacket(packet))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, Header{Channels: 2, PreSkip: DefaultPreSkip, SampleRate: 16000}, r.Header())
+
+	for i, want := range packets {
+		got, err := r.ReadPacket()
+		require.NoError(t, err, "packet %d", i)
+		assert.Equal(t, want, got, "packet %d", i)
+	}
+	_, err = r.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReaderContinuedPacket(t *testing.T) {
+	// A 600-byte packet split across two pages, followed by a short packet
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 48000, 1)
+	require.NoError(t, err)
+	packet := append([]byte{0xF8}, bytes.Repeat([]byte{7}, 599)...)
+	require.NoError(t, w.writePage(0, 0, []byte{255}, packet[:255]))
+	require.NoError(t, w.writePage(pageContinued, 960, []byte{255, 90}, packet[255:]))
+	require.NoError(t, w.writePage(pageEOS, 1920, []byte{3}, SilencePacket))
+	// Pages of another stream are ignored
+	other := &Writer{w: &buf, serial: w.serial + 1}
+	require.NoError(t, other.writePage(pageBOS, 0, []byte{1}, []byte{0xF8}))
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	got, err := r.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, packet, got)
+	got, err = r.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, SilencePacket, got)
+	_, err = r.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReaderRejectsInvalidStreams(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 48000, 1)
+	require.NoError(t, err)
+	require.NoError(t, w.WritePacket(SilencePacket))
+	require.NoError(t, w.Close())
+	data := buf.Bytes()
+
+	_, err = NewReader(bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrFormat)
+	_, err = NewReader(bytes.NewReader([]byte("RIFF....WAVEfmt ")))
+	assert.ErrorIs(t, err, ErrFormat)
+
+	// A flipped byte in the OpusHead page fails the checksum
+	corrupt := append([]byte(nil), data...)
+	corrupt[30] ^= 0xFF
+	_, err = NewReader(bytes.NewReader(corrupt))
+	assert.ErrorIs(t, err, ErrFormat)
+
+	// A stream cut in the middle of a page
+	last := bytes.LastIndex(data, []byte("OggS"))
+	r, err := NewReader(bytes.NewReader(data[:last+30]))
+	require.NoError(t, err)
+	_, err = r.ReadPacket()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,217 @@
+// Package oggopus reads and writes Opus packets in an Ogg container
+// (RFC 7845) without decoding or re-encoding them.
+package oggopus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// Ogg page header flags
+const (
+	pageBOS = 0x02
+	pageEOS = 0x04
+)
+
+const (
+	// DefaultPreSkip is the decoder delay of libopus at 48 kHz
+	DefaultPreSkip = 312
+
+	// maxPageSamples bounds how much audio is buffered before a page is written
+	maxPageSamples = 48000
+	// maxSegments is the size limit of an Ogg segment table
+	maxSegments = 255
+)
+
+// ErrClosed is returned when writing to a closed Writer.
+var ErrClosed = errors.New("oggopus: writer closed")
+
+// Writer muxes Opus packets into an Ogg Opus stream. Packets are grouped into
+// pages of up to one second of audio; call Flush to force a page out.
+type Writer struct {
+	w      io.Writer
+	closer io.Closer
+
+	serial   uint32
+	sequence uint32
+	granule  uint64 // Granule position at the end of the last packet
+
+	segments []byte // Lacing values of the pending page
+	body     []byte // Packet data of the pending page
+	pending  int    // Samples in the pending page
+
+	closed bool
+}
+
+// Create creates the named file and returns a Writer that owns it.
+// sampleRate is the rate of the original audio and is informational only.
+func Create(path string, sampleRate, channels int) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Ogg file: %w", err)
+	}
+	w, err := NewWriter(file, sampleRate, channels)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
+}
+
+// NewWriter writes the OpusHead and OpusTags headers to w and returns a
+// Writer for audio packets. The caller remains responsible for closing w.
+func NewWriter(w io.Writer, sampleRate, channels int) (*Writer, error) {
+	if channels < 1 || channels > 2 {
+		return nil, fmt.Errorf("unsupported channel count: %d", channels)
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	wr := &Writer{w: w, serial: rand.Uint32()}
+
+	head := make([]byte, 0, 19)
+	head = append(head, "OpusHead"...)
+	head = append(head, 1, byte(channels)) // Version, channel count
+	head = binary.LittleEndian.AppendUint16(head, DefaultPreSkip)
+	head = binary.LittleEndian.AppendUint32(head, uint32(sampleRate))
+	head = binary.LittleEndian.AppendUint16(head, 0) // Output gain
+	head = append(head, 0)                           // Mapping family: mono or stereo
+	if err := wr.writePage(pageBOS, 0, lacing(len(head)), head); err != nil {
+		return nil, fmt.Errorf("failed to write Ogg headers: %w", err)
+	}
+
+	const vendor = "voxaudio"
+	tags := make([]byte, 0, 16+len(vendor))
+	tags = append(tags, "OpusTags"...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0) // No user comments
+	if err := wr.writePage(0, 0, lacing(len(tags)), tags); err != nil {
+		return nil, fmt.Errorf("failed to write Ogg headers: %w", err)
+	}
+	return wr, nil
+}
+
+// lacing returns the segment table entries for a packet of n bytes
+func lacing(n int) []byte {
+	seg := make([]byte, 0, n/255+1)
+	for ; n >= 255; n -= 255 {
+		seg = append(seg, 255)
+	}
+	return append(seg, byte(n))
+}
+
+// Duration returns the duration of the audio written so far, without the
+// pre-skip that decoders discard (RFC 7845 section 4.1).
+func (w *Writer) Duration() time.Duration {
+	if w.granule <= DefaultPreSkip {
+		return 0
+	}
+	return time.Duration(w.granule-DefaultPreSkip) * time.Second / 48000
+}
+
+// WritePacket appends one Opus packet to the stream.
+func (w *Writer) WritePacket(packet []byte) error {
+	if w.closed {
+		return ErrClosed
+	}
+	samples, err := PacketDuration(packet)
+	if err != nil {
+		return err
+	}
+
+	seg := lacing(len(packet))
+	if len(w.segments)+len(seg) > maxSegments || w.pending >= maxPageSamples {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	w.segments = append(w.segments, seg...)
+	w.body = append(w.body, packet...)
+	w.pending += samples
+	w.granule += uint64(samples)
+	return nil
+}
+
+// Flush writes the buffered packets as a page.
+func (w *Writer) Flush() error {
+	if w.closed {
+		return ErrClosed
+	}
+	return w.flush(0)
+}
+
+func (w *Writer) flush(flags byte) error {
+	if len(w.segments) == 0 && flags == 0 {
+		return nil
+	}
+	err := w.writePage(flags, w.granule, w.segments, w.body)
+	w.segments = w.segments[:0]
+	w.body = w.body[:0]
+	w.pending = 0
+	return err
+}
+
+func (w *Writer) writePage(flags byte, granule uint64, segments, body []byte) error {
+	page := make([]byte, 27, 27+len(segments)+len(body))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], w.serial)
+	binary.LittleEndian.PutUint32(page[18:], w.sequence)
+	page[26] = byte(len(segments))
+	page = append(page, segments...)
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:], crc(page))
+	w.sequence++
+
+	_, err := w.w.Write(page)
+	return err
+}
+
+// Close writes the last page, marked as end of stream, and closes the
+// underlying file if it was opened by Create.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	err := w.flush(pageEOS)
+	w.closed = true
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// crcTable implements the Ogg CRC-32 (polynomial 0x04c11db7, no reflection)
+var crcTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+func crc(b []byte) uint32 {
+	var c uint32
+	for _, v := range b {
+		c = c<<8 ^ crcTable[byte(c>>24)^v]
+	}
+	return c
+}
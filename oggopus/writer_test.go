@@ -0,0 +1,96 @@
+package oggopus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketDuration(t *testing.T) {
+	cases := []struct {
+		packet  []byte
+		samples int
+	}{
+		{SilencePacket, 960},
+		{[]byte{0x78}, 960},        // Hybrid FB 20 ms, one frame
+		{[]byte{0x08}, 960},        // SILK NB 20 ms
+		{[]byte{0x18}, 2880},       // SILK NB 60 ms
+		{[]byte{0x81}, 240},        // CELT NB 2.5 ms, two frames
+		{[]byte{0xFB, 0x03}, 2880}, // CELT FB 20 ms, three frames (code 3)
+	}
+	for _, c := range cases {
+		n, err := PacketDuration(c.packet)
+		require.NoError(t, err)
+		assert.Equal(t, c.samples, n, "packet %x", c.packet)
+	}
+
+	_, err := PacketDuration(nil)
+	assert.ErrorIs(t, err, ErrInvalidPacket)
+	_, err = PacketDuration([]byte{0xFB})
+	assert.ErrorIs(t, err, ErrInvalidPacket)
+	_, err = PacketDuration([]byte{0xFB, 0x07}) // 7 x 20 ms exceeds 120 ms
+	assert.ErrorIs(t, err, ErrInvalidPacket)
+}
+
+func TestWriterPages(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 44100, 1)
+	require.NoError(t, err)
+
+	// 60 packets of 20 ms spill into a second page after one second
+	big := append([]byte{0xF8}, make([]byte, 300)...)
+	for i := 0; i < 60; i++ {
+		packet := SilencePacket
+		if i == 10 {
+			packet = big
+		}
+		require.NoError(t, w.WritePacket(packet))
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, 1200*time.Millisecond-6500*time.Microsecond, w.Duration(), "without the pre-skip")
+	assert.ErrorIs(t, w.WritePacket(SilencePacket), ErrClosed)
+
+	// pion's reader validates the page checksums and the OpusHead
+	r, head, err := oggreader.NewWith(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(1), head.Channels)
+	assert.Equal(t, uint32(44100), head.SampleRate)
+	assert.Equal(t, uint16(DefaultPreSkip), head.PreSkip)
+
+	var granules []uint64
+	var payload int
+	for {
+		data, page, err := r.ParseNextPage()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		granules = append(granules, page.GranulePosition)
+		payload += len(data)
+	}
+	// OpusTags page, then the two audio pages
+	assert.Equal(t, []uint64{0, 50 * 960, 60 * 960}, granules)
+	assert.Equal(t, 59*len(SilencePacket)+len(big), payload-len("OpusTags")-4-len("voxaudio")-4)
+
+	// The last page carries the end-of-stream flag
+	data := buf.Bytes()
+	last := bytes.LastIndex(data, []byte("OggS"))
+	assert.Equal(t, byte(pageEOS), data[last+5])
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(data[last+18:]))
+}
+
+func TestWriterRejectsInvalidInput(t *testing.T) {
+	_, err := NewWriter(io.Discard, 48000, 3)
+	assert.Error(t, err)
+
+	w, err := NewWriter(io.Discard, 48000, 2)
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.WritePacket(nil), ErrInvalidPacket)
+	assert.Zero(t, w.Duration(), "nothing written")
+}
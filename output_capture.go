@@ -10,20 +10,32 @@ import (
 // OutputCaptureRecorder 捕获系统音频输出（扬声器）。
 type OutputCaptureRecorder struct {
 	mu       sync.Mutex
-	stream   *portaudio.Stream
+	backend  DeviceBackend
+	stream   DeviceStream
 	Samples  chan []float32
 	isClosed bool // 添加标志来跟踪通道是否已关闭
 }
 
-// NewOutputCaptureRecorder 初始化 PortAudio 并返回实例。
+// NewOutputCaptureRecorder 初始化设备后端并返回实例。
 func NewOutputCaptureRecorder() (*OutputCaptureRecorder, error) {
-	if err := SafePortAudioInit(); err != nil {
+	return NewOutputCaptureRecorderWithBackend(currentDeviceBackend())
+}
+
+// NewOutputCaptureRecorderWithBackend 返回使用指定设备后端的实例。
+func NewOutputCaptureRecorderWithBackend(backend DeviceBackend) (*OutputCaptureRecorder, error) {
+	if err := backend.Init(); err != nil {
 		return nil, err
 	}
-	return &OutputCaptureRecorder{Samples: make(chan []float32, 1024), isClosed: false}, nil
+	return &OutputCaptureRecorder{backend: backend, Samples: make(chan []float32, 1024), isClosed: false}, nil
+}
+
+// Devices 列举设备后端的所有设备。
+func (r *OutputCaptureRecorder) Devices() ([]DeviceInfo, error) {
+	return r.backend.Devices()
 }
 
 // ListDevices 列举所有 PortAudio 设备及其索引。
+// 注意：始终枚举 PortAudio，使用 Devices 获取当前后端的设备
 func (r *OutputCaptureRecorder) ListDevices() ([]*portaudio.HostApiInfo, error) {
 	apis, err := portaudio.HostApis()
 	if err != nil {
@@ -47,51 +59,43 @@ func (r *OutputCaptureRecorder) Start(deviceName string) error {
 	defer r.mu.Unlock()
 
 	// 枚举所有设备
-	var selected *portaudio.DeviceInfo
-	apis, err := portaudio.HostApis()
+	devices, err := r.backend.Devices()
 	if err != nil {
 		return err
 	}
+	var selected DeviceInfo
+	found := false
 
 	// 1. 首先尝试查找环回设备（如BlackHole）
-	for _, api := range apis {
-		for _, dev := range api.Devices {
-			if contains(dev.Name, "BlackHole") || contains(dev.Name, "Loopback") {
-				selected = dev
-				break
-			}
-		}
-		if selected != nil {
+	for _, dev := range devices {
+		if contains(dev.Name, "BlackHole") || contains(dev.Name, "Loopback") {
+			selected, found = dev, true
 			break
 		}
 	}
 
 	// 2. 如果没有找到环回设备，查找指定的设备
-	if selected == nil && deviceName != "" {
-		for _, api := range apis {
-			for _, dev := range api.Devices {
-				if dev.MaxInputChannels > 0 && (dev.Name == deviceName || contains(dev.Name, deviceName)) {
-					selected = dev
-					break
-				}
-			}
-			if selected != nil {
+	if !found && deviceName != "" {
+		for _, dev := range devices {
+			if dev.MaxInputChannels > 0 && (dev.Name == deviceName || contains(dev.Name, deviceName)) {
+				selected, found = dev, true
 				break
 			}
 		}
 	}
 
 	// 3. 如果仍未找到，尝试使用系统默认输入设备
-	if selected == nil {
-		defaultHostAPI, err := portaudio.DefaultHostApi()
-		if err != nil {
-			return fmt.Errorf("获取默认音频API失败: %w", err)
+	if !found {
+		for _, dev := range devices {
+			if dev.DefaultInput {
+				selected, found = dev, true
+				break
+			}
 		}
-		selected = defaultHostAPI.DefaultInputDevice
 	}
 
 	// 如果仍未找到可用设备，报错
-	if selected == nil {
+	if !found {
 		return fmt.Errorf("未找到可用的音频环回设备，请安装BlackHole等虚拟音频设备")
 	}
 
@@ -102,9 +106,12 @@ func (r *OutputCaptureRecorder) Start(deviceName string) error {
 	}
 
 	// 标准设置 - 使用高延迟可靠性更好
-	params := portaudio.HighLatencyParameters(selected, nil)
-	params.Input.Channels = channelCount
-	params.SampleRate = selected.DefaultSampleRate
+	config := StreamConfig{
+		Device:     selected,
+		Channels:   channelCount,
+		SampleRate: selected.DefaultSampleRate,
+		Latency:    selected.HighInputLatency,
+	}
 
 	// 缓冲区大小计算
 	bufferSize := 1024 * channelCount
@@ -112,7 +119,7 @@ func (r *OutputCaptureRecorder) Start(deviceName string) error {
 	// 创建输入缓冲区和处理回调
 	in := make([]float32, bufferSize)
 
-	stream, err := portaudio.OpenStream(params, func(input []float32) {
+	stream, err := r.backend.OpenInput(config, func(input []float32) {
 		// 复制输入数据到缓冲区
 		copy(in, input)
 		// 发送数据副本到通道
@@ -126,6 +133,7 @@ func (r *OutputCaptureRecorder) Start(deviceName string) error {
 
 	if err := r.stream.Start(); err != nil {
 		r.stream.Close()
+		r.stream = nil
 		return fmt.Errorf("启动流失败: %w", err)
 	}
 
@@ -146,8 +154,7 @@ func (r *OutputCaptureRecorder) Stop() error {
 	if !r.isClosed {
 		close(r.Samples)
 		r.isClosed = true
+		r.backend.Terminate()
 	}
-
-	SafePortAudioTerminate()
 	return nil
 }
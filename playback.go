@@ -0,0 +1,312 @@
+package voxaudio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Output identifies where the translated audio is played
+type Output int
+
+const (
+	OutputSpeaker   Output = iota // Default output device, see RegisterLocalTrack
+	OutputBlackHole               // BlackHole virtual device, see RegisterBlackHoleTrack
+)
+
+func (o Output) String() string {
+	switch o {
+	case OutputSpeaker:
+		return "speaker"
+	case OutputBlackHole:
+		return "blackhole"
+	}
+	return "unknown"
+}
+
+// playbackBuffer queues decoded audio for the oto player. Unlike a
+// bytes.Buffer it is safe to write while the player reads, and seeking
+// drops the queued audio.
+type playbackBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	tap func(p []byte) // Receives the audio as the player reads it
+}
+
+func (b *playbackBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *playbackBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	n, err := b.buf.Read(p)
+	tap := b.tap
+	b.mu.Unlock()
+	if tap != nil && n > 0 {
+		tap(p[:n])
+	}
+	return n, err
+}
+
+// Len returns the number of queued bytes
+func (b *playbackBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// Seek drops the queued audio; only seeking to the end is supported
+func (b *playbackBuffer) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekEnd {
+		return 0, errors.New("playback buffer can only seek to the end")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+	return 0, nil
+}
+
+const (
+	// Assumed delay between the oto player and the speaker, which oto does not report
+	defaultSpeakerLatency = 40 * time.Millisecond
+
+	maxPlaybackItems = 64 // Items whose position is remembered per output
+)
+
+// playbackSpan is the part of an output's sample stream holding an item
+type playbackSpan struct {
+	start, end int64 // end is -1 while the item is playing
+}
+
+// playbackState follows the response items an output plays
+type playbackState struct {
+	output Output
+	queued func() int64 // Samples queued but not played yet
+	flush  func()       // Drops the queued samples
+
+	mu       sync.Mutex
+	latency  time.Duration // Device latency after the queue
+	written  int64         // Samples queued since the output started
+	itemID   string        // Item being played
+	items    map[string]*playbackSpan
+	order    []string // Items by start
+	dropItem string   // Interrupted item whose remaining audio is discarded
+}
+
+// discard reports whether audio of the item must not be played
+func (p *playbackState) discard(itemID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return itemID != "" && itemID == p.dropItem
+}
+
+// queue accounts n samples of the item handed to the device. The first
+// audible samples of a new item start it.
+func (p *playbackState) queue(n int, audible bool, itemID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if audible && itemID != "" && itemID != p.itemID {
+		if span, ok := p.items[p.itemID]; ok {
+			span.end = p.written
+		}
+		if p.items == nil {
+			p.items = make(map[string]*playbackSpan)
+		}
+		if len(p.order) == maxPlaybackItems {
+			delete(p.items, p.order[0])
+			p.order = p.order[1:]
+		}
+		p.itemID = itemID
+		p.items[itemID] = &playbackSpan{start: p.written, end: -1}
+		p.order = append(p.order, itemID)
+	}
+	p.written += int64(n)
+}
+
+// heard returns the position in the sample stream that reached the listener
+func (p *playbackState) heard() int64 {
+	latency := int64(p.latency * sampleRate / time.Second)
+	return max(p.written-p.queued()-latency, 0)
+}
+
+// played returns how many samples of the item were heard
+func (p *playbackState) played(itemID string) (int64, bool) {
+	span, ok := p.items[itemID]
+	if !ok {
+		return 0, false
+	}
+	end := p.heard()
+	if span.end >= 0 {
+		end = min(end, span.end)
+	}
+	return max(end-span.start, 0), true
+}
+
+// position returns the played milliseconds of the item
+func (p *playbackState) position(itemID string) (int64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	played, ok := p.played(itemID)
+	return played * 1000 / sampleRate, ok
+}
+
+// positions returns the played milliseconds of the remembered items
+func (p *playbackState) positions() map[string]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	positions := make(map[string]int64, len(p.order))
+	for _, itemID := range p.order {
+		played, _ := p.played(itemID)
+		positions[itemID] = played * 1000 / sampleRate
+	}
+	return positions
+}
+
+// interrupt drops the queued audio of the current item and returns how
+// much of it was played. ok is false when no item was playing.
+func (p *playbackState) interrupt(serverPlaying bool) (itemID string, playedMs int64, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.itemID == "" || p.itemID == p.dropItem {
+		return "", 0, false
+	}
+	queued := p.queued()
+	if queued == 0 && !serverPlaying {
+		return "", 0, false // Finished playing
+	}
+	played, _ := p.played(p.itemID)
+	p.flush()
+	p.written -= queued // Flushed samples are never played
+	p.items[p.itemID].end = p.written
+	p.dropItem = p.itemID
+	return p.itemID, played * 1000 / sampleRate, true
+}
+
+// addPlayback registers an output playing the translation
+func (s *Session) addPlayback(output Output, latency time.Duration, queued func() int64, flush func()) *playbackState {
+	p := &playbackState{output: output, latency: latency, queued: queued, flush: flush}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if override, ok := s.outputLatency[output]; ok {
+		p.latency = override
+	}
+	s.playbacks = append(s.playbacks, p)
+	return p
+}
+
+// removePlayback unregisters an output that stopped playing
+func (s *Session) removePlayback(p *playbackState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playbacks = slices.DeleteFunc(s.playbacks, func(other *playbackState) bool { return other == p })
+}
+
+// SetOutputLatency sets the delay between queuing audio on an output and
+// hearing it, used for the playback position
+// Note: Replaces the latency reported by the device, or the estimate for the speaker
+func (s *Session) SetOutputLatency(output Output, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outputLatency == nil {
+		s.outputLatency = make(map[Output]time.Duration)
+	}
+	s.outputLatency[output] = latency
+	for _, p := range s.playbacks {
+		if p.output == output {
+			p.mu.Lock()
+			p.latency = latency
+			p.mu.Unlock()
+		}
+	}
+}
+
+// PlayedMs returns how many milliseconds of a response item's audio have been
+// heard. With several outputs the furthest one counts. ok is false for items
+// no output has played.
+func (s *Session) PlayedMs(itemID string) (playedMs int64, ok bool) {
+	s.mu.Lock()
+	playbacks := slices.Clone(s.playbacks)
+	s.mu.Unlock()
+	for _, p := range playbacks {
+		if ms, found := p.position(itemID); found && (!ok || ms > playedMs) {
+			playedMs, ok = ms, true
+		}
+	}
+	return playedMs, ok
+}
+
+// PlayedItems maps the recently played response items to their heard milliseconds
+func (s *Session) PlayedItems() map[string]int64 {
+	s.mu.Lock()
+	playbacks := slices.Clone(s.playbacks)
+	s.mu.Unlock()
+	items := make(map[string]int64)
+	for _, p := range playbacks {
+		for itemID, ms := range p.positions() {
+			if prev, ok := items[itemID]; !ok || ms > prev {
+				items[itemID] = ms
+			}
+		}
+	}
+	return items
+}
+
+// outputItem returns the response item whose audio is arriving
+func (s *Session) outputItem() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.playingItem
+}
+
+// trackOutputItems follows which response item the received audio belongs to.
+// With WebRTC the server paces the audio, so an item starts playing when the
+// server starts sending its response rather than when it is created.
+func (s *Session) trackOutputItems(evt ServerEvent) {
+	switch evt.Type {
+	case EventResponseOutputItemAdded:
+		var msg struct {
+			Item struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"item"`
+		}
+		if json.Unmarshal(evt.Raw, &msg) != nil || msg.Item.Type != "message" {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.responseItems == nil {
+			s.responseItems = make(map[string]string)
+		}
+		s.responseItems[evt.ResponseID] = msg.Item.ID
+		if !s.serverPlaying {
+			s.playingItem = msg.Item.ID
+		}
+	case EventOutputAudioStarted:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.serverPlaying = true
+		if item, ok := s.responseItems[evt.ResponseID]; ok {
+			s.playingItem = item
+			delete(s.responseItems, evt.ResponseID)
+		}
+	case EventOutputAudioStopped:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.serverPlaying = false
+	case EventResponseDone:
+		// Forget items that are already playing or will never play
+		responseID, status := responseStatus(evt)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if item, ok := s.responseItems[responseID]; ok && (item == s.playingItem || status == "cancelled" || status == "failed") {
+			delete(s.responseItems, responseID)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package voxaudio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueMs queues ms of audible audio of the item
+func queueMs(p *playbackState, itemID string, ms int) {
+	for i := 0; i < ms/20; i++ {
+		p.queue(frameSize, true, itemID)
+	}
+}
+
+func TestPlaybackPositions(t *testing.T) {
+	s := &Session{}
+	out := &fakeOutput{}
+	p := s.addPlayback(OutputSpeaker, 40*time.Millisecond, func() int64 { return out.queued }, func() {})
+
+	queueMs(p, "item_1", 1000)
+	queueMs(p, "item_2", 600)
+	out.queued = sampleRate / 5 // 200ms of item_2 still queued
+
+	ms, ok := s.PlayedMs("item_1")
+	require.True(t, ok)
+	assert.Equal(t, int64(1000), ms, "finished items are heard completely")
+	ms, ok = s.PlayedMs("item_2")
+	require.True(t, ok)
+	assert.Equal(t, int64(360), ms, "queued audio and device latency are not heard yet")
+	_, ok = s.PlayedMs("item_3")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]int64{"item_1": 1000, "item_2": 360}, s.PlayedItems())
+
+	// A newer item has not been heard while the previous one is queued
+	out.queued = sampleRate / 2
+	queueMs(p, "item_3", 300)
+	ms, _ = s.PlayedMs("item_2")
+	assert.Equal(t, int64(360), ms)
+	ms, _ = s.PlayedMs("item_3")
+	assert.Zero(t, ms)
+
+	s.SetOutputLatency(OutputSpeaker, 0)
+	ms, _ = s.PlayedMs("item_2")
+	assert.Equal(t, int64(400), ms)
+}
+
+func TestPlaybackFurthestOutput(t *testing.T) {
+	s := &Session{}
+	s.SetOutputLatency(OutputBlackHole, 100*time.Millisecond)
+	speaker, blackHole := &fakeOutput{}, &fakeOutput{}
+	sp := s.addPlayback(OutputSpeaker, 0, func() int64 { return speaker.queued }, func() {})
+	bh := s.addPlayback(OutputBlackHole, 10*time.Millisecond, func() int64 { return blackHole.queued }, func() {})
+	assert.Equal(t, 100*time.Millisecond, bh.latency, "the override replaces the device latency")
+
+	queueMs(sp, "item_1", 500)
+	queueMs(bh, "item_1", 500)
+	speaker.queued = sampleRate / 10
+	ms, _ := s.PlayedMs("item_1")
+	assert.Equal(t, int64(400), ms)
+
+	s.removePlayback(sp)
+	ms, _ = s.PlayedMs("item_1")
+	assert.Equal(t, int64(400), ms, "the BlackHole output is 100ms behind")
+}
+
+func TestPlaybackInterruptedItem(t *testing.T) {
+	s := &Session{}
+	out := &fakeOutput{}
+	p := s.addPlayback(OutputSpeaker, 20*time.Millisecond, func() int64 { return out.queued }, func() { out.queued = 0 })
+
+	queueMs(p, "item_1", 1000)
+	out.queued = sampleRate / 2
+	itemID, playedMs, ok := p.interrupt(false)
+	require.True(t, ok)
+	assert.Equal(t, "item_1", itemID)
+	assert.Equal(t, int64(480), playedMs)
+
+	// The flushed audio is never heard, the next item follows the played part
+	queueMs(p, "item_2", 200)
+	ms, _ := s.PlayedMs("item_1")
+	assert.Equal(t, int64(500), ms)
+	ms, _ = s.PlayedMs("item_2")
+	assert.Equal(t, int64(180), ms)
+}
+
+func TestPlaybackItemLimit(t *testing.T) {
+	p := &playbackState{queued: func() int64 { return 0 }}
+	for i := 0; i <= maxPlaybackItems; i++ {
+		queueMs(p, string(rune('A'+i)), 20)
+	}
+	positions := p.positions()
+	assert.Len(t, positions, maxPlaybackItems)
+	assert.NotContains(t, positions, "A")
+}
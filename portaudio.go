@@ -3,6 +3,7 @@ package voxaudio
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/gordonklaus/portaudio"
 )
@@ -37,3 +38,124 @@ func SafePortAudioTerminate() {
 		paInitCount = 0 // Ensure it doesn't become negative
 	}
 }
+
+// PortAudioBackend is the DeviceBackend of the host's audio devices
+type PortAudioBackend struct{}
+
+// Init initializes PortAudio
+func (PortAudioBackend) Init() error {
+	return SafePortAudioInit()
+}
+
+// Terminate releases PortAudio when the last user terminates
+func (PortAudioBackend) Terminate() {
+	SafePortAudioTerminate()
+}
+
+// Devices lists the devices of all host APIs
+func (PortAudioBackend) Devices() ([]DeviceInfo, error) {
+	apis, err := portaudio.HostApis()
+	if err != nil {
+		return nil, err
+	}
+	defaultAPI, _ := portaudio.DefaultHostApi()
+
+	var devices []DeviceInfo
+	for _, api := range apis {
+		for _, dev := range api.Devices {
+			info := DeviceInfo{
+				Index:             dev.Index,
+				Name:              dev.Name,
+				HostAPI:           api.Name,
+				MaxInputChannels:  dev.MaxInputChannels,
+				MaxOutputChannels: dev.MaxOutputChannels,
+				DefaultSampleRate: dev.DefaultSampleRate,
+				LowInputLatency:   dev.DefaultLowInputLatency,
+				HighInputLatency:  dev.DefaultHighInputLatency,
+				LowOutputLatency:  dev.DefaultLowOutputLatency,
+				HighOutputLatency: dev.DefaultHighOutputLatency,
+			}
+			if api == defaultAPI {
+				info.DefaultInput = dev == api.DefaultInputDevice
+				info.DefaultOutput = dev == api.DefaultOutputDevice
+			}
+			devices = append(devices, info)
+		}
+	}
+	return devices, nil
+}
+
+// OpenInput opens a capture stream on config.Device
+func (b PortAudioBackend) OpenInput(config StreamConfig, callback func(in []float32)) (DeviceStream, error) {
+	dev, err := portAudioDevice(config.Device.Index)
+	if err != nil {
+		return nil, err
+	}
+	params := portaudio.StreamParameters{
+		Input: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: config.Channels,
+			Latency:  config.Latency,
+		},
+		SampleRate:      config.SampleRate,
+		FramesPerBuffer: config.FramesPerBuffer,
+	}
+	stream, err := portaudio.OpenStream(params, callback)
+	if err != nil {
+		return nil, err
+	}
+	return portAudioStream{Stream: stream}, nil
+}
+
+// OpenOutput opens a playback stream on config.Device
+func (b PortAudioBackend) OpenOutput(config StreamConfig, callback func(out []float32)) (DeviceStream, error) {
+	dev, err := portAudioDevice(config.Device.Index)
+	if err != nil {
+		return nil, err
+	}
+	params := portaudio.StreamParameters{
+		Output: portaudio.StreamDeviceParameters{
+			Device:   dev,
+			Channels: config.Channels,
+			Latency:  config.Latency,
+		},
+		SampleRate:      config.SampleRate,
+		FramesPerBuffer: config.FramesPerBuffer,
+	}
+	stream, err := portaudio.OpenStream(params, callback)
+	if err != nil {
+		return nil, err
+	}
+	return portAudioStream{Stream: stream, output: true}, nil
+}
+
+// portAudioStream reports the latency PortAudio chose for a stream
+type portAudioStream struct {
+	*portaudio.Stream
+	output bool
+}
+
+func (s portAudioStream) Latency() time.Duration {
+	info := s.Info()
+	if info == nil {
+		return 0
+	}
+	if s.output {
+		return info.OutputLatency
+	}
+	return info.InputLatency
+}
+
+// portAudioDevice returns the PortAudio device with the given index
+func portAudioDevice(index int) (*portaudio.DeviceInfo, error) {
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	for _, dev := range devices {
+		if dev.Index == index {
+			return dev, nil
+		}
+	}
+	return nil, fmt.Errorf("audio device %d not found", index)
+}
@@ -0,0 +1,127 @@
+package voxaudio
+
+import (
+	"fmt"
+	"time"
+)
+
+// StalePolicy decides what happens to pre-roll audio that waited too long
+type StalePolicy int
+
+const (
+	StaleTrim    StalePolicy = iota // Send only the audio younger than MaxAge
+	StaleDiscard                    // Drop the whole pre-roll once its start is older than MaxAge
+	StaleKeep                       // Send all of it regardless of age
+)
+
+// PreRollOptions configures the buffering of audio captured before the
+// data channel opens
+type PreRollOptions struct {
+	Duration time.Duration // Newest audio kept, default 5s, negative disables the pre-roll
+	MaxAge   time.Duration // Audio older than this when the channel opens is stale, default 10s
+	Stale    StalePolicy
+}
+
+func (o PreRollOptions) withDefaults() PreRollOptions {
+	if o.Duration == 0 {
+		o.Duration = 5 * time.Second
+	}
+	if o.MaxAge <= 0 {
+		o.MaxAge = 10 * time.Second
+	}
+	return o
+}
+
+// preRollChunk is captured 24 kHz PCM16 audio
+type preRollChunk struct {
+	pcm      []byte
+	captured time.Time
+}
+
+// preRollBuffer is a ring buffer of the newest captured audio, flushed to the
+// session in order once the data channel opens
+type preRollBuffer struct {
+	options PreRollOptions
+	chunks  []preRollChunk
+	size    int // Bytes in chunks
+	dropped int // Bytes dropped because the buffer was full
+}
+
+func newPreRollBuffer(options PreRollOptions) *preRollBuffer {
+	return &preRollBuffer{options: options.withDefaults()}
+}
+
+// capacity returns the buffer size in bytes
+func (b *preRollBuffer) capacity() int {
+	if b.options.Duration < 0 {
+		return 0
+	}
+	return int(b.options.Duration.Seconds()*inputSampleRate) * 2
+}
+
+// add keeps a chunk, dropping the oldest audio beyond the capacity
+func (b *preRollBuffer) add(pcm []byte, captured time.Time) {
+	b.chunks = append(b.chunks, preRollChunk{pcm: pcm, captured: captured})
+	b.size += len(pcm)
+	for excess := b.size - b.capacity(); excess > 0; excess = b.size - b.capacity() {
+		oldest := &b.chunks[0]
+		if len(oldest.pcm) > excess {
+			// Keep whole samples of the partly dropped chunk
+			excess += excess % 2
+			oldest.pcm = oldest.pcm[excess:]
+			b.size -= excess
+			b.dropped += excess
+			continue
+		}
+		b.size -= len(oldest.pcm)
+		b.dropped += len(oldest.pcm)
+		b.chunks = b.chunks[1:]
+	}
+}
+
+// drain empties the buffer and returns the audio to send at now, in
+// capture order, after applying the stale policy
+func (b *preRollBuffer) drain(now time.Time) []preRollChunk {
+	chunks := b.chunks
+	b.chunks, b.size = nil, 0
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	stale := 0
+	for stale < len(chunks) && now.Sub(chunks[stale].captured) > b.options.MaxAge {
+		stale++
+	}
+	switch {
+	case stale == 0 || b.options.Stale == StaleKeep:
+	case b.options.Stale == StaleDiscard:
+		fmt.Printf("[Audio] Discarded %.1f seconds of stale pre-roll audio\n", chunksSeconds(chunks))
+		return nil
+	default:
+		fmt.Printf("[Audio] Dropped %.1f seconds of stale pre-roll audio\n", chunksSeconds(chunks[:stale]))
+		chunks = chunks[stale:]
+	}
+	if b.dropped > 0 {
+		fmt.Printf("[Audio] Pre-roll full, dropped the first %.1f seconds of audio\n", float64(b.dropped/2)/inputSampleRate)
+		b.dropped = 0
+	}
+	return chunks
+}
+
+// chunksSeconds returns the duration of the audio in chunks
+func chunksSeconds(chunks []preRollChunk) float64 {
+	var size int
+	for _, chunk := range chunks {
+		size += len(chunk.pcm)
+	}
+	return float64(size/2) / inputSampleRate
+}
+
+// SetPreRoll configures the buffering of audio captured while the
+// connection is still being established
+// Note: Takes effect on the next call to Start
+func (s *Session) SetPreRoll(options PreRollOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.preRoll = options
+}
@@ -0,0 +1,61 @@
+package voxaudio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pcmChunk returns ms milliseconds of 24 kHz PCM16 audio filled with value
+func pcmChunk(ms int, value byte) []byte {
+	pcm := make([]byte, inputSampleRate/1000*ms*2)
+	for i := range pcm {
+		pcm[i] = value
+	}
+	return pcm
+}
+
+func TestPreRollCap(t *testing.T) {
+	b := newPreRollBuffer(PreRollOptions{Duration: 100 * time.Millisecond})
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		b.add(pcmChunk(30, byte(i+1)), t0.Add(time.Duration(i*30)*time.Millisecond))
+	}
+
+	// The newest 100ms are kept in order, the oldest chunk partly
+	chunks := b.drain(t0.Add(150 * time.Millisecond))
+	require.Len(t, chunks, 4)
+	assert.Len(t, chunks[0].pcm, inputSampleRate/1000*10*2)
+	for i, chunk := range chunks {
+		assert.Equal(t, byte(i+2), chunk.pcm[0])
+	}
+	assert.InDelta(t, 0.1, chunksSeconds(chunks), 1e-9)
+	assert.Empty(t, b.drain(t0.Add(time.Second)), "drained")
+}
+
+func TestPreRollStalePolicy(t *testing.T) {
+	t0 := time.Now()
+	fill := func(policy StalePolicy) *preRollBuffer {
+		b := newPreRollBuffer(PreRollOptions{Duration: time.Minute, MaxAge: time.Second, Stale: policy})
+		for i := 0; i < 4; i++ {
+			b.add(pcmChunk(20, byte(i+1)), t0.Add(time.Duration(i)*500*time.Millisecond))
+		}
+		return b
+	}
+	now := t0.Add(1800 * time.Millisecond) // The first two chunks are stale
+
+	chunks := fill(StaleTrim).drain(now)
+	require.Len(t, chunks, 2)
+	assert.Equal(t, byte(3), chunks[0].pcm[0])
+	assert.Empty(t, fill(StaleDiscard).drain(now))
+	assert.Len(t, fill(StaleKeep).drain(now), 4)
+	assert.Len(t, fill(StaleDiscard).drain(t0.Add(time.Second)), 4, "nothing stale yet")
+}
+
+func TestPreRollDisabled(t *testing.T) {
+	b := newPreRollBuffer(PreRollOptions{Duration: -1})
+	b.add(pcmChunk(20, 1), time.Now())
+	assert.Empty(t, b.drain(time.Now()))
+}
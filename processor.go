@@ -0,0 +1,313 @@
+package voxaudio
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AudioFormat describes interleaved float32 samples
+type AudioFormat struct {
+	SampleRate int
+	Channels   int
+}
+
+// uploadFormat is the format of the input processing chain of a session
+var uploadFormat = AudioFormat{SampleRate: inputSampleRate, Channels: 1}
+
+// Frame is a block of captured audio
+type Frame struct {
+	Samples  []float32 // Interleaved samples in Format
+	Format   AudioFormat
+	Captured time.Time // When the last sample was captured
+}
+
+// Processor is a stage of audio processing, such as noise suppression or
+// gain control. It returns as many samples as the frame holds, in the same
+// format; it may delay the audio but not change its length.
+type Processor interface {
+	Process(frame Frame) []float32
+}
+
+// StageStats reports the processing time of a stage
+type StageStats struct {
+	Name    string
+	Enabled bool
+	Frames  int64         // Frames processed
+	Total   time.Duration // Time spent in Process
+	Last    time.Duration
+	Max     time.Duration
+}
+
+// Average returns the mean processing time of a frame
+func (s StageStats) Average() time.Duration {
+	if s.Frames == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Frames)
+}
+
+// stage is a named processor of a chain
+type stage struct {
+	name      string
+	processor Processor
+	enabled   bool
+	stats     StageStats
+}
+
+// Chain runs processors in order. Stages can be added, removed, reordered
+// and disabled while audio flows; each reports its processing time.
+type Chain struct {
+	format AudioFormat
+
+	mu     sync.Mutex
+	stages []*stage
+}
+
+// NewChain returns an empty chain for audio in format
+func NewChain(format AudioFormat) *Chain {
+	return &Chain{format: format}
+}
+
+// Format returns the format of the audio the chain processes
+func (c *Chain) Format() AudioFormat {
+	return c.format
+}
+
+// Add appends a stage, or replaces the processor of the stage with that name
+func (c *Chain) Add(name string, p Processor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.find(name); i >= 0 {
+		c.stages[i].processor = p
+		return
+	}
+	c.stages = append(c.stages, &stage{name: name, processor: p, enabled: true})
+}
+
+// Insert adds a stage at index, moving it there if it already exists
+func (c *Chain) Insert(index int, name string, p Processor) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := &stage{name: name, processor: p, enabled: true}
+	if i := c.find(name); i >= 0 {
+		st = c.stages[i]
+		st.processor = p
+		c.stages = slices.Delete(c.stages, i, i+1)
+	}
+	if index < 0 || index > len(c.stages) {
+		return fmt.Errorf("stage index %d out of range", index)
+	}
+	c.stages = slices.Insert(c.stages, index, st)
+	return nil
+}
+
+// Remove deletes a stage; false if there is none with that name
+func (c *Chain) Remove(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.find(name)
+	if i < 0 {
+		return false
+	}
+	c.stages = slices.Delete(c.stages, i, i+1)
+	return true
+}
+
+// SetEnabled skips a stage while disabled
+func (c *Chain) SetEnabled(name string, enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.find(name)
+	if i < 0 {
+		return fmt.Errorf("no stage %s", name)
+	}
+	c.stages[i].enabled = enabled
+	return nil
+}
+
+// Get returns the processor of a stage, nil if there is none
+func (c *Chain) Get(name string) Processor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i := c.find(name); i >= 0 {
+		return c.stages[i].processor
+	}
+	return nil
+}
+
+// Len returns the number of stages
+func (c *Chain) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.stages)
+}
+
+// Names returns the stage names in processing order
+func (c *Chain) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, len(c.stages))
+	for i, st := range c.stages {
+		names[i] = st.name
+	}
+	return names
+}
+
+// Stats returns the processing time of each stage, in processing order
+func (c *Chain) Stats() []StageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]StageStats, len(c.stages))
+	for i, st := range c.stages {
+		stats[i] = st.stats
+		stats[i].Name, stats[i].Enabled = st.name, st.enabled
+	}
+	return stats
+}
+
+// find returns the index of a stage, -1 if there is none; c.mu must be held
+func (c *Chain) find(name string) int {
+	return slices.IndexFunc(c.stages, func(st *stage) bool { return st.name == name })
+}
+
+// Process runs the samples captured at the given time through the enabled stages
+func (c *Chain) Process(samples []float32, captured time.Time) []float32 {
+	c.mu.Lock()
+	type run struct {
+		stage     *stage
+		processor Processor
+	}
+	var runs []run
+	for _, st := range c.stages {
+		if st.enabled {
+			runs = append(runs, run{st, st.processor})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, r := range runs {
+		start := time.Now()
+		samples = r.processor.Process(Frame{Samples: samples, Format: c.format, Captured: captured})
+		elapsed := time.Since(start)
+
+		c.mu.Lock()
+		stats := &r.stage.stats
+		stats.Frames++
+		stats.Total += elapsed
+		stats.Last = elapsed
+		stats.Max = max(stats.Max, elapsed)
+		c.mu.Unlock()
+	}
+	return samples
+}
+
+// Built-in stages of the input chain, in processing order
+const (
+	StageEcho  = "echo"
+	StageNoise = "noise"
+	StageAGC   = "agc"
+)
+
+var builtinStages = []string{StageEcho, StageNoise, StageAGC}
+
+// Built-in stages of the output chain, in processing order
+const (
+	StageLoudness = "loudness"
+)
+
+var builtinOutputStages = []string{StageLoudness}
+
+// Processors returns the chain that processes the captured input before
+// upload, as 24 kHz mono. Custom stages run after the built-in ones unless
+// inserted elsewhere.
+func (s *Session) Processors() *Chain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.processors == nil {
+		s.processors = NewChain(uploadFormat)
+	}
+	return s.processors
+}
+
+// OutputProcessors returns the chain that processes the decoded remote
+// audio, as 48 kHz mono, before it is played or recorded
+func (s *Session) OutputProcessors() *Chain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outputs == nil {
+		s.outputs = NewChain(outputFormat)
+	}
+	return s.outputs
+}
+
+// setStage sets a built-in stage of the input chain
+func (s *Session) setStage(name string, p Processor) {
+	setBuiltinStage(s.Processors(), builtinStages, name, p)
+}
+
+// setOutputStage sets a built-in stage of the output chain
+func (s *Session) setOutputStage(name string, p Processor) {
+	setBuiltinStage(s.OutputProcessors(), builtinOutputStages, name, p)
+}
+
+// setBuiltinStage adds, replaces or with a nil processor removes a built-in
+// stage, keeping the built-in stages in their order
+func setBuiltinStage(chain *Chain, builtins []string, name string, p Processor) {
+	if p == nil {
+		chain.Remove(name)
+		return
+	}
+	names := chain.Names()
+	if slices.Contains(names, name) {
+		chain.Add(name, p)
+		return
+	}
+
+	// Before the first custom or later built-in stage
+	rank := slices.Index(builtins, name)
+	index := slices.IndexFunc(names, func(existing string) bool {
+		r := slices.Index(builtins, existing)
+		return r < 0 || r > rank
+	})
+	if index < 0 {
+		index = len(names)
+	}
+	_ = chain.Insert(index, name, p)
+}
+
+// stageOf returns the processor of a stage as a T
+func stageOf[T any](s *Session, name string) (T, bool) {
+	p, ok := s.Processors().Get(name).(T)
+	return p, ok
+}
+
+// formatStageStats describes the last processing time of each stage
+func formatStageStats(stats []StageStats) string {
+	parts := make([]string, 0, len(stats))
+	for _, st := range stats {
+		if st.Enabled {
+			parts = append(parts, fmt.Sprintf("%s %.2f ms", st.Name, float64(st.Last)/float64(time.Millisecond)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// processOutput runs decoded PCM16 through the output processors in place
+// Note: Samples a processor adds are dropped, samples it removes are left unprocessed
+func (s *Session) processOutput(pcm []int16) {
+	chain := s.OutputProcessors()
+	if chain.Len() == 0 {
+		return
+	}
+	frame := make([]float32, len(pcm))
+	for i, v := range pcm {
+		frame[i] = float32(v) / 32767.0
+	}
+	out := chain.Process(frame, time.Now())
+	for i, sample := range out[:min(len(out), len(pcm))] {
+		pcm[i] = int16(max(-1, min(1, sample)) * 32767.0)
+	}
+}
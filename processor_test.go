@@ -0,0 +1,104 @@
+package voxaudio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scaleProcessor multiplies the samples and records the frames it saw
+type scaleProcessor struct {
+	factor float32
+	frames []Frame
+}
+
+func (p *scaleProcessor) Process(frame Frame) []float32 {
+	p.frames = append(p.frames, frame)
+	out := make([]float32, len(frame.Samples))
+	for i, sample := range frame.Samples {
+		out[i] = sample * p.factor
+	}
+	return out
+}
+
+// offsetProcessor adds a constant, so the order of stages matters
+type offsetProcessor float32
+
+func (p offsetProcessor) Process(frame Frame) []float32 {
+	out := make([]float32, len(frame.Samples))
+	for i, sample := range frame.Samples {
+		out[i] = sample + float32(p)
+	}
+	return out
+}
+
+func TestChainOrderAndFormat(t *testing.T) {
+	chain := NewChain(uploadFormat)
+	scale := &scaleProcessor{factor: 2}
+	chain.Add("scale", scale)
+	chain.Add("offset", offsetProcessor(1))
+
+	at := time.Now()
+	assert.Equal(t, []float32{3, 5}, chain.Process([]float32{1, 2}, at))
+	require.Len(t, scale.frames, 1)
+	assert.Equal(t, uploadFormat, scale.frames[0].Format)
+	assert.Equal(t, at, scale.frames[0].Captured)
+
+	// Reorder, disable and remove while running
+	require.NoError(t, chain.Insert(0, "offset", offsetProcessor(1)))
+	assert.Equal(t, []string{"offset", "scale"}, chain.Names())
+	assert.Equal(t, []float32{4, 6}, chain.Process([]float32{1, 2}, at))
+
+	require.NoError(t, chain.SetEnabled("offset", false))
+	assert.Equal(t, []float32{2, 4}, chain.Process([]float32{1, 2}, at))
+	assert.Error(t, chain.SetEnabled("missing", false))
+
+	assert.True(t, chain.Remove("scale"))
+	assert.False(t, chain.Remove("scale"))
+	assert.Equal(t, []float32{1, 2}, chain.Process([]float32{1, 2}, at))
+	assert.Error(t, chain.Insert(5, "late", offsetProcessor(1)))
+}
+
+func TestChainStats(t *testing.T) {
+	chain := NewChain(uploadFormat)
+	chain.Add("scale", &scaleProcessor{factor: 1})
+	chain.Add("offset", offsetProcessor(0))
+	for i := 0; i < 3; i++ {
+		chain.Process(make([]float32, 240), time.Now())
+	}
+	require.NoError(t, chain.SetEnabled("offset", false))
+	chain.Process(make([]float32, 240), time.Now())
+
+	stats := chain.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "scale", stats[0].Name)
+	assert.Equal(t, int64(4), stats[0].Frames)
+	assert.Equal(t, int64(3), stats[1].Frames)
+	assert.False(t, stats[1].Enabled)
+	assert.GreaterOrEqual(t, stats[0].Max, stats[0].Last)
+	assert.LessOrEqual(t, stats[0].Average(), stats[0].Max)
+	assert.Zero(t, StageStats{}.Average())
+}
+
+func TestSessionBuiltinStages(t *testing.T) {
+	s := &Session{}
+	s.Processors().Add("custom", offsetProcessor(0))
+	s.SetAGC(NewAutomaticGainControl(AGCOptions{}))
+	s.SetNoiseSuppressor(NewSpectralSubtractor(SpectralOptions{}))
+	s.SetEchoCanceller(NewEchoCanceller(EchoOptions{}))
+	assert.Equal(t, []string{StageEcho, StageNoise, StageAGC, "custom"}, s.Processors().Names())
+	assert.NotNil(t, s.echoCanceller())
+	assert.NotNil(t, s.AGC())
+	_, ok := s.noiseReduction()
+	assert.True(t, ok)
+
+	// Replacing keeps the position, nil removes
+	s.SetNoiseSuppressor(NewSpectralSubtractor(SpectralOptions{}))
+	s.SetEchoCanceller(nil)
+	s.SetAGC(nil)
+	assert.Equal(t, []string{StageNoise, "custom"}, s.Processors().Names())
+	assert.Nil(t, s.echoCanceller())
+	assert.Nil(t, s.AGC())
+}
@@ -0,0 +1,241 @@
+package voxaudio
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// QueueOptions configures the queue of outbound client events
+type QueueOptions struct {
+	MaxBuffered   uint64        // Hold messages while the data channel buffers more bytes than this, default 256 KiB
+	MaxAudio      int           // Audio messages held before the oldest is dropped, default 500
+	WaitForConfig bool          // Hold audio until the server confirms the configuration with session.updated
+	ConfigTimeout time.Duration // Stream audio anyway when the confirmation takes longer, default 5s
+}
+
+func (o QueueOptions) withDefaults() QueueOptions {
+	if o.MaxBuffered == 0 {
+		o.MaxBuffered = 256 << 10
+	}
+	if o.MaxAudio <= 0 {
+		o.MaxAudio = 500
+	}
+	if o.ConfigTimeout <= 0 {
+		o.ConfigTimeout = 5 * time.Second
+	}
+	return o
+}
+
+type outboundKind int
+
+const (
+	outboundControl outboundKind = iota
+	outboundConfig               // session.update, audio waits for it
+	outboundAudio
+)
+
+// outboundMessage is a client event waiting to be sent
+type outboundMessage struct {
+	text string
+	kind outboundKind
+	sent func(at time.Time) // Called once the message reached the data channel
+}
+
+// outboundChannel is the sending side of a data channel
+type outboundChannel interface {
+	ReadyState() webrtc.DataChannelState
+	BufferedAmount() uint64
+	SetBufferedAmountLowThreshold(threshold uint64)
+	OnBufferedAmountLow(f func())
+	SendText(text string) error
+}
+
+// outboundQueue holds client events until the data channel is open and can
+// take them. Messages are sent in order, except that audio waits until the
+// session configuration was sent (or confirmed, with WaitForConfig).
+type outboundQueue struct {
+	options QueueOptions
+	channel func() outboundChannel // Channel of the current connection, nil if none
+	logSent func(text string, at time.Time)
+
+	flushMu sync.Mutex // Held while sending so the order is kept
+
+	mu         sync.Mutex
+	pending    []outboundMessage
+	audio      int  // Audio messages in pending
+	configured bool // Audio may be sent
+	dropped    int  // Audio messages dropped because the queue was full
+	watched    outboundChannel
+}
+
+func newOutboundQueue(options QueueOptions, channel func() outboundChannel, logSent func(string, time.Time)) *outboundQueue {
+	return &outboundQueue{options: options.withDefaults(), channel: channel, logSent: logSent}
+}
+
+// push queues a message and sends what the channel can take. When too much
+// audio is waiting, the oldest audio is dropped so the input stays current.
+func (q *outboundQueue) push(msg outboundMessage) {
+	q.mu.Lock()
+	if msg.kind == outboundAudio {
+		i := slices.IndexFunc(q.pending, func(m outboundMessage) bool { return m.kind == outboundAudio })
+		if q.audio >= q.options.MaxAudio && i >= 0 {
+			q.pending = slices.Delete(q.pending, i, i+1)
+			q.audio--
+			if q.dropped == 0 {
+				fmt.Println("[DataChannel] Outbound queue full, dropping the oldest audio")
+			}
+			q.dropped++
+		}
+		q.audio++
+	}
+	q.pending = append(q.pending, msg)
+	q.mu.Unlock()
+	q.flush()
+}
+
+// flush sends the queued messages until the queue is empty, the channel is
+// not open or buffers too much. It is called again when the buffer drains.
+func (q *outboundQueue) flush() {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+	for {
+		dc := q.channel()
+		if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+			return
+		}
+		q.watch(dc)
+		if dc.BufferedAmount() > q.options.MaxBuffered {
+			return
+		}
+
+		q.mu.Lock()
+		i := slices.IndexFunc(q.pending, func(m outboundMessage) bool {
+			return m.kind != outboundAudio || q.configured
+		})
+		if i < 0 {
+			q.mu.Unlock()
+			return
+		}
+		msg := q.pending[i]
+		q.pending = slices.Delete(q.pending, i, i+1)
+		if msg.kind == outboundAudio {
+			q.audio-- // Counted while in pending, a push during the send sees the right count
+		}
+		q.mu.Unlock()
+
+		if err := dc.SendText(msg.text); err != nil {
+			fmt.Printf("[DataChannel] Failed to send message: %v\n", err)
+			q.mu.Lock()
+			q.pending = slices.Insert(q.pending, min(i, len(q.pending)), msg)
+			if msg.kind == outboundAudio {
+				q.audio++
+			}
+			q.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		if msg.kind == outboundConfig {
+			q.mu.Lock()
+			q.configSent()
+			q.mu.Unlock()
+		}
+		if q.logSent != nil {
+			q.logSent(msg.text, now)
+		}
+		if msg.sent != nil {
+			msg.sent(now)
+		}
+	}
+}
+
+// watch resumes sending when the buffer of a new channel drains
+func (q *outboundQueue) watch(dc outboundChannel) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.watched == dc {
+		return
+	}
+	q.watched = dc
+	dc.SetBufferedAmountLowThreshold(q.options.MaxBuffered / 2)
+	dc.OnBufferedAmountLow(func() { go q.flush() })
+}
+
+// configSent releases the audio once the configuration was sent, or starts
+// waiting for its confirmation; q.mu must be held
+func (q *outboundQueue) configSent() {
+	if q.configured {
+		return
+	}
+	if !q.options.WaitForConfig {
+		q.configured = true
+		return
+	}
+	timeout := q.options.ConfigTimeout
+	time.AfterFunc(timeout, func() {
+		if q.confirm() {
+			fmt.Printf("[Session] No session.updated after %v, streaming audio anyway\n", timeout)
+		}
+	})
+}
+
+// confirm releases the audio; false if it already was
+func (q *outboundQueue) confirm() bool {
+	q.mu.Lock()
+	released := !q.configured
+	q.configured = true
+	q.mu.Unlock()
+	if released {
+		q.flush()
+	}
+	return released
+}
+
+// queued returns the number of messages waiting and audio messages dropped
+func (q *outboundQueue) queued() (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), q.dropped
+}
+
+// SetQueueOptions configures the queue of outbound events
+// Note: Must be called before Start
+func (s *Session) SetQueueOptions(options QueueOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueOptions = options
+	s.queue = nil
+}
+
+// outbound returns the queue of outbound events
+func (s *Session) outbound() *outboundQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue == nil {
+		s.queue = newOutboundQueue(s.queueOptions, s.outboundChannel, s.logOutbound)
+	}
+	return s.queue
+}
+
+func (s *Session) outboundChannel() outboundChannel {
+	if dc := s.channel(); dc != nil {
+		return dc
+	}
+	return nil
+}
+
+// confirmConfig releases the queued audio when the server confirms the configuration
+func (s *Session) confirmConfig(evt ServerEvent) {
+	if evt.Type != EventSessionUpdated {
+		return
+	}
+	s.mu.Lock()
+	q := s.queue
+	s.mu.Unlock()
+	if q != nil {
+		q.confirm()
+	}
+}
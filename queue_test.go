@@ -0,0 +1,170 @@
+package voxaudio
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChannel records the sent messages. The buffered amount is set by the test.
+type fakeChannel struct {
+	mu        sync.Mutex
+	state     webrtc.DataChannelState
+	buffered  uint64
+	threshold uint64
+	low       func()
+	sent      []string
+	sending   func(text string) // Called before a message is sent, may block
+}
+
+func (c *fakeChannel) ReadyState() webrtc.DataChannelState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *fakeChannel) BufferedAmount() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buffered
+}
+
+func (c *fakeChannel) SetBufferedAmountLowThreshold(threshold uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.threshold = threshold
+}
+
+func (c *fakeChannel) OnBufferedAmountLow(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.low = f
+}
+
+func (c *fakeChannel) SendText(text string) error {
+	if c.sending != nil {
+		c.sending(text)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, text)
+	return nil
+}
+
+func (c *fakeChannel) set(state webrtc.DataChannelState, buffered uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state, c.buffered = state, buffered
+}
+
+func (c *fakeChannel) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+func newFakeQueue(options QueueOptions) (*outboundQueue, *fakeChannel) {
+	dc := &fakeChannel{state: webrtc.DataChannelStateConnecting}
+	return newOutboundQueue(options, func() outboundChannel { return dc }, nil), dc
+}
+
+func TestOutboundQueueOrder(t *testing.T) {
+	q, dc := newFakeQueue(QueueOptions{})
+	var sentAt []string
+	q.push(outboundMessage{text: "audio 1", kind: outboundAudio, sent: func(time.Time) { sentAt = append(sentAt, "audio 1") }})
+	q.push(outboundMessage{text: "audio 2", kind: outboundAudio})
+	assert.Empty(t, dc.messages(), "held until the channel opens")
+
+	// Audio waits for the configuration, other events are sent
+	dc.set(webrtc.DataChannelStateOpen, 0)
+	q.push(outboundMessage{text: "cancel", kind: outboundControl})
+	assert.Equal(t, []string{"cancel"}, dc.messages())
+	q.push(outboundMessage{text: "config", kind: outboundConfig})
+	q.push(outboundMessage{text: "audio 3", kind: outboundAudio})
+	assert.Equal(t, []string{"cancel", "config", "audio 1", "audio 2", "audio 3"}, dc.messages())
+	assert.Equal(t, []string{"audio 1"}, sentAt)
+}
+
+func TestOutboundQueueBackpressure(t *testing.T) {
+	q, dc := newFakeQueue(QueueOptions{MaxBuffered: 1000, MaxAudio: 3})
+	dc.set(webrtc.DataChannelStateOpen, 0)
+	q.push(outboundMessage{text: "config", kind: outboundConfig})
+	assert.Equal(t, uint64(500), dc.threshold)
+
+	dc.set(webrtc.DataChannelStateOpen, 1500)
+	for _, text := range []string{"audio 1", "audio 2", "audio 3", "audio 4"} {
+		q.push(outboundMessage{text: text, kind: outboundAudio})
+	}
+	assert.Equal(t, []string{"config"}, dc.messages())
+	queued, dropped := q.queued()
+	assert.Equal(t, 3, queued)
+	assert.Equal(t, 1, dropped, "the oldest audio is dropped")
+
+	// Sending resumes when the buffer drains
+	dc.set(webrtc.DataChannelStateOpen, 400)
+	dc.low()
+	require.Eventually(t, func() bool { return len(dc.messages()) == 4 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"config", "audio 2", "audio 3", "audio 4"}, dc.messages())
+}
+
+func TestOutboundQueuePushWhileSending(t *testing.T) {
+	q, dc := newFakeQueue(QueueOptions{MaxAudio: 1})
+	dc.set(webrtc.DataChannelStateOpen, 0)
+	q.push(outboundMessage{text: "config", kind: outboundConfig})
+
+	// Audio pushed while the only queued audio is being sent is not dropped
+	sending, release := make(chan struct{}), make(chan struct{})
+	dc.sending = func(text string) {
+		if text == "audio 1" {
+			close(sending)
+			<-release
+		}
+	}
+	go q.push(outboundMessage{text: "audio 1", kind: outboundAudio})
+	<-sending
+	pushed := make(chan struct{})
+	go func() {
+		q.push(outboundMessage{text: "audio 2", kind: outboundAudio})
+		close(pushed)
+	}()
+	require.Eventually(t, func() bool { queued, _ := q.queued(); return queued == 1 }, time.Second, time.Millisecond)
+	close(release)
+	<-pushed
+
+	require.Eventually(t, func() bool { return len(dc.messages()) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"config", "audio 1", "audio 2"}, dc.messages())
+	_, dropped := q.queued()
+	assert.Zero(t, dropped)
+}
+
+func TestOutboundQueueWaitForConfig(t *testing.T) {
+	q, dc := newFakeQueue(QueueOptions{WaitForConfig: true})
+	dc.set(webrtc.DataChannelStateOpen, 0)
+	q.push(outboundMessage{text: "config", kind: outboundConfig})
+	q.push(outboundMessage{text: "audio", kind: outboundAudio})
+	assert.Equal(t, []string{"config"}, dc.messages())
+	assert.True(t, q.confirm())
+	assert.Equal(t, []string{"config", "audio"}, dc.messages())
+	assert.False(t, q.confirm())
+
+	// Without a confirmation the audio is released after the timeout
+	q, dc = newFakeQueue(QueueOptions{WaitForConfig: true, ConfigTimeout: 10 * time.Millisecond})
+	dc.set(webrtc.DataChannelStateOpen, 0)
+	q.push(outboundMessage{text: "config", kind: outboundConfig})
+	q.push(outboundMessage{text: "audio", kind: outboundAudio})
+	require.Eventually(t, func() bool { return len(dc.messages()) == 2 }, time.Second, time.Millisecond)
+}
+
+func TestSessionUpdatedReleasesAudio(t *testing.T) {
+	dc := &fakeChannel{state: webrtc.DataChannelStateOpen}
+	s := &Session{}
+	s.queue = newOutboundQueue(QueueOptions{WaitForConfig: true}, func() outboundChannel { return dc }, nil)
+	s.queue.push(outboundMessage{text: "config", kind: outboundConfig})
+	s.queue.push(outboundMessage{text: "audio", kind: outboundAudio})
+	dispatchAt(t, s, time.Now(), `{"type":"session.updated","session":{}}`)
+	assert.Equal(t, []string{"config", "audio"}, dc.messages())
+}
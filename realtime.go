@@ -2,8 +2,8 @@ package voxaudio
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,12 +11,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ebitengine/oto/v3"
-	"github.com/gordonklaus/portaudio"
 	"github.com/hraban/opus"
 	"github.com/pion/webrtc/v4"
+
+	"voxworld/wavfile"
 )
 
 // Session manages Loopback capture and Realtime WebRTC connection
@@ -24,24 +27,74 @@ type Session struct {
 	pc *webrtc.PeerConnection
 	dc *webrtc.DataChannel
 	// audioTrack   *webrtc.TrackLocalStaticSample
-	stopCh       chan struct{}
+	stopCh       chan struct{} // Closed when the session stops, never reset
+	done         chan struct{} // Closed once stopped and the tasks have finished
+	stopOnce     sync.Once
+	tasks        sync.WaitGroup // Track handlers and the upload, which save the recordings
 	model        string
 	ephemeralKey string
-	recorder     *LoopbackRecorder
+	recorder     AudioSource
 	systemPrompt string
 	targetLang   string
 	voice        string
-	audioDir     string // Directory for saving audio files
+	audioDir     string        // Directory for saving audio files
+	recordFormat RecordFormat  // Format used to save the translated audio
+	recordInput  bool          // Whether to also save the captured input as Ogg Opus
+	packetSinks  []PacketSink  // Additional receivers of the undecoded remote audio
+	backend      DeviceBackend // Audio devices for the BlackHole output, nil uses the default
+
+	transcriptionModel string // Model used to transcribe the input audio, empty disables
+	keepResponses      bool   // Do not cancel responses when new speech starts, guarded by mu
+	textOnly           bool   // Translate to text deltas without audio
+
+	mu             sync.Mutex
+	handlers       map[string][]EventHandler // Server event handlers by event type
+	inputStartedAt time.Time                 // When the first input audio was sent
+	messageLog     *MessageLog               // Optional log of the data channel traffic
+	latency        *latencyTracker           // Per-turn latency measurement
+	usage          *usageTracker             // Token usage, cost and budget
+	stopped        bool                      // Stop was called, no more tasks are counted
+	paused         bool                      // Input upload is paused
+	bargeIn        map[Output]bool           // Outputs interrupted by new speech
+	playbacks      []*playbackState          // Outputs playing the translation
+	outputLatency  map[Output]time.Duration  // Device latency overrides by output
+	responseItems  map[string]string         // Output item of each response not yet played
+	playingItem    string                    // Item whose audio is being received
+	serverPlaying  bool                      // The server is sending response audio
+	tools          map[string]Tool           // Functions the model can call by name
+	toolResponses  map[string]*toolResponse  // Responses with running tool calls
+	toolHandlers   []func(ToolCall)          // Tool call observers
+	keys           KeyProvider               // Supplies connection keys, nil uses ephemeralKey
+	sender         func(msg string) error    // Replaces the data channel during replay
+	trackHandler   func(RTPReader) error     // Plays the remote audio, see handleTracks
+	output         *rotatingTrack            // Remote audio being played
+	responses      int                       // Responses in progress
+	speaking       bool                      // The speaker is talking
+	history        []historyMessage          // Recent transcripts replayed after a rotation
+	rotation       RotationOptions
+	rotating       bool
+	queue          *outboundQueue // Client events waiting for the data channel
+	queueOptions   QueueOptions
+	preRoll        PreRollOptions  // Audio kept before the data channel opens
+	processors     *Chain          // Processes the input before upload, see Processors
+	outputs        *Chain          // Processes the decoded remote audio, see OutputProcessors
+	voiceOver      *VoiceOverMixer // Mixes the input under the translation, nil disables
+	uploaded       int64           // Input samples sent so far
+	inputBaseMs    int64           // Input position where the current connection started
+	uploadedMs     atomic.Int64    // Input audio sent so far
 }
 
 const (
-	realtime_url  = "https://api.openai.com/v1/realtime"
-	sampleRate    = 48000
-	channels      = 1
-	frameSize     = 960
-	opusFrameSize = 960     // 20ms @ 48kHz
-	maxDataBytes  = 1000    // Large enough buffer for Opus encoded data
-	defaultVoice  = "alloy" // Default voice
+	realtime_url    = "https://api.openai.com/v1/realtime"
+	sampleRate      = 48000
+	channels        = 1
+	frameSize       = 960
+	inputSampleRate = 24000   // Sample rate of the PCM16 audio uploaded over the data channel
+	opusFrameSize   = 960     // 20ms @ 48kHz
+	maxDataBytes    = 1000    // Large enough buffer for Opus encoded data
+	defaultVoice    = "alloy" // Default voice
+
+	defaultTranscriptionModel = "whisper-1"
 )
 
 // SessionConfig configures session parameters
@@ -68,6 +121,38 @@ func NewSession(ephemeralKey, model, targetLang, voice string) (*Session, error)
 		return nil, fmt.Errorf("failed to create audio save directory: %w", err)
 	}
 
+	pc, dc, err := newPeerConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize LoopbackRecorder
+	recorder, err := NewLoopbackRecorder()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize audio capturer: %w", err)
+	}
+
+	session := &Session{
+		pc:           pc,
+		dc:           dc,
+		stopCh:       make(chan struct{}),
+		ephemeralKey: ephemeralKey,
+		model:        model,
+		recorder:     recorder,
+		voice:        voice,
+		targetLang:   targetLang,
+		audioDir:     audioDir,
+		latency:      newLatencyTracker(),
+		usage:        newUsageTracker(model),
+		bargeIn:      map[Output]bool{OutputSpeaker: true, OutputBlackHole: true},
+	}
+	dc.OnMessage(session.handleMessage)
+	return session, nil
+}
+
+// newPeerConnection creates a PeerConnection with the audio track and the
+// events data channel of the Realtime API
+func newPeerConnection() (*webrtc.PeerConnection, *webrtc.DataChannel, error) {
 	// 1. PeerConnection
 	config := webrtc.Configuration{
 		ICEServers: []webrtc.ICEServer{
@@ -89,7 +174,7 @@ func NewSession(ephemeralKey, model, targetLang, voice string) (*Session, error)
 	}
 	pc, err := webrtc.NewPeerConnection(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// 2. Audio Track
 	track, err := webrtc.NewTrackLocalStaticSample(
@@ -97,34 +182,20 @@ func NewSession(ephemeralKey, model, targetLang, voice string) (*Session, error)
 		"audio", "pion",
 	)
 	if err != nil {
-		return nil, err
+		_ = pc.Close()
+		return nil, nil, err
 	}
 	if _, err := pc.AddTrack(track); err != nil {
-		return nil, err
+		_ = pc.Close()
+		return nil, nil, err
 	}
 	// 3. DataChannel
 	dc, err := pc.CreateDataChannel("oai-events", nil)
 	if err != nil {
-		return nil, err
+		_ = pc.Close()
+		return nil, nil, err
 	}
-
-	// 4. Initialize LoopbackRecorder
-	recorder, err := NewLoopbackRecorder()
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize audio capturer: %w", err)
-	}
-
-	return &Session{
-		pc:           pc,
-		dc:           dc,
-		stopCh:       make(chan struct{}),
-		ephemeralKey: ephemeralKey,
-		model:        model,
-		recorder:     recorder,
-		voice:        voice,
-		targetLang:   targetLang,
-		audioDir:     audioDir,
-	}, nil
+	return pc, dc, nil
 }
 
 // Build default translation prompt
@@ -158,19 +229,32 @@ func (s *Session) Conn() error {
 		fmt.Println("[DataChannel] Closed")
 	})
 
+	return s.connect(s.pc)
+}
+
+// connect negotiates pc with the Realtime API using a key from the key provider
+func (s *Session) connect(pc *webrtc.PeerConnection) error {
 	// Create offer
-	offer, err := s.pc.CreateOffer(nil)
+	offer, err := pc.CreateOffer(nil)
 	if err != nil {
 		return fmt.Errorf("failed to create offer: %w", err)
 	}
 
 	// Set local description
-	if err := s.pc.SetLocalDescription(offer); err != nil {
+	if err := pc.SetLocalDescription(offer); err != nil {
 		return fmt.Errorf("failed to set local description: %w", err)
 	}
 
 	fmt.Println("[WebRTC] Local SDP set, sending to OpenAI...")
 
+	// Get a key for this connection
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	key, err := s.connectionKey(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Request WebRTC answer
 	url := realtime_url
 	req, err := http.NewRequest("POST", fmt.Sprintf("%s?model=%s", url, s.model), bytes.NewReader([]byte(offer.SDP)))
@@ -178,7 +262,7 @@ func (s *Session) Conn() error {
 		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.ephemeralKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	req.Header.Set("Content-Type", "application/sdp")
 
 	// Set longer timeout
@@ -201,7 +285,7 @@ func (s *Session) Conn() error {
 	fmt.Println("[WebRTC] Received OpenAI SDP answer, setting remote description...")
 
 	// Set remote description
-	if err := s.pc.SetRemoteDescription(
+	if err := pc.SetRemoteDescription(
 		webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: string(ansSDP)},
 	); err != nil {
 		return fmt.Errorf("failed to set remote description: %w", err)
@@ -213,14 +297,11 @@ func (s *Session) Conn() error {
 }
 
 func (s *Session) RegisterLocalTrack() {
-	s.pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		if track.Kind() == webrtc.RTPCodecTypeAudio {
-			go s.localTrack(track)
-		}
-	})
+	s.handleTracks(s.localTrack)
 }
 
-func (s *Session) localTrack(track *webrtc.TrackRemote) error {
+// localTrack plays the remote audio on the default output device
+func (s *Session) localTrack(track RTPReader) error {
 	// Create Opus decoder
 	decoder, err := opus.NewDecoder(sampleRate, channels)
 	if err != nil {
@@ -238,13 +319,24 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 	}
 	<-ready
 
-	// Create audio buffer
-	audioBuffer := bytes.NewBuffer(make([]byte, 0, 1024*1024))
+	// Create audio buffer, the played audio is the echo reference
+	audioBuffer := &playbackBuffer{}
+	if ec := s.echoCanceller(); ec != nil {
+		audioBuffer.tap = echoReference(ec)
+	}
 
 	// Create player
 	player := ctx.NewPlayer(audioBuffer)
 	defer player.Close()
 
+	// Follow the played items; seeking drops the queued audio
+	playback := s.addPlayback(OutputSpeaker, defaultSpeakerLatency, func() int64 {
+		return int64(audioBuffer.Len()+player.BufferedSize()) / (2 * channels)
+	}, func() {
+		_, _ = player.Seek(0, io.SeekEnd)
+	})
+	defer s.removePlayback(playback)
+
 	// Start playback
 	player.Play()
 
@@ -252,26 +344,80 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 	pcm := make([]int16, frameSize)      // Decoded PCM data
 	samples := make([]byte, frameSize*2) // Temporary buffer for conversion
 
-	// Create audio file
+	// Create audio file in the configured format
 	timestamp := time.Now().Format("20060102-150405")
-	audioFileName := filepath.Join(s.audioDir, fmt.Sprintf("openai-audio-%s.wav", timestamp))
-	audioFile, err := os.Create(audioFileName)
-	if err != nil {
-		fmt.Printf("[Audio] Failed to create audio file: %v\n", err)
-		// Continue execution even if file creation fails
-	} else {
-		defer audioFile.Close()
-		// Write WAV file header
-		writeWavHeader(audioFile, sampleRate, 1, 16)
-		fmt.Printf("[Audio] Starting to save audio to file: %s\n", audioFileName)
+	var audioFile *wavfile.Writer
+	var oggSink *OggOpusSink
+	var oggEncoder *OggOpusEncoder // Used instead of oggSink when the output is processed
+	switch s.recordFormat {
+	case RecordWAV:
+		audioFileName := filepath.Join(s.audioDir, fmt.Sprintf("openai-audio-%s.wav", timestamp))
+		audioFile, err = wavfile.Create(audioFileName, wavfile.Format{
+			SampleRate:   sampleRate,
+			Channels:     channels,
+			SampleFormat: wavfile.PCM16,
+		})
+		if err != nil {
+			fmt.Printf("[Audio] Failed to create audio file: %v\n", err)
+			// Continue execution even if file creation fails
+		} else {
+			// Keep the header current so the file stays playable if the process dies
+			audioFile.SetUpdateInterval(time.Second)
+			fmt.Printf("[Audio] Starting to save audio to file: %s\n", audioFileName)
+		}
+	case RecordOggOpus:
+		audioFileName := filepath.Join(s.audioDir, fmt.Sprintf("openai-audio-%s.opus", timestamp))
+		if s.OutputProcessors().Len() > 0 {
+			// The packets carry the unprocessed audio, encode the processed audio again
+			oggEncoder, err = NewOggOpusEncoder(audioFileName, sampleRate, channels)
+		} else {
+			oggSink, err = NewOggOpusSink(audioFileName)
+		}
+		if err != nil {
+			fmt.Printf("[Audio] Failed to create audio file: %v\n", err)
+		} else {
+			fmt.Printf("[Audio] Starting to save Opus audio to file: %s\n", audioFileName)
+		}
+	}
+
+	// Receivers of the undecoded packets
+	sinks := append([]PacketSink(nil), s.packetSinks...)
+	if oggSink != nil {
+		sinks = append(sinks, oggSink)
+	}
+
+	// Finalize recordings before exiting
+	var hasSoundData bool // Record whether valid audio data is received
+	saveRecordings := func() {
+		// Update data size in WAV file header
+		if audioFile != nil {
+			if err := audioFile.Close(); err != nil {
+				fmt.Printf("[Audio] Failed to finalize audio file: %v\n", err)
+			}
+			fmt.Printf("[Audio] Saved %.2f seconds of audio to file (valid audio: %v)\n",
+				audioFile.Duration().Seconds(), hasSoundData)
+		}
+		if oggSink != nil {
+			if err := oggSink.Close(); err != nil {
+				fmt.Printf("[Audio] Failed to finalize Opus audio file: %v\n", err)
+			}
+			fmt.Printf("[Audio] Saved %.2f seconds of Opus audio to file\n", oggSink.Seconds())
+		}
+		if oggEncoder != nil {
+			if err := oggEncoder.Close(); err != nil {
+				fmt.Printf("[Audio] Failed to finalize Opus audio file: %v\n", err)
+			}
+			fmt.Printf("[Audio] Saved %.2f seconds of Opus audio to file\n", oggEncoder.Seconds())
+		}
 	}
 
 	// Add local stop signal
 	done := make(chan struct{})
 
 	// Listen for session stop signal to ensure exit this goroutine when session ends
+	stopCh := s.stopSignal()
 	go func() {
-		<-s.stopCh
+		<-stopCh
 		close(done)
 	}()
 
@@ -279,18 +425,11 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 
 	var packetCount int
 	lastLog := time.Now()
-	var totalAudioBytes int64
-	var hasSoundData bool // Record whether valid audio data is received
 
 	for {
 		select {
 		case <-done:
-			// Update data size in WAV file header before exiting
-			if audioFile != nil {
-				updateWavHeader(audioFile, totalAudioBytes)
-				fmt.Printf("[Audio] Saved %.2f seconds of audio to file (valid audio: %v)\n",
-					float64(totalAudioBytes)/float64(sampleRate*2), hasSoundData)
-			}
+			saveRecordings()
 			return nil // Graceful exit
 		default:
 			// Read RTP packet
@@ -298,11 +437,7 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 			if err != nil {
 				// Check if it's due to connection closure (EOF) or other serious error
 				if err == io.EOF || strings.Contains(err.Error(), "closed") {
-					if audioFile != nil {
-						updateWavHeader(audioFile, totalAudioBytes)
-						fmt.Printf("[Audio] Saved %.2f seconds of audio to file (valid audio: %v)\n",
-							float64(totalAudioBytes)/float64(sampleRate*2), hasSoundData)
-					}
+					saveRecordings()
 					return nil // Connection closed, exit directly
 				}
 				// Other temporarily error, continue to try
@@ -314,6 +449,13 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 				fmt.Printf("[Audio] First time receiving audio packet, answer length: %d bytes\n", len(rtp.Payload))
 			}
 
+			// Pass the undecoded packet to the packet sinks
+			for _, sink := range sinks {
+				if err := sink.WriteRTP(rtp); err != nil {
+					fmt.Printf("[Audio] Failed to save audio packet: %v\n", err)
+				}
+			}
+
 			// Decode Opus data
 			n, err := decoder.Decode(rtp.Payload, pcm)
 			if err != nil {
@@ -322,7 +464,8 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 				continue
 			}
 
-			// Copy decoded data to playback buffer
+			// Run the output processors and copy decoded data to playback buffer
+			s.processOutput(pcm[:n])
 			copy(buffer, pcm[:n])
 
 			// Check if it's valid audio (not all 0 or close to 0)
@@ -335,22 +478,38 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 				}
 			}
 
+			// The first audible packet of a response ends its latency measurement
+			if hasSound {
+				buffered := time.Duration(player.BufferedSize()/(2*channels)) * time.Second / sampleRate
+				s.latency.audioDecoded(time.Now(), buffered)
+			}
+
 			// Convert int16 data to byte sequence
 			for i := 0; i < n; i++ {
 				samples[i*2] = byte(buffer[i])
 				samples[i*2+1] = byte(buffer[i] >> 8)
 			}
 
-			// Write audio data to buffer
-			audioBuffer.Write(samples[:n*2])
+			// Write audio data to buffer unless its item was interrupted
+			if itemID := s.outputItem(); !playback.discard(itemID) {
+				playback.queue(n, hasSound, itemID)
+				audioBuffer.Write(samples[:n*2])
+				s.mixTranslation(buffer[:n])
+			}
 
 			// Save audio data to file
 			if audioFile != nil {
-				bytesWritten, err := audioFile.Write(samples[:n*2])
-				if err != nil {
+				if _, err := audioFile.Write(samples[:n*2]); err != nil {
+					fmt.Printf("[Audio] Failed to save audio data: %v\n", err)
+				}
+			}
+			if oggEncoder != nil {
+				processed := make([]float32, n)
+				for i, v := range buffer[:n] {
+					processed[i] = float32(v) / 32767.0
+				}
+				if err := oggEncoder.WriteFloat32(processed); err != nil {
 					fmt.Printf("[Audio] Failed to save audio data: %v\n", err)
-				} else {
-					totalAudioBytes += int64(bytesWritten)
 				}
 			}
 
@@ -365,6 +524,9 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 				} else {
 					soundStatus = " (no sound)"
 				}
+				if normalizer := s.loudnessNormalizer(); normalizer != nil {
+					soundStatus += fmt.Sprintf(", loudness %.1f LUFS, gain %+.1f dB", normalizer.Loudness(), normalizer.Gain())
+				}
 				fmt.Printf("[Audio] Played OpenAI audio packet: %d packets (about %.1f seconds of audio)%s\n",
 					packetCount, float64(packetCount*frameSize)/float64(sampleRate), soundStatus)
 				lastLog = time.Now()
@@ -373,114 +535,6 @@ func (s *Session) localTrack(track *webrtc.TrackRemote) error {
 	}
 }
 
-// Write WAV file header
-func writeWavHeader(file *os.File, sampleRate int, numChannels, bitsPerSample int) error {
-	// RIFF header
-	_, err := file.WriteString("RIFF")
-	if err != nil {
-		return err
-	}
-
-	// File size (will be updated before closing file)
-	err = binary.Write(file, binary.LittleEndian, uint32(0))
-	if err != nil {
-		return err
-	}
-
-	// WAVE format
-	_, err = file.WriteString("WAVE")
-	if err != nil {
-		return err
-	}
-
-	// fmt subchunk
-	_, err = file.WriteString("fmt ")
-	if err != nil {
-		return err
-	}
-
-	// Subchunk1 size
-	err = binary.Write(file, binary.LittleEndian, uint32(16))
-	if err != nil {
-		return err
-	}
-
-	// Audio format (PCM=1)
-	err = binary.Write(file, binary.LittleEndian, uint16(1))
-	if err != nil {
-		return err
-	}
-
-	// Number of channels
-	err = binary.Write(file, binary.LittleEndian, uint16(numChannels))
-	if err != nil {
-		return err
-	}
-
-	// Sample rate
-	err = binary.Write(file, binary.LittleEndian, uint32(sampleRate))
-	if err != nil {
-		return err
-	}
-
-	// Byte rate = SampleRate * NumChannels * BitsPerSample/8
-	err = binary.Write(file, binary.LittleEndian, uint32(sampleRate*numChannels*bitsPerSample/8))
-	if err != nil {
-		return err
-	}
-
-	// Block alignment = NumChannels * BitsPerSample/8
-	err = binary.Write(file, binary.LittleEndian, uint16(numChannels*bitsPerSample/8))
-	if err != nil {
-		return err
-	}
-
-	// Bit depth
-	err = binary.Write(file, binary.LittleEndian, uint16(bitsPerSample))
-	if err != nil {
-		return err
-	}
-
-	// Data subchunk
-	_, err = file.WriteString("data")
-	if err != nil {
-		return err
-	}
-
-	// Subchunk2 size (will be updated before closing file)
-	err = binary.Write(file, binary.LittleEndian, uint32(0))
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Update WAV file header with size information
-func updateWavHeader(file *os.File, dataSize int64) error {
-	// Update data subchunk size
-	_, err := file.Seek(40, 0)
-	if err != nil {
-		return err
-	}
-	err = binary.Write(file, binary.LittleEndian, uint32(dataSize))
-	if err != nil {
-		return err
-	}
-
-	// Update RIFF chunk size (file total size minus 8-byte RIFF header)
-	_, err = file.Seek(4, 0)
-	if err != nil {
-		return err
-	}
-	err = binary.Write(file, binary.LittleEndian, uint32(dataSize+36)) // 36 = Standard WAV header size-8
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Start starts capturing and pushing audio
 func (s *Session) Start(deviceName string) error {
 	// First start device audio capture to ensure ready before data channel initialization
@@ -490,27 +544,63 @@ func (s *Session) Start(deviceName string) error {
 
 	fmt.Printf("[Audio] Starting to capture device audio: %s\n", deviceName)
 
+	// Input is uploaded as 24 kHz mono, reject formats that cannot be converted
+	inputRate, inputChannels := s.recorder.Format()
+	converter, err := newPCM16Converter(inputRate, inputChannels)
+	if err != nil {
+		s.recorder.Stop()
+		return fmt.Errorf("failed to start audio capture: %w", err)
+	}
+
+	// Optionally save the captured input as Ogg Opus
+	var inputFile *OggOpusEncoder
+	if s.recordInput {
+		timestamp := time.Now().Format("20060102-150405")
+		inputFileName := filepath.Join(s.audioDir, fmt.Sprintf("input-audio-%s.opus", timestamp))
+		inputFile, err = NewOggOpusEncoder(inputFileName, inputRate, inputChannels)
+		if err != nil {
+			fmt.Printf("[Audio] Failed to create input audio file: %v\n", err)
+		} else {
+			fmt.Printf("[Audio] Starting to save input audio to file: %s\n", inputFileName)
+		}
+	}
+
 	// Audio capture and push
-	go func() {
+	s.mu.Lock()
+	s.goTask(func() {
 		defer s.recorder.Stop()
+		if inputFile != nil {
+			defer func() {
+				if err := inputFile.Close(); err != nil {
+					fmt.Printf("[Audio] Failed to finalize input audio file: %v\n", err)
+				}
+				fmt.Printf("[Audio] Saved %.2f seconds of input audio to file\n", inputFile.Seconds())
+			}()
+		}
 
+		inputFormat := AudioFormat{SampleRate: inputRate, Channels: inputChannels}
+		s.mu.Lock()
+		preRoll := newPreRollBuffer(s.preRoll)
+		s.mu.Unlock()
 		var sampleCount int64
 		var bytesSent int64
 		lastLog := time.Now()
 		var hasSoundInput bool // Track whether sound input is detected
 		var soundLevel float32 // Record sound level
+		stopCh := s.stopSignal()
 
 		for {
 			select {
-			case <-s.stopCh:
+			case <-stopCh:
 				if !hasSoundInput {
 					fmt.Println("[Warning] No valid microphone audio input detected throughout the session")
 				}
 				return
-			case samples, ok := <-s.recorder.Samples:
+			case samples, ok := <-s.recorder.Audio():
 				if !ok {
 					return // Channel closed
 				}
+				received := time.Now()
 
 				// Detect sound level
 				soundLevel = 0
@@ -525,59 +615,81 @@ func (s *Session) Start(deviceName string) error {
 					hasSoundInput = true
 				}
 
-				// If data channel is not ready, skip sending
-				if s.dc == nil || s.dc.ReadyState() != webrtc.DataChannelStateOpen {
-					continue
+				// Save input audio regardless of the data channel state
+				if inputFile != nil {
+					if err := inputFile.WriteFloat32(samples); err != nil {
+						fmt.Printf("[Audio] Failed to save input audio: %v\n", err)
+					}
 				}
 
-				// Convert float32 samples to byte sequence
-				pcmBytes := make([]byte, len(samples)*2) // 16-bit PCM = 2 bytes/sample
-				for i, sample := range samples {
-					// Limit value to [-1.0, 1.0] range
-					if sample > 1.0 {
-						sample = 1.0
-					} else if sample < -1.0 {
-						sample = -1.0
-					}
+				// The voice-over keeps the original audible while paused too
+				s.mixOriginal(Frame{Samples: samples, Format: inputFormat, Captured: received})
 
-					// Convert to int16, then split into two bytes
-					sampleInt := int16(sample * 32767.0)   // Convert to int16 range
-					pcmBytes[i*2] = byte(sampleInt)        // Low byte
-					pcmBytes[i*2+1] = byte(sampleInt >> 8) // High byte
+				// Discard the input while the session is paused
+				if s.Paused() {
+					continue
 				}
 
-				// Base64 encode
-				audioB64 := base64.StdEncoding.EncodeToString(pcmBytes)
+				// Convert to 24 kHz mono and run the processors, removing the
+				// echo of the translation and the background noise, then to
+				// 16-bit PCM
+				mono := s.Processors().Process(converter.mono(samples), received)
+				pcmBytes := encodePCM16(mono)
+				frameSamples := int64(len(pcmBytes) / 2)
 
-				// Use input_audio_buffer.append for actual real-time audio stream
-				evt := map[string]interface{}{
-					"type":  "input_audio_buffer.append",
-					"audio": audioB64,
+				// Keep the audio captured while the connection is established
+				if dc := s.channel(); dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+					preRoll.add(pcmBytes, received)
+					continue
+				}
+				for _, chunk := range preRoll.drain(time.Now()) {
+					n, err := s.sendAudio(chunk.pcm, chunk.captured)
+					if err != nil {
+						fmt.Printf("[Audio] Failed to send pre-roll audio: %v\n", err)
+					}
+					sampleCount += int64(len(chunk.pcm) / 2)
+					bytesSent += int64(n)
 				}
 
-				msg, _ := json.Marshal(evt)
-				if err := s.dc.SendText(string(msg)); err != nil {
+				n, err := s.sendAudio(pcmBytes, received)
+				if err != nil {
 					fmt.Printf("[Audio] Failed to send audio data: %v\n", err)
 				}
 
 				// Update statistics
-				sampleCount += int64(len(samples))
-				bytesSent += int64(len(msg))
+				sampleCount += frameSamples
+				bytesSent += int64(n)
 
 				// Record log every second to avoid too many logs
 				if time.Since(lastLog) > time.Second {
-					durationSeconds := float64(sampleCount) / float64(sampleRate)
+					durationSeconds := float64(sampleCount) / float64(inputSampleRate)
 					soundStatus := "silent"
 					if soundLevel > 0 {
 						soundStatus = fmt.Sprintf("sound (level: %.2f)", soundLevel)
 					}
+					if ec := s.echoCanceller(); ec != nil {
+						soundStatus += fmt.Sprintf(", echo -%.1f dB", ec.Reduction())
+					}
+					if agc := s.AGC(); agc != nil {
+						soundStatus += fmt.Sprintf(", gain %+.1f dB", agc.Gain())
+					}
+					if reduction, ok := s.noiseReduction(); ok {
+						soundStatus += fmt.Sprintf(", noise -%.1f dB", reduction)
+					}
+					if stats := s.Processors().Stats(); len(stats) > 0 {
+						soundStatus += fmt.Sprintf(", processing %s", formatStageStats(stats))
+					}
+					if queued, _ := s.outbound().queued(); queued > 0 {
+						soundStatus += fmt.Sprintf(", %d messages queued", queued)
+					}
 					fmt.Printf("[Audio] Uploaded: %.1f seconds of audio (%d samples, %.2f KB) - %s\n",
 						durationSeconds, sampleCount, float64(bytesSent)/1024, soundStatus)
 					lastLog = time.Now()
 				}
 			}
 		}
-	}()
+	})
+	s.mu.Unlock()
 
 	// Register data channel open event handler
 	if s.dc.ReadyState() != webrtc.DataChannelStateOpen {
@@ -591,6 +703,14 @@ func (s *Session) Start(deviceName string) error {
 		s.initializeSession()
 	}
 
+	// Replace the connection before the server ends the session
+	s.mu.Lock()
+	rotateAfter := s.rotation.After
+	s.mu.Unlock()
+	if rotateAfter > 0 {
+		go s.rotateEvery(rotateAfter)
+	}
+
 	return nil
 }
 
@@ -601,6 +721,21 @@ func (s *Session) initializeSession() {
 	// No need to cancel response first because there may be no active response
 	// Just set system prompt directly
 
+	// Queued audio follows once the settings were sent
+	b, err := json.Marshal(s.sessionUpdate())
+	if err == nil {
+		err = s.send(string(b), outboundConfig, nil)
+	}
+	if err != nil {
+		fmt.Printf("[Session] Failed to send session settings: %v\n", err)
+	}
+
+	fmt.Printf("[Session] Sent session settings: voice=%s, target language=%s, sample rate=%d\n",
+		s.voice, s.targetLang, inputSampleRate)
+}
+
+// sessionUpdate builds the session.update event with the session configuration
+func (s *Session) sessionUpdate() map[string]interface{} {
 	// Set system prompt - Explicitly indicate translation and voice output
 	prompt := s.buildTranslationPrompt()
 	if prompt == "" {
@@ -612,49 +747,111 @@ func (s *Session) initializeSession() {
 		"voice":        s.voice,
 		"instructions": prompt,
 	}
-	evt := map[string]interface{}{"type": "session.update", "session": voiceSettings}
-	b, _ := json.Marshal(evt)
-	s.dc.SendText(string(b))
-
-	fmt.Printf("[Session] Sent session settings: voice=%s, target language=%s, sample rate=%d\n",
-		s.voice, s.targetLang, sampleRate)
-
-	// Wait for a short period to ensure settings take effect before sending audio
-	time.Sleep(100 * time.Millisecond)
+	if s.transcriptionModel != "" {
+		voiceSettings["input_audio_transcription"] = map[string]string{"model": s.transcriptionModel}
+	}
+	if s.textOnly {
+		voiceSettings["modalities"] = s.modalities()
+	}
+	if tools := s.toolDefinitions(); len(tools) > 0 {
+		voiceSettings["tools"] = tools
+		voiceSettings["tool_choice"] = "auto"
+	}
+	s.mu.Lock()
+	keepResponses := s.keepResponses
+	s.mu.Unlock()
+	if keepResponses {
+		voiceSettings["turn_detection"] = map[string]interface{}{"type": "server_vad", "interrupt_response": false}
+	}
+	return map[string]interface{}{"type": "session.update", "session": voiceSettings}
 }
 
 // Stop stops audio capture and WebRTC connection
+// Note: Safe to call more than once and from several goroutines, later calls
+// return once the first has finished
 func (s *Session) Stop() {
+	s.stopOnce.Do(s.stop)
+}
+
+func (s *Session) stop() {
 	// First close stop signal channel, this will trigger all goroutines to exit
-	if s.stopCh != nil {
-		close(s.stopCh)
-		s.stopCh = nil // Prevent multiple closures
-	}
+	close(s.signal(&s.stopCh))
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
 
 	// Close audio capture
 	if s.recorder != nil {
 		s.recorder.Stop()
 	}
 
+	s.mu.Lock()
+	pc, dc := s.pc, s.dc
+	s.mu.Unlock()
+
 	// Close data channel
-	if s.dc != nil && s.dc.ReadyState() == webrtc.DataChannelStateOpen {
+	if dc != nil && dc.ReadyState() == webrtc.DataChannelStateOpen {
 		// Try to send close message
 		closeMsg := map[string]string{"type": "response.cancel"}
 		if msgBytes, err := json.Marshal(closeMsg); err == nil {
 			// Ignore send error, try to do it
-			_ = s.dc.SendText(string(msgBytes))
+			_ = s.sendText(string(msgBytes))
 		}
 		// Close data channel
-		_ = s.dc.Close()
+		_ = dc.Close()
 	}
 
 	// Wait for a moment for the above operations to complete
 	time.Sleep(100 * time.Millisecond)
 
 	// Close PeerConnection
-	if s.pc != nil {
-		_ = s.pc.Close()
+	if pc != nil {
+		_ = pc.Close()
+	}
+
+	// The tracks end with the connection, then finalize their recordings
+	done := s.signal(&s.done)
+	go func() {
+		s.tasks.Wait()
+		close(done)
+	}()
+}
+
+// goTask runs fn in a goroutine that Done waits for, unless the session
+// already stopped
+// Note: The caller holds s.mu
+func (s *Session) goTask(fn func()) {
+	if s.stopped {
+		go fn()
+		return
+	}
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		fn()
+	}()
+}
+
+// Done returns a channel that is closed once the session has stopped, also
+// when it stopped itself because the budget ran out, and the tracks and the
+// input upload have saved their recordings
+func (s *Session) Done() <-chan struct{} {
+	return s.signal(&s.done)
+}
+
+// stopSignal returns the channel that is closed when the session stops
+func (s *Session) stopSignal() <-chan struct{} {
+	return s.signal(&s.stopCh)
+}
+
+// signal returns the channel *ch, creating it for sessions not made by NewSession
+func (s *Session) signal(ch *chan struct{}) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *ch == nil {
+		*ch = make(chan struct{})
 	}
+	return *ch
 }
 
 // SetTargetLanguage sets target translation language
@@ -672,24 +869,94 @@ func (s *Session) SetVoice(voice string) {
 	s.voice = voice
 }
 
+// SetRecordFormat sets how the translated audio is saved in the audio directory
+// Note: Takes effect for tracks received after the call
+func (s *Session) SetRecordFormat(format RecordFormat) {
+	s.recordFormat = format
+}
+
+// SetRecordInput enables saving the captured input audio as Ogg Opus
+// Note: Takes effect on the next call to Start
+func (s *Session) SetRecordInput(enabled bool) {
+	s.recordInput = enabled
+}
+
+// SetAudioSource replaces the loopback recorder as the source of input audio
+// Note: Must be called before Start
+func (s *Session) SetAudioSource(source AudioSource) {
+	s.recorder = source
+}
+
+// SetInputTranscription sets the model used to transcribe the input audio
+// Note: Takes effect on the next call to Start; an empty model disables transcription
+func (s *Session) SetInputTranscription(model string) {
+	s.transcriptionModel = model
+}
+
+// sendAudio queues captured 24 kHz PCM16 audio and returns the size of the event
+func (s *Session) sendAudio(pcm []byte, captured time.Time) (int, error) {
+	// Use input_audio_buffer.append for actual real-time audio stream
+	evt := map[string]interface{}{
+		"type":  "input_audio_buffer.append",
+		"audio": base64.StdEncoding.EncodeToString(pcm),
+	}
+	msg, err := json.Marshal(evt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode audio: %w", err)
+	}
+
+	// Queued until the data channel is open and the session configured
+	samples := int64(len(pcm) / 2)
+	return len(msg), s.send(string(msg), outboundAudio, func(at time.Time) {
+		s.audioSent(samples, captured, at)
+	})
+}
+
+// audioSent accounts for input audio that reached the data channel
+func (s *Session) audioSent(samples int64, captured, sent time.Time) {
+	s.mu.Lock()
+	if s.inputStartedAt.IsZero() {
+		s.inputStartedAt = sent
+	}
+	start := s.uploaded
+	s.uploaded += samples
+	s.mu.Unlock()
+
+	startMs := start * 1000 / inputSampleRate
+	endMs := (start + samples) * 1000 / inputSampleRate
+	s.latency.addInput(startMs, endMs, captured, sent)
+	s.uploadedMs.Store(endMs)
+}
+
+// inputStartTime returns when the first input audio was sent, or the zero time
+func (s *Session) inputStartTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inputStartedAt
+}
+
+// AddPacketSink registers a receiver for the undecoded Opus packets of the remote track
+// Note: The session does not close the sink, close it once the session stopped
+func (s *Session) AddPacketSink(sink PacketSink) {
+	s.packetSinks = append(s.packetSinks, sink)
+}
+
 // UpdateSessionSettings updates session settings, such as voice type
 // Note: This method is only effective when data channel is opened
 func (s *Session) UpdateSessionSettings() error {
-	if s.dc == nil || s.dc.ReadyState() != webrtc.DataChannelStateOpen {
+	if dc := s.channel(); dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
 		return fmt.Errorf("data channel not opened")
 	}
 
-	voiceSettings := map[string]string{"voice": s.voice}
+	voiceSettings := map[string]interface{}{"voice": s.voice, "modalities": s.modalities()}
 	evt := map[string]interface{}{"type": "session.update", "session": voiceSettings}
-	b, _ := json.Marshal(evt)
-	s.dc.SendText(string(b))
-	return nil
+	return s.sendEvent(evt)
 }
 
 // UpdateSystemPrompt updates system prompt
 // Note: This method is only effective when data channel is opened
 func (s *Session) UpdateSystemPrompt() error {
-	if s.dc == nil || s.dc.ReadyState() != webrtc.DataChannelStateOpen {
+	if dc := s.channel(); dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
 		return fmt.Errorf("data channel not opened")
 	}
 
@@ -705,20 +972,17 @@ func (s *Session) UpdateSystemPrompt() error {
 		},
 	}
 	promptJson, _ := json.Marshal(promptEvt)
-	s.dc.SendText(string(promptJson))
+	s.sendText(string(promptJson))
 	return nil
 }
 
 // RegisterBlackHoleTrack registers a handler to redirect audio to BlackHole virtual mic
 func (s *Session) RegisterBlackHoleTrack() {
-	s.pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-		if track.Kind() == webrtc.RTPCodecTypeAudio {
-			go s.blackHoleTrack(track)
-		}
-	})
+	s.handleTracks(s.blackHoleTrack)
 }
 
-func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
+// blackHoleTrack redirects the remote audio to the BlackHole virtual device
+func (s *Session) blackHoleTrack(track RTPReader) error {
 	// Create Opus decoder
 	decoder, err := opus.NewDecoder(sampleRate, channels)
 	if err != nil {
@@ -729,57 +993,44 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 	buffer := make([]int16, frameSize)
 	pcm := make([]int16, frameSize) // Decoded PCM data
 
-	// Use portaudio to output to BlackHole
-	if err := SafePortAudioInit(); err != nil {
-		fmt.Printf("[BlackHole] PortAudio initialization failed: %v\n", err)
+	// Use the device backend (PortAudio by default) to output to BlackHole
+	backend := s.deviceBackend()
+	if err := backend.Init(); err != nil {
+		fmt.Printf("[BlackHole] Audio backend initialization failed: %v\n", err)
 		return err
 	}
-	defer SafePortAudioTerminate()
+	defer backend.Terminate()
 
 	// Find BlackHole device
-	apis, err := portaudio.HostApis()
+	devices, err := backend.Devices()
 	if err != nil {
 		fmt.Printf("[BlackHole] Failed to get audio device: %v\n", err)
 		return err
 	}
 
 	// Find BlackHole output device
-	var outputDevice *portaudio.DeviceInfo
-	for _, api := range apis {
-		for _, dev := range api.Devices {
-			if dev.MaxOutputChannels > 0 && strings.Contains(dev.Name, "BlackHole") {
-				outputDevice = dev
-				fmt.Printf("[BlackHole] Found device: %s (output channels: %d, sample rate: %.0f)\n",
-					dev.Name, dev.MaxOutputChannels, dev.DefaultSampleRate)
-				break
-			}
-		}
-		if outputDevice != nil {
-			break
-		}
-	}
-
-	if outputDevice == nil {
+	outputDevice, ok := findOutputDevice(devices, "BlackHole")
+	if !ok {
 		fmt.Println("[BlackHole] No BlackHole device found, please ensure BlackHole 2ch is installed")
 		return fmt.Errorf("no BlackHole device found")
 	}
+	fmt.Printf("[BlackHole] Found device: %s (output channels: %d, sample rate: %.0f)\n",
+		outputDevice.Name, outputDevice.MaxOutputChannels, outputDevice.DefaultSampleRate)
 
 	// Create receive signal channel for coordinating concurrent access
 	audioDataChan := make(chan []float32, 8)
 
 	// Set output parameters
-	params := portaudio.StreamParameters{
-		Output: portaudio.StreamDeviceParameters{
-			Device:   outputDevice,
-			Channels: channels,
-			Latency:  10 * time.Millisecond, // 10ms latency
-		},
+	config := StreamConfig{
+		Device:          outputDevice,
+		Channels:        channels,
 		SampleRate:      float64(sampleRate),
 		FramesPerBuffer: frameSize,
+		Latency:         10 * time.Millisecond, // 10ms latency
 	}
 
 	// Create and start output stream
-	stream, err := portaudio.OpenStream(params, func(out []float32) {
+	stream, err := backend.OpenOutput(config, func(out []float32) {
 		select {
 		case newData := <-audioDataChan:
 			// Copy new data to output buffer
@@ -810,15 +1061,37 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 	}
 	defer stream.Stop()
 
+	// Follow the played items, preferring the latency the device reports
+	latency := config.Latency
+	if reporter, ok := stream.(LatencyReporter); ok {
+		latency = reporter.Latency()
+	}
+	playback := s.addPlayback(OutputBlackHole, latency, func() int64 {
+		return int64(len(audioDataChan) * frameSize)
+	}, func() {
+		for {
+			select {
+			case <-audioDataChan:
+			default:
+				return
+			}
+		}
+	})
+	defer s.removePlayback(playback)
+
 	// Add local stop signal
 	done := make(chan struct{})
 
 	// Listen for session stop signal to ensure exit this goroutine when session ends
+	stopCh := s.stopSignal()
 	go func() {
-		<-s.stopCh
+		<-stopCh
 		close(done)
 	}()
 
+	// Receivers of the undecoded packets
+	sinks := append([]PacketSink(nil), s.packetSinks...)
+
 	fmt.Println("[BlackHole] Starting to receive and redirect OpenAI audio to BlackHole 2ch...")
 
 	var packetCount int
@@ -847,6 +1120,13 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 				fmt.Printf("[BlackHole] First time receiving audio packet, answer length: %d bytes\n", len(rtp.Payload))
 			}
 
+			// Pass the undecoded packet to the packet sinks
+			for _, sink := range sinks {
+				if err := sink.WriteRTP(rtp); err != nil {
+					fmt.Printf("[BlackHole] Failed to save audio packet: %v\n", err)
+				}
+			}
+
 			// Decode Opus data
 			n, err := decoder.Decode(rtp.Payload, pcm)
 			if err != nil {
@@ -855,7 +1135,8 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 				continue
 			}
 
-			// Copy decoded data to playback buffer
+			// Run the output processors and copy decoded data to playback buffer
+			s.processOutput(pcm[:n])
 			copy(buffer, pcm[:n])
 
 			// Check if it's valid audio (not all 0 or close to 0)
@@ -868,6 +1149,12 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 				}
 			}
 
+			// The first audible packet of a response ends its latency measurement
+			if hasSound {
+				buffered := time.Duration(len(audioDataChan)*frameSize)*time.Second/sampleRate + config.Latency
+				s.latency.audioDecoded(time.Now(), buffered)
+			}
+
 			// Create new output buffer for PortAudio callback
 			newBuffer := make([]float32, n*channels)
 
@@ -882,12 +1169,15 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 				}
 			}
 
-			// Non-blocking send to audio channel
-			select {
-			case audioDataChan <- newBuffer:
-				// Successfully sent
-			default:
-				// Channel is full, discard current data to avoid blocking (only happens when processing too slow)
+			// Non-blocking send to audio channel unless its item was interrupted
+			if itemID := s.outputItem(); !playback.discard(itemID) {
+				s.mixTranslation(buffer[:n])
+				select {
+				case audioDataChan <- newBuffer:
+					playback.queue(n, hasSound, itemID)
+				default:
+					// Channel is full, discard current data to avoid blocking (only happens when processing too slow)
+				}
 			}
 
 			// Update packet count
@@ -901,6 +1191,9 @@ func (s *Session) blackHoleTrack(track *webrtc.TrackRemote) error {
 				} else {
 					soundStatus = " (no sound)"
 				}
+				if normalizer := s.loudnessNormalizer(); normalizer != nil {
+					soundStatus += fmt.Sprintf(", loudness %.1f LUFS, gain %+.1f dB", normalizer.Loudness(), normalizer.Gain())
+				}
 				fmt.Printf("[BlackHole] Redirect OpenAI audio packet: %d packets (about %.1f seconds of audio)%s\n",
 					packetCount, float64(packetCount*frameSize)/float64(sampleRate), soundStatus)
 				lastLog = time.Now()
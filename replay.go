@@ -0,0 +1,136 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ReplayOptions controls how a message log is replayed and verified
+type ReplayOptions struct {
+	IgnoreTypes    []string      // Client event types not verified, default input_audio_buffer.append
+	IgnoreFields   []string      // Top-level fields not verified, event_id is always ignored
+	SkipInitialize bool          // Do not send the session configuration before the first event
+	Settle         time.Duration // Wait for asynchronous sends after the last event
+}
+
+// ReplayDriver feeds the server events of a message log to a session's
+// event handlers and checks that the session answers with the same client
+// events. No connection is needed; the session's outbound messages are
+// captured instead of sent.
+type ReplayDriver struct {
+	session *Session
+	options ReplayOptions
+}
+
+// NewReplayDriver creates a driver for session
+func NewReplayDriver(session *Session, options ReplayOptions) *ReplayDriver {
+	if options.IgnoreTypes == nil {
+		options.IgnoreTypes = []string{"input_audio_buffer.append"}
+	}
+	options.IgnoreFields = append([]string{"event_id"}, options.IgnoreFields...)
+	return &ReplayDriver{session: session, options: options}
+}
+
+// Run replays the inbound messages with their original timestamps and
+// returns the resulting traffic: the inbound messages interleaved with the
+// outbound messages the session sent while handling them.
+func (d *ReplayDriver) Run(messages []LoggedMessage) ([]LoggedMessage, error) {
+	var mu sync.Mutex
+	var traffic []LoggedMessage
+	var now time.Time
+	if len(messages) > 0 {
+		now = messages[0].Time
+	}
+
+	s := d.session
+	s.mu.Lock()
+	prev := s.sender
+	s.sender = func(msg string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		traffic = append(traffic, LoggedMessage{Time: now, Direction: DirectionOutbound, Data: json.RawMessage(msg)})
+		return nil
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sender = prev
+		s.mu.Unlock()
+	}()
+
+	// The session configuration is sent when the data channel opens
+	if !d.options.SkipInitialize {
+		s.initializeSession()
+	}
+
+	for i, msg := range messages {
+		if msg.Direction != DirectionInbound {
+			continue
+		}
+		mu.Lock()
+		now = msg.Time
+		traffic = append(traffic, msg)
+		mu.Unlock()
+		if err := s.dispatchEvent(msg.Data, msg.Time); err != nil {
+			return traffic, fmt.Errorf("message %d: %w", i+1, err)
+		}
+	}
+	time.Sleep(d.options.Settle)
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]LoggedMessage(nil), traffic...), nil
+}
+
+// Verify replays messages and compares the outbound events with the
+// outbound events of the log, in order
+func (d *ReplayDriver) Verify(messages []LoggedMessage) error {
+	traffic, err := d.Run(messages)
+	if err != nil {
+		return err
+	}
+	want, err := d.outbound(messages)
+	if err != nil {
+		return fmt.Errorf("recorded traffic: %w", err)
+	}
+	got, err := d.outbound(traffic)
+	if err != nil {
+		return fmt.Errorf("replayed traffic: %w", err)
+	}
+
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return fmt.Errorf("outbound message %d missing: want %s", i+1, want[i])
+		case i >= len(want):
+			return fmt.Errorf("unexpected outbound message %d: %s", i+1, got[i])
+		case want[i] != got[i]:
+			return fmt.Errorf("outbound message %d differs:\nwant %s\n got %s", i+1, want[i], got[i])
+		}
+	}
+	return nil
+}
+
+// outbound returns the verified outbound events in canonical form
+func (d *ReplayDriver) outbound(messages []LoggedMessage) ([]string, error) {
+	var events []string
+	for i, msg := range messages {
+		if msg.Direction != DirectionOutbound || slices.Contains(d.options.IgnoreTypes, msg.Type()) {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(msg.Data, &fields); err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		for _, name := range d.options.IgnoreFields {
+			delete(fields, name)
+		}
+		// Maps are encoded with sorted keys, so equal events compare equal
+		canonical, _ := json.Marshal(fields)
+		events = append(events, string(canonical))
+	}
+	return events, nil
+}
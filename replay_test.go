@@ -0,0 +1,116 @@
+package voxaudio
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the outbound traffic of golden message logs")
+
+func TestMessageLogRecordsTraffic(t *testing.T) {
+	var buf bytes.Buffer
+	var sent []string
+	s := &Session{sender: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	s.SetMessageLog(NewMessageLog(&buf))
+
+	require.NoError(t, s.sendEvent(map[string]string{"type": "input_audio_buffer.append", "audio": "AAECAwQ="}))
+	s.handleMessage(webrtc.DataChannelMessage{IsString: true, Data: []byte(`{"type":"session.created"}`)})
+	s.handleMessage(webrtc.DataChannelMessage{IsString: false, Data: []byte{1, 2}})
+	s.handleMessage(webrtc.DataChannelMessage{IsString: true, Data: []byte(`not json`)})
+	s.SetMessageLog(nil)
+	require.NoError(t, s.sendText(`{"type":"response.cancel"}`))
+
+	messages, err := ReadMessageLog(&buf)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.Equal(t, DirectionOutbound, messages[0].Direction)
+	assert.JSONEq(t, `{"type":"input_audio_buffer.append","audio_bytes":5}`, string(messages[0].Data))
+	assert.Equal(t, DirectionInbound, messages[1].Direction)
+	assert.Equal(t, "session.created", messages[1].Type())
+	assert.WithinDuration(t, time.Now(), messages[1].Time, time.Minute)
+	assert.Equal(t, `"not json"`, string(messages[2].Data))
+
+	// The session still sent the full audio
+	assert.Len(t, sent, 2)
+	assert.Contains(t, sent[0], "AAECAwQ=")
+}
+
+func TestMessageLogIncludeAudio(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewMessageLog(&buf)
+	log.SetIncludeAudio(true)
+	log.record(DirectionOutbound, []byte(`{"type":"input_audio_buffer.append","audio":"AAAA"}`), time.Now())
+	assert.Contains(t, buf.String(), `"audio":"AAAA"`)
+	assert.NoError(t, log.Close())
+
+	_, err := ReadMessageLog(strings.NewReader("{\"dir\":\"in\"}\n{broken\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+// newReplaySession returns a session configured like the one that recorded the golden logs
+func newReplaySession() *Session {
+	return &Session{voice: "alloy", targetLang: "English", transcriptionModel: defaultTranscriptionModel}
+}
+
+func TestReplayGoldenTranslationTurn(t *testing.T) {
+	const golden = "testdata/translation_turn.jsonl"
+	messages, err := LoadMessageLog(golden)
+	require.NoError(t, err)
+
+	s := newReplaySession()
+	subs := NewSubtitleWriter(s, SubtitleOptions{})
+	subs.SetOrigin(time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC))
+	driver := NewReplayDriver(s, ReplayOptions{})
+
+	if *updateGolden {
+		traffic, err := driver.Run(messages)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		for _, msg := range traffic {
+			line, err := json.Marshal(msg)
+			require.NoError(t, err)
+			buf.Write(append(line, '\n'))
+		}
+		require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0644))
+		t.Skip("golden log updated")
+	}
+
+	require.NoError(t, driver.Verify(messages))
+
+	// The replayed events drive the handlers as in the live session
+	assert.Equal(t, []Cue{{Start: 4200 * time.Millisecond, End: 6100 * time.Millisecond, Text: "Good morning, everyone."}},
+		subs.TranslationCues())
+	assert.Equal(t, "Buenos días a todos.", subs.SourceCues()[0].Text)
+}
+
+func TestReplayVerifyReportsDifferences(t *testing.T) {
+	messages, err := LoadMessageLog("testdata/translation_turn.jsonl")
+	require.NoError(t, err)
+
+	// A different voice changes the session configuration
+	s := newReplaySession()
+	s.voice = "echo"
+	err = NewReplayDriver(s, ReplayOptions{}).Verify(messages)
+	assert.ErrorContains(t, err, "outbound message 1 differs")
+
+	// Ignoring the configuration makes it pass
+	err = NewReplayDriver(newReplaySession(), ReplayOptions{IgnoreTypes: []string{"session.update"}}).Verify(messages)
+	assert.NoError(t, err)
+
+	// Extra recorded outbound traffic is reported as missing
+	extra := append(messages, LoggedMessage{Direction: DirectionOutbound, Data: json.RawMessage(`{"type":"response.cancel"}`)})
+	err = NewReplayDriver(newReplaySession(), ReplayOptions{}).Verify(extra)
+	assert.ErrorContains(t, err, "missing")
+}
@@ -0,0 +1,110 @@
+package voxaudio
+
+import (
+	"fmt"
+	"math"
+)
+
+// linearResampler converts a mono stream between sample rates using linear
+// interpolation. It keeps state between calls so chunk boundaries are seamless.
+type linearResampler struct {
+	ratio float64 // Input samples per output sample
+	pos   float64 // Position of the next output sample in the current input chunk
+	last  float32 // Last input sample of the previous chunk (position -1)
+}
+
+// newLinearResampler panics unless both rates are positive, a zero rate would
+// never advance and grow the output forever
+// Note: Check rates reported by sources and frames before calling it
+func newLinearResampler(fromRate, toRate int) *linearResampler {
+	if fromRate <= 0 || toRate <= 0 {
+		panic(fmt.Sprintf("invalid sample rates: %d Hz to %d Hz", fromRate, toRate))
+	}
+	return &linearResampler{ratio: float64(fromRate) / float64(toRate)}
+}
+
+// process resamples one chunk of input. When the rates match the input is
+// returned unchanged.
+func (r *linearResampler) process(in []float32) []float32 {
+	if r.ratio == 1 || len(in) == 0 {
+		return in
+	}
+
+	out := make([]float32, 0, int(float64(len(in))/r.ratio)+1)
+	for {
+		i := int(math.Floor(r.pos))
+		if i+1 >= len(in) {
+			break
+		}
+		a := r.last
+		if i >= 0 {
+			a = in[i]
+		}
+		frac := float32(r.pos - float64(i))
+		out = append(out, a+(in[i+1]-a)*frac)
+		r.pos += r.ratio
+	}
+	r.pos -= float64(len(in))
+	r.last = in[len(in)-1]
+	return out
+}
+
+// downmix averages interleaved multichannel samples into a mono stream
+func downmix(samples []float32, channels int) []float32 {
+	if channels <= 1 {
+		return samples
+	}
+	out := make([]float32, len(samples)/channels)
+	for i := range out {
+		var sum float32
+		for c := 0; c < channels; c++ {
+			sum += samples[i*channels+c]
+		}
+		out[i] = sum / float32(channels)
+	}
+	return out
+}
+
+// pcm16Converter turns captured audio into the 24 kHz mono 16-bit PCM
+// expected by input_audio_buffer.append
+type pcm16Converter struct {
+	channels  int
+	resampler *linearResampler
+}
+
+func newPCM16Converter(inputRate, inputChannels int) (*pcm16Converter, error) {
+	if inputRate <= 0 || inputChannels <= 0 {
+		return nil, fmt.Errorf("invalid input format: %d Hz, %d channels", inputRate, inputChannels)
+	}
+	return &pcm16Converter{
+		channels:  inputChannels,
+		resampler: newLinearResampler(inputRate, inputSampleRate),
+	}, nil
+}
+
+// convert returns little-endian PCM16 bytes for interleaved input samples
+func (c *pcm16Converter) convert(samples []float32) []byte {
+	return encodePCM16(c.mono(samples))
+}
+
+// mono returns interleaved input samples as 24 kHz mono
+func (c *pcm16Converter) mono(samples []float32) []float32 {
+	return c.resampler.process(downmix(samples, c.channels))
+}
+
+// encodePCM16 returns little-endian PCM16 bytes for mono samples
+func encodePCM16(mono []float32) []byte {
+	pcm := make([]byte, len(mono)*2)
+	for i, sample := range mono {
+		// Limit value to [-1.0, 1.0] range
+		if sample > 1.0 {
+			sample = 1.0
+		} else if sample < -1.0 {
+			sample = -1.0
+		}
+		v := int16(sample * 32767.0)
+		pcm[i*2] = byte(v)
+		pcm[i*2+1] = byte(v >> 8)
+	}
+	return pcm
+}
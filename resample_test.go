@@ -0,0 +1,62 @@
+package voxaudio
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinearResamplerChunked(t *testing.T) {
+	// A ramp resampled in chunks must match the ramp at the output rate
+	in := make([]float32, 4410)
+	for i := range in {
+		in[i] = float32(i) / 44100
+	}
+
+	r := newLinearResampler(44100, 48000)
+	var out []float32
+	for i := 0; i < len(in); i += 441 {
+		out = append(out, r.process(in[i:i+441])...)
+	}
+
+	assert.InDelta(t, 4800, len(out), 2)
+	for i, v := range out {
+		assert.InDelta(t, float32(i)/48000, v, 1e-5)
+	}
+}
+
+func TestLinearResamplerSameRate(t *testing.T) {
+	in := []float32{0.1, 0.2, 0.3}
+	assert.Equal(t, in, newLinearResampler(24000, 24000).process(in))
+}
+
+func TestLinearResamplerInvalidRate(t *testing.T) {
+	assert.Panics(t, func() { newLinearResampler(0, 48000) })
+	assert.Panics(t, func() { newLinearResampler(48000, 0) })
+}
+
+func TestPCM16ConverterInvalidFormat(t *testing.T) {
+	_, err := newPCM16Converter(0, 1)
+	assert.Error(t, err)
+	_, err = newPCM16Converter(48000, 0)
+	assert.Error(t, err)
+}
+
+func TestDownmix(t *testing.T) {
+	assert.Equal(t, []float32{0.5, 0}, downmix([]float32{1, 0, 0.5, -0.5}, 2))
+	in := []float32{1, 2}
+	assert.Equal(t, in, downmix(in, 1))
+}
+
+func TestPCM16Converter(t *testing.T) {
+	// 48 kHz stereo is mixed down and halved to 24 kHz mono
+	in := []float32{0.5, 0.5, 0, 0, 1.75, 1.25, 0, 0}
+	c, err := newPCM16Converter(48000, 2)
+	require.NoError(t, err)
+	pcm := c.convert(in)
+	assert.Equal(t, []byte{0xff, 0x3f, 0xff, 0x7f}, pcm[:4]) // 0.5, then 1.5 clipped to 1.0
+
+	pcm = c.convert(in)
+	assert.Len(t, pcm, 4)
+}
@@ -0,0 +1,117 @@
+//go:build rnnoise
+
+package voxaudio
+
+/*
+#cgo pkg-config: rnnoise
+#include <rnnoise.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+func init() {
+	noiseSuppressors["rnnoise"] = func() (NoiseSuppressor, error) { return NewRNNoiseSuppressor() }
+}
+
+// rnnoiseFrame is the frame size of RNNoise, 10ms at 48 kHz
+const rnnoiseFrame = 480
+
+// RNNoiseSuppressor suppresses noise with the RNNoise recurrent network.
+// RNNoise runs at 48 kHz, so the input is resampled on the way in and out.
+// Note: Only available when built with the rnnoise tag; delays the audio by about 10ms
+type RNNoiseSuppressor struct {
+	mu       sync.Mutex
+	state    *C.DenoiseState
+	bypass   bool
+	up       *linearResampler
+	down     *linearResampler
+	input    []float32 // 48 kHz samples not yet in a full frame
+	ready    []float32 // 24 kHz output not yet returned
+	inPower  float64
+	outPower float64
+}
+
+// NewRNNoiseSuppressor returns a suppressor with the built-in RNNoise model
+func NewRNNoiseSuppressor() (*RNNoiseSuppressor, error) {
+	state := C.rnnoise_create(nil)
+	if state == nil {
+		return nil, fmt.Errorf("failed to create RNNoise state")
+	}
+	return &RNNoiseSuppressor{
+		state: state,
+		up:    newLinearResampler(inputSampleRate, 48000),
+		down:  newLinearResampler(48000, inputSampleRate),
+		ready: make([]float32, rnnoiseFrame/2+16),
+	}, nil
+}
+
+func (r *RNNoiseSuppressor) SetBypass(bypass bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bypass = bypass
+}
+
+func (r *RNNoiseSuppressor) Reduction() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inPower == 0 || r.outPower == 0 {
+		return 0
+	}
+	return 10 * math.Log10(r.inPower/r.outPower)
+}
+
+func (r *RNNoiseSuppressor) Process(frame Frame) []float32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	samples := frame.Samples
+	if r.state == nil {
+		return samples
+	}
+	r.input = append(r.input, r.up.process(samples)...)
+	var in, out [rnnoiseFrame]C.float
+	for len(r.input) >= rnnoiseFrame {
+		// RNNoise expects 16-bit sample values
+		var inEnergy, outEnergy float64
+		for i, sample := range r.input[:rnnoiseFrame] {
+			in[i] = C.float(sample * 32768)
+			inEnergy += float64(sample) * float64(sample)
+		}
+		r.input = r.input[rnnoiseFrame:]
+
+		C.rnnoise_process_frame(r.state, (*C.float)(unsafe.Pointer(&out[0])), (*C.float)(unsafe.Pointer(&in[0])))
+		frame := make([]float32, rnnoiseFrame)
+		for i := range frame {
+			if r.bypass {
+				frame[i] = float32(in[i]) / 32768
+			} else {
+				frame[i] = float32(out[i]) / 32768
+			}
+			outEnergy += float64(frame[i]) * float64(frame[i])
+		}
+		r.ready = append(r.ready, r.down.process(frame)...)
+
+		const decay = 1 - float64(rnnoiseFrame)/48000
+		r.inPower = r.inPower*decay + inEnergy
+		r.outPower = r.outPower*decay + outEnergy
+	}
+
+	result := make([]float32, len(samples))
+	r.ready = r.ready[copy(result, r.ready):]
+	return result
+}
+
+// Close releases the RNNoise state
+func (r *RNNoiseSuppressor) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.state != nil {
+		C.rnnoise_destroy(r.state)
+		r.state = nil
+	}
+}
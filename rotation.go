@@ -0,0 +1,514 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// RotationOptions configures the replacement of the realtime connection
+// before the server ends the session at its maximum duration
+type RotationOptions struct {
+	After        time.Duration // Replace the connection this long after it started, 0 disables
+	ContextTurns int           // Recent turns replayed into the new session, default 4
+	CutoverWait  time.Duration // Longest wait for a pause in speech before switching, default 10s
+	DrainTimeout time.Duration // Longest wait for the old connection to finish its response, default 15s
+}
+
+func (o RotationOptions) withDefaults() RotationOptions {
+	if o.ContextTurns <= 0 {
+		o.ContextTurns = 4
+	}
+	if o.CutoverWait <= 0 {
+		o.CutoverWait = 10 * time.Second
+	}
+	if o.DrainTimeout <= 0 {
+		o.DrainTimeout = 15 * time.Second
+	}
+	return o
+}
+
+const (
+	rotationOpenTimeout = 30 * time.Second // Wait for the data channel of the new connection
+	rotationRetry       = 30 * time.Second // Wait before retrying a failed rotation
+	maxHistoryMessages  = 32               // Conversation messages kept for rotation
+)
+
+// historyMessage is a transcribed message of the conversation
+type historyMessage struct {
+	role string // "user" or "assistant"
+	text string
+}
+
+// SetRotation enables replacing the connection periodically
+// Note: Must be called before Start
+func (s *Session) SetRotation(options RotationOptions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotation = options
+}
+
+// channel returns the data channel of the current connection
+func (s *Session) channel() *webrtc.DataChannel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dc
+}
+
+// trackConversation follows the state of the conversation needed to pick
+// the moment of a rotation and to replay recent context
+func (s *Session) trackConversation(evt ServerEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch evt.Type {
+	case EventSpeechStarted:
+		s.speaking = true
+	case EventSpeechStopped:
+		s.speaking = false
+	case EventResponseCreated:
+		s.responses++
+	case EventResponseDone:
+		s.responses = max(s.responses-1, 0)
+	case EventInputTranscriptionDone:
+		s.addHistory("user", evt.Transcript)
+	case EventResponseAudioTranscriptEnd:
+		s.addHistory("assistant", evt.Transcript)
+	case EventResponseTextDone:
+		s.addHistory("assistant", evt.Text)
+	}
+}
+
+// addHistory remembers a message; s.mu must be held
+func (s *Session) addHistory(role, text string) {
+	if text = strings.TrimSpace(text); text == "" {
+		return
+	}
+	if len(s.history) == maxHistoryMessages {
+		s.history = append(s.history[:0], s.history[1:]...)
+	}
+	s.history = append(s.history, historyMessage{role: role, text: text})
+}
+
+// contextItems returns conversation.item.create events replaying the last turns
+func (s *Session) contextItems(turns int) []map[string]interface{} {
+	s.mu.Lock()
+	history := s.history
+	if len(history) > 2*turns {
+		history = history[len(history)-2*turns:]
+	}
+	history = append([]historyMessage(nil), history...)
+	s.mu.Unlock()
+
+	events := make([]map[string]interface{}, 0, len(history))
+	for _, msg := range history {
+		contentType := "input_text"
+		if msg.role == "assistant" {
+			contentType = "text"
+		}
+		events = append(events, map[string]interface{}{
+			"type": "conversation.item.create",
+			"item": map[string]interface{}{
+				"type":    "message",
+				"role":    msg.role,
+				"content": []map[string]string{{"type": contentType, "text": msg.text}},
+			},
+		})
+	}
+	return events
+}
+
+// sendEventOn sends a client event on a data channel that is not the current one
+func (s *Session) sendEventOn(dc *webrtc.DataChannel, evt interface{}) error {
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := dc.SendText(string(b)); err != nil {
+		return err
+	}
+	s.logOutbound(string(b), time.Now())
+	return nil
+}
+
+// rotateEvery replaces the connection periodically until the session stops
+func (s *Session) rotateEvery(after time.Duration) {
+	stopCh := s.stopSignal()
+	wait := after
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(wait):
+		}
+		wait = after
+		if err := s.Rotate(); err != nil {
+			fmt.Printf("[Session] Connection rotation failed: %v\n", err)
+			wait = rotationRetry
+		}
+	}
+}
+
+// Rotate replaces the realtime connection without interrupting the
+// translation. A new connection is opened, configured and given the recent
+// conversation; input switches to it at a pause in speech, and the old
+// connection is closed once its last response has played.
+func (s *Session) Rotate() error {
+	s.mu.Lock()
+	if s.rotating {
+		s.mu.Unlock()
+		return fmt.Errorf("rotation already in progress")
+	}
+	s.rotating = true
+	options := s.rotation.withDefaults()
+	handlesTracks := s.trackHandler != nil
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.rotating = false
+		s.mu.Unlock()
+	}()
+	stopCh := s.stopSignal()
+
+	fmt.Println("[Session] Opening a new connection to replace the current one...")
+	pc, dc, err := newPeerConnection()
+	if err != nil {
+		return fmt.Errorf("failed to create connection: %w", err)
+	}
+	switched := false
+	defer func() {
+		if !switched {
+			_ = pc.Close()
+		}
+	}()
+
+	// The new session counts input from the moment it takes over
+	var inputBase atomic.Int64
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		s.receiveMessage(msg, inputBase.Load())
+	})
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		fmt.Printf("[WebRTC] New connection state changed: %s\n", state.String())
+	})
+	if handlesTracks {
+		pc.OnTrack(s.onTrack)
+	}
+
+	if err := s.connect(pc); err != nil {
+		return err
+	}
+	select {
+	case <-opened:
+	case <-time.After(rotationOpenTimeout):
+		return fmt.Errorf("data channel of the new connection did not open")
+	case <-stopCh:
+		return fmt.Errorf("session stopped")
+	}
+
+	// Configure the new session and give it the recent conversation
+	if err := s.sendEventOn(dc, s.sessionUpdate()); err != nil {
+		return fmt.Errorf("failed to configure the new session: %w", err)
+	}
+	for _, item := range s.contextItems(options.ContextTurns) {
+		if err := s.sendEventOn(dc, item); err != nil {
+			return fmt.Errorf("failed to replay the conversation: %w", err)
+		}
+	}
+
+	// Switch at a pause so no turn is split between the sessions
+	deadline := time.Now().Add(options.CutoverWait)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		speaking := s.speaking
+		s.mu.Unlock()
+		if !speaking {
+			break
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-stopCh:
+			return fmt.Errorf("session stopped")
+		}
+	}
+
+	s.mu.Lock()
+	oldPC, oldDC, oldBase := s.pc, s.dc, s.inputBaseMs
+	s.pc, s.dc = pc, dc
+	s.inputBaseMs = s.uploadedMs.Load()
+	inputBase.Store(s.inputBaseMs)
+	responses, playing := s.responses, s.serverPlaying
+	s.mu.Unlock()
+	switched = true
+	fmt.Println("[Session] Switched input to the new connection")
+	s.outbound().flush()
+
+	// Let the old connection finish the response being played
+	idle := make(chan struct{})
+	if responses == 0 && !playing {
+		close(idle)
+	} else {
+		var once sync.Once
+		oldDC.OnMessage(func(msg webrtc.DataChannelMessage) {
+			s.receiveMessage(msg, oldBase)
+			var evt struct {
+				Type string `json:"type"`
+			}
+			if json.Unmarshal(msg.Data, &evt) != nil {
+				return
+			}
+			switch evt.Type {
+			case EventResponseCreated:
+				responses++
+			case EventResponseDone:
+				responses = max(responses-1, 0)
+			case EventOutputAudioStarted:
+				playing = true
+			case EventOutputAudioStopped:
+				playing = false
+			}
+			if responses == 0 && !playing {
+				once.Do(func() { close(idle) })
+			}
+		})
+	}
+	select {
+	case <-idle:
+	case <-time.After(options.DrainTimeout):
+		fmt.Println("[Session] Old connection still busy, closing it anyway")
+	case <-stopCh:
+	}
+
+	_ = oldDC.Close()
+	_ = oldPC.Close()
+	fmt.Println("[Session] Closed the old connection")
+	return nil
+}
+
+// handleTracks plays the remote audio of the current and future connections with start
+func (s *Session) handleTracks(start func(RTPReader) error) {
+	s.mu.Lock()
+	s.trackHandler = start
+	s.mu.Unlock()
+	s.pc.OnTrack(s.onTrack)
+}
+
+func (s *Session) onTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	if track.Kind() == webrtc.RTPCodecTypeAudio {
+		s.attachTrack(track)
+	}
+}
+
+// attachTrack plays a remote track. While the track of a previous connection
+// is still playing, the new one takes over in the same player once the old
+// one goes quiet.
+func (s *Session) attachTrack(track RTPReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.output != nil && s.output.add(track) {
+		return
+	}
+	s.output = newRotatingTrack(track, s.goTask)
+	handler, output := s.trackHandler, s.output
+	s.goTask(func() {
+		_ = handler(output)
+		output.stop()
+	})
+}
+
+// trackClosed reports whether a track read error means the track ended
+func trackClosed(err error) bool {
+	return err == io.EOF || strings.Contains(err.Error(), "closed")
+}
+
+const (
+	trackQuiet       = 200 * time.Millisecond // Silence of the playing track before the next one takes over
+	trackReadAhead   = 250                    // Packets read ahead of a track (5 seconds)
+	opusSilenceBytes = 3                      // Largest Opus packet that carries only silence
+)
+
+// trackRead is the result of reading a packet from a track
+type trackRead struct {
+	packet     *rtp.Packet
+	attributes interceptor.Attributes
+	err        error
+}
+
+// trackSource reads a track ahead, so the next track can be watched while
+// the current one plays. reads is closed once the track has ended with err.
+type trackSource struct {
+	reads   chan trackRead
+	dropped chan struct{} // Closed when the track is no longer played
+	err     error
+}
+
+// newTrackSource starts reading track in a goroutine started with start
+func newTrackSource(track RTPReader, start func(func())) *trackSource {
+	src := &trackSource{reads: make(chan trackRead, trackReadAhead), dropped: make(chan struct{})}
+	start(func() {
+		defer close(src.reads)
+		for {
+			packet, attributes, err := track.ReadRTP()
+			if err != nil && trackClosed(err) {
+				src.err = err
+				return
+			}
+			select {
+			case src.reads <- trackRead{packet, attributes, err}:
+			case <-src.dropped:
+				return
+			}
+		}
+	})
+	return src
+}
+
+// rotatingTrack reads the remote audio of the connections in turn. The
+// track of a new connection takes over when it has audio and the playing
+// one has been quiet for trackQuiet, or has ended; its RTP sequence numbers
+// and timestamps are shifted to follow on, so packet sinks see one stream.
+type rotatingTrack struct {
+	start func(func()) // Starts the goroutine reading a track
+	added chan struct{}
+
+	mu      sync.Mutex
+	current *trackSource
+	next    []*trackSource
+	ended   bool
+	sound   time.Time // When the current track last returned audio
+
+	started   bool // A packet was returned
+	switched  bool // The offsets of the current track are not known yet
+	ssrc      uint32
+	lastSeq   uint16
+	lastTS    uint32
+	seqOffset uint16
+	tsOffset  uint32
+}
+
+// newRotatingTrack returns a rotatingTrack playing track first
+func newRotatingTrack(track RTPReader, start func(func())) *rotatingTrack {
+	return &rotatingTrack{
+		start:   start,
+		added:   make(chan struct{}, 1),
+		current: newTrackSource(track, start),
+		sound:   time.Now(),
+	}
+}
+
+// add queues the track of a new connection; false if the audio has ended
+func (t *rotatingTrack) add(track RTPReader) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ended {
+		return false
+	}
+	t.next = append(t.next, newTrackSource(track, t.start))
+	select {
+	case t.added <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// stop drops the tracks once the player has returned
+func (t *rotatingTrack) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ended && t.current == nil {
+		return
+	}
+	t.ended = true
+	for _, src := range append([]*trackSource{t.current}, t.next...) {
+		close(src.dropped)
+	}
+	t.current, t.next = nil, nil
+}
+
+// advance drops the current track for the next one; t.mu must be held
+func (t *rotatingTrack) advance() {
+	close(t.current.dropped)
+	t.current, t.next = t.next[0], t.next[1:]
+	t.switched = t.started
+	t.sound = time.Now()
+}
+
+func (t *rotatingTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	for {
+		t.mu.Lock()
+		current := t.current
+		if current == nil {
+			t.mu.Unlock()
+			return nil, nil, io.EOF
+		}
+		var nextReads <-chan trackRead
+		var wait <-chan time.Time
+		if len(t.next) > 0 {
+			if quiet := time.Since(t.sound); quiet >= trackQuiet {
+				nextReads = t.next[0].reads
+			} else {
+				wait = time.After(trackQuiet - quiet)
+			}
+		}
+		t.mu.Unlock()
+
+		var read trackRead
+		var ok bool
+		select {
+		case read, ok = <-current.reads:
+		case read, ok = <-nextReads:
+			t.mu.Lock()
+			t.advance()
+			t.mu.Unlock()
+		case <-wait:
+			continue
+		case <-t.added:
+			continue
+		}
+
+		t.mu.Lock()
+		if !ok {
+			if len(t.next) > 0 {
+				t.advance()
+				t.mu.Unlock()
+				continue
+			}
+			t.ended = true
+			err := t.current.err
+			t.mu.Unlock()
+			return nil, nil, err
+		}
+		if read.err != nil {
+			t.mu.Unlock()
+			return nil, nil, read.err
+		}
+
+		packet := read.packet
+		if len(packet.Payload) > opusSilenceBytes {
+			t.sound = time.Now()
+		}
+		if t.switched {
+			t.seqOffset = t.lastSeq + 1 - packet.SequenceNumber
+			t.tsOffset = t.lastTS + frameSize - packet.Timestamp
+			t.switched = false
+		}
+		packet.SequenceNumber += t.seqOffset
+		packet.Timestamp += t.tsOffset
+		if !t.started {
+			t.ssrc = packet.SSRC
+			t.started = true
+		}
+		packet.SSRC = t.ssrc
+		t.lastSeq, t.lastTS = packet.SequenceNumber, packet.Timestamp
+		t.mu.Unlock()
+		return packet, read.attributes, nil
+	}
+}
@@ -0,0 +1,231 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// packetTrack returns its packets, then io.EOF
+type packetTrack struct {
+	packets []*rtp.Packet
+}
+
+func newPacketTrack(ssrc uint32, seq uint16, ts uint32, n int) *packetTrack {
+	track := &packetTrack{}
+	for i := 0; i < n; i++ {
+		track.packets = append(track.packets, &rtp.Packet{Header: rtp.Header{
+			SSRC:           ssrc,
+			SequenceNumber: seq + uint16(i),
+			Timestamp:      ts + uint32(i*frameSize),
+		}, Payload: make([]byte, 40)})
+	}
+	return track
+}
+
+func (t *packetTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	if len(t.packets) == 0 {
+		return nil, nil, io.EOF
+	}
+	packet := t.packets[0]
+	t.packets = t.packets[1:]
+	return packet, nil, nil
+}
+
+func TestRotatingTrack(t *testing.T) {
+	track := newRotatingTrack(newPacketTrack(1, 65534, 4_000_000_000, 3), goFunc)
+	require.True(t, track.add(newPacketTrack(2, 100, 5000, 2)))
+
+	var packets []*rtp.Packet
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+		packets = append(packets, packet)
+	}
+
+	// The second track continues the sequence and timestamps of the first
+	require.Len(t, packets, 5)
+	for i, packet := range packets {
+		assert.Equal(t, uint32(1), packet.SSRC)
+		assert.Equal(t, uint16(65534+i), packet.SequenceNumber, "packet %d", i)
+		assert.Equal(t, uint32(4_000_000_000+i*frameSize), packet.Timestamp, "packet %d", i)
+	}
+	assert.False(t, track.add(newPacketTrack(3, 0, 0, 1)), "ended")
+}
+
+// goFunc starts fn in a goroutine
+func goFunc(fn func()) { go fn() }
+
+// liveTrack returns the packets sent to it until it is closed
+type liveTrack chan *rtp.Packet
+
+func (t liveTrack) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	packet, ok := <-t
+	if !ok {
+		return nil, nil, io.EOF
+	}
+	return packet, nil, nil
+}
+
+func TestRotatingTrackCutover(t *testing.T) {
+	for _, payload := range []int{0, 40} {
+		old := make(liveTrack, 8)
+		track := newRotatingTrack(old, goFunc)
+		old <- &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 10, Timestamp: 100}, Payload: make([]byte, 40)}
+		packet, _, err := track.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, uint16(10), packet.SequenceNumber)
+
+		// The old connection stays open, sending silence or nothing
+		silence := make(chan struct{})
+		go func() {
+			defer close(old)
+			for i := 0; payload == 0; i++ {
+				select {
+				case old <- &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: uint16(11 + i), Timestamp: uint32(100 + (i+1)*frameSize)}}:
+				case <-silence:
+					return
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			<-silence
+		}()
+		require.True(t, track.add(newPacketTrack(2, 500, 9000, 2)))
+
+		// The new connection takes over without waiting for the old one to close
+		start := time.Now()
+		for {
+			packet, _, err = track.ReadRTP()
+			require.NoError(t, err)
+			if len(packet.Payload) > 0 {
+				break
+			}
+		}
+		assert.Less(t, time.Since(start), 2*time.Second, "payload %d", payload)
+		assert.Equal(t, uint32(1), packet.SSRC)
+		previous := packet.SequenceNumber - 1
+		packet, _, err = track.ReadRTP()
+		require.NoError(t, err)
+		assert.Equal(t, previous+2, packet.SequenceNumber, "sequence continues")
+		track.stop()
+		close(silence)
+	}
+}
+
+func TestAttachTrack(t *testing.T) {
+	started := make(chan RTPReader, 2)
+	release := make(chan struct{})
+	defer close(release)
+	s := &Session{trackHandler: func(track RTPReader) error {
+		started <- track
+		<-release
+		return nil
+	}}
+
+	s.attachTrack(newPacketTrack(1, 0, 0, 1))
+	first := <-started
+	s.attachTrack(newPacketTrack(2, 0, 0, 1))
+	select {
+	case <-started:
+		t.Fatal("the track of the new connection should follow the playing one")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Once the audio has ended, a new track is played on its own
+	for {
+		if _, _, err := first.ReadRTP(); err != nil {
+			break
+		}
+	}
+	s.attachTrack(newPacketTrack(3, 0, 0, 1))
+	assert.NotSame(t, first, <-started)
+}
+
+func TestDoneWaitsForTracks(t *testing.T) {
+	// Done is closed once the track handler has saved its recordings
+	release := make(chan struct{})
+	s := &Session{trackHandler: func(track RTPReader) error {
+		<-release
+		return nil
+	}}
+	s.attachTrack(newPacketTrack(1, 0, 0, 1))
+
+	s.Stop()
+	select {
+	case <-s.Done():
+		t.Fatal("Done closed while a track was still running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed after the track finished")
+	}
+}
+
+func TestConversationHistory(t *testing.T) {
+	s := &Session{}
+	now := time.Now()
+	dispatchAt(t, s, now, `{"type":"input_audio_buffer.speech_started","audio_start_ms":100}`)
+	dispatchAt(t, s, now, `{"type":"response.created","response":{"id":"resp_1"}}`)
+	assert.True(t, s.speaking)
+	assert.Equal(t, 1, s.responses)
+
+	for i, text := range []string{"un", "deux", "trois"} {
+		dispatchAt(t, s, now, `{"type":"conversation.item.input_audio_transcription.completed","item_id":"item_%d","transcript":%q}`, i, text)
+		dispatchAt(t, s, now, `{"type":"response.audio_transcript.done","transcript":%q}`, []string{"one", "two", "three"}[i])
+	}
+	dispatchAt(t, s, now, `{"type":"input_audio_buffer.speech_stopped","audio_end_ms":900}`)
+	dispatchAt(t, s, now, `{"type":"response.done","response":{"id":"resp_1","status":"completed"}}`)
+	assert.False(t, s.speaking)
+	assert.Zero(t, s.responses)
+
+	items := s.contextItems(2)
+	require.Len(t, items, 4)
+	b, err := json.Marshal(items[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"conversation.item.create","item":{"type":"message","role":"user","content":[{"type":"input_text","text":"deux"}]}}`, string(b))
+	b, err = json.Marshal(items[3])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"conversation.item.create","item":{"type":"message","role":"assistant","content":[{"type":"text","text":"three"}]}}`, string(b))
+}
+
+func TestDispatchInputBase(t *testing.T) {
+	s := &Session{}
+	var starts, ends []int
+	s.OnEvent(EventSpeechStarted, func(evt ServerEvent) { starts = append(starts, evt.AudioStartMs) })
+	s.OnEvent(EventSpeechStopped, func(evt ServerEvent) { ends = append(ends, evt.AudioEndMs) })
+
+	now := time.Now()
+	require.NoError(t, s.dispatchEventFrom([]byte(`{"type":"input_audio_buffer.speech_started","audio_start_ms":250}`), now, 0))
+	require.NoError(t, s.dispatchEventFrom([]byte(`{"type":"input_audio_buffer.speech_started","audio_start_ms":250}`), now, 60_000))
+	require.NoError(t, s.dispatchEventFrom([]byte(`{"type":"input_audio_buffer.speech_stopped","audio_end_ms":1200}`), now, 60_000))
+	assert.Equal(t, []int{250, 60_250}, starts)
+	assert.Equal(t, []int{61_200}, ends)
+}
+
+func TestRotateEveryStops(t *testing.T) {
+	// The rotation loop also ends when the session stopped before it started
+	s := &Session{}
+	s.Stop()
+	done := make(chan struct{})
+	go func() {
+		s.rotateEvery(time.Hour)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("rotation loop still running after Stop")
+	}
+}
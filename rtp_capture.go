@@ -0,0 +1,178 @@
+package voxaudio
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+
+	"voxworld/rtpfile"
+)
+
+// RTPReader is the reading side of a remote track. It is implemented by
+// *webrtc.TrackRemote and by RTPReplay, so the playback paths can run from
+// a capture file instead of a live connection.
+type RTPReader interface {
+	ReadRTP() (*rtp.Packet, interceptor.Attributes, error)
+}
+
+// captureFormat picks the capture format from the file extension:
+// .pcap and .cap are pcap, anything else is rtpdump
+func captureFormat(path string) rtpfile.Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pcap", ".cap":
+		return rtpfile.Pcap
+	}
+	return rtpfile.RTPDump
+}
+
+// RTPCaptureSink saves the received RTP packets with their arrival times
+type RTPCaptureSink struct {
+	mu     sync.Mutex
+	writer *rtpfile.Writer
+	count  int
+}
+
+// NewRTPCaptureSink creates the capture file at path, as pcap if the
+// extension is .pcap and as rtpdump otherwise
+func NewRTPCaptureSink(path string) (*RTPCaptureSink, error) {
+	writer, err := rtpfile.Create(path, captureFormat(path))
+	if err != nil {
+		return nil, err
+	}
+	return &RTPCaptureSink{writer: writer}, nil
+}
+
+// WriteRTP appends packet to the capture
+func (s *RTPCaptureSink) WriteRTP(packet *rtp.Packet) error {
+	data, err := packet.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal RTP packet: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writer.WritePacket(time.Now(), data); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// Packets returns the number of packets captured so far
+func (s *RTPCaptureSink) Packets() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Close closes the capture file
+func (s *RTPCaptureSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writer.Close()
+}
+
+// RTPReplay reads the packets of a capture file as if they arrived on a
+// remote track. ReadRTP returns io.EOF at the end of the capture; a read
+// error also ends the replay and is reported by Err.
+type RTPReplay struct {
+	mu       sync.Mutex
+	reader   *rtpfile.Reader
+	realtime bool
+	first    time.Time // Capture time of the first packet
+	started  time.Time // Wall time the first packet was returned
+	err      error
+	closed   bool
+}
+
+// OpenRTPReplay opens the rtpdump or pcap capture at path
+func OpenRTPReplay(path string) (*RTPReplay, error) {
+	reader, err := rtpfile.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RTPReplay{reader: reader}, nil
+}
+
+// NewRTPReplay returns a replay of the capture read from r
+func NewRTPReplay(r io.Reader) (*RTPReplay, error) {
+	reader, err := rtpfile.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &RTPReplay{reader: reader}, nil
+}
+
+// SetRealtime paces the packets by their capture times
+// Note: By default packets are returned as fast as they are read
+func (r *RTPReplay) SetRealtime(realtime bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.realtime = realtime
+}
+
+// ReadRTP returns the next packet of the capture
+func (r *RTPReplay) ReadRTP() (*rtp.Packet, interceptor.Attributes, error) {
+	r.mu.Lock()
+	packet, due, err := r.next()
+	r.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Sleep unlocked so Close is not held up by a pause in the capture
+	time.Sleep(time.Until(due))
+	return packet, interceptor.Attributes{}, nil
+}
+
+// next reads the next RTP packet and returns when it is due
+func (r *RTPReplay) next() (*rtp.Packet, time.Time, error) {
+	for {
+		if r.closed || r.err != nil {
+			return nil, time.Time{}, io.EOF
+		}
+		captured, err := r.reader.ReadPacket()
+		if err == io.EOF {
+			return nil, time.Time{}, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			fmt.Printf("[Audio] Failed to read RTP capture: %v\n", err)
+			return nil, time.Time{}, io.EOF
+		}
+
+		packet := &rtp.Packet{}
+		if err := packet.Unmarshal(captured.Data); err != nil {
+			continue // Not RTP, skip like the transport would
+		}
+		if r.first.IsZero() {
+			r.first, r.started = captured.Time, time.Now()
+		}
+		if !r.realtime {
+			return packet, time.Time{}, nil
+		}
+		return packet, r.started.Add(captured.Time.Sub(r.first)), nil
+	}
+}
+
+// Err returns the error that ended the replay, if any
+func (r *RTPReplay) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Close closes the capture file; later reads return io.EOF
+func (r *RTPReplay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.reader.Close()
+}
@@ -0,0 +1,178 @@
+package voxaudio
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hraban/opus"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"voxworld/oggopus"
+	"voxworld/rtpfile"
+)
+
+// opusPacket returns the nth 20ms RTP packet of a silent Opus stream
+func opusPacket(n int) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    111,
+			SequenceNumber: uint16(n),
+			Timestamp:      uint32(n * frameSize),
+			SSRC:           0x1234,
+		},
+		Payload: oggopus.SilencePacket,
+	}
+}
+
+// writeCapture writes count packets 20ms apart and returns the capture
+func writeCapture(t testing.TB, format rtpfile.Format, count int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := rtpfile.NewWriter(&buf, format)
+	require.NoError(t, err)
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		data, err := opusPacket(i).Marshal()
+		require.NoError(t, err)
+		require.NoError(t, w.WritePacket(start.Add(time.Duration(i)*20*time.Millisecond), data))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestRTPCaptureSinkReplay(t *testing.T) {
+	for _, name := range []string{"capture.pcap", "capture.rtpdump"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			sink, err := NewRTPCaptureSink(path)
+			require.NoError(t, err)
+			for i := 0; i < 10; i++ {
+				require.NoError(t, sink.WriteRTP(opusPacket(i)))
+			}
+			assert.Equal(t, 10, sink.Packets())
+			require.NoError(t, sink.Close())
+
+			replay, err := OpenRTPReplay(path)
+			require.NoError(t, err)
+			defer replay.Close()
+			for i := 0; i < 10; i++ {
+				packet, _, err := replay.ReadRTP()
+				require.NoError(t, err)
+				assert.Equal(t, opusPacket(i).Header.SequenceNumber, packet.SequenceNumber)
+				assert.Equal(t, opusPacket(i).Header.Timestamp, packet.Timestamp)
+				assert.Equal(t, oggopus.SilencePacket, packet.Payload)
+			}
+			_, _, err = replay.ReadRTP()
+			assert.Equal(t, io.EOF, err)
+			assert.NoError(t, replay.Err())
+		})
+	}
+}
+
+func TestRTPReplayRealtime(t *testing.T) {
+	replay, err := NewRTPReplay(bytes.NewReader(writeCapture(t, rtpfile.RTPDump, 6)))
+	require.NoError(t, err)
+	replay.SetRealtime(true)
+
+	start := time.Now()
+	for {
+		if _, _, err := replay.ReadRTP(); err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRTPReplayTruncated(t *testing.T) {
+	capture := writeCapture(t, rtpfile.Pcap, 3)
+	replay, err := NewRTPReplay(bytes.NewReader(capture[:len(capture)-4]))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := replay.ReadRTP()
+		require.NoError(t, err)
+	}
+	_, _, err = replay.ReadRTP()
+	assert.Equal(t, io.EOF, err, "a broken capture ends the track like a closed connection")
+	assert.ErrorIs(t, replay.Err(), rtpfile.ErrFormat)
+}
+
+// countingSink counts the packets written and whether it was closed
+type countingSink struct {
+	packets int
+	closed  bool
+}
+
+func (c *countingSink) WriteRTP(packet *rtp.Packet) error {
+	c.packets++
+	return nil
+}
+
+func (c *countingSink) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestPacketSinkOutlivesTrack(t *testing.T) {
+	// Packet sinks belong to the caller and keep receiving the next track
+	backend := NewFakeBackend()
+	backend.AddOutput("BlackHole 2ch", 48000, 2)
+	s := &Session{}
+	s.SetDeviceBackend(backend)
+	sink := &countingSink{}
+	s.AddPacketSink(sink)
+
+	for i := 0; i < 2; i++ {
+		replay, err := NewRTPReplay(bytes.NewReader(writeCapture(t, rtpfile.RTPDump, 10)))
+		require.NoError(t, err)
+		require.NoError(t, s.blackHoleTrack(replay))
+	}
+	assert.Equal(t, 20, sink.packets)
+	assert.False(t, sink.closed)
+}
+
+func TestBatchReceiveFromReplay(t *testing.T) {
+	replay, err := NewRTPReplay(bytes.NewReader(writeCapture(t, rtpfile.Pcap, 50)))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "out.opus")
+	sink, err := NewOggOpusSink(path)
+	require.NoError(t, err)
+
+	(&BatchTranslator{}).receive(replay, sink)
+	require.NoError(t, sink.Close())
+	assert.Equal(t, uint64(50*frameSize), readOggGranule(t, path))
+}
+
+// BenchmarkRTPReplayDecode measures reading and decoding one second of
+// captured audio, the work done per packet by the playback tracks
+func BenchmarkRTPReplayDecode(b *testing.B) {
+	capture := writeCapture(b, rtpfile.Pcap, 50)
+	decoder, err := opus.NewDecoder(sampleRate, channels)
+	require.NoError(b, err)
+	pcm := make([]int16, frameSize)
+
+	b.SetBytes(int64(len(capture)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		replay, err := NewRTPReplay(bytes.NewReader(capture))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for {
+			packet, _, err := replay.ReadRTP()
+			if err != nil {
+				break
+			}
+			if _, err := decoder.Decode(packet.Payload, pcm); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package rtpfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrFormat is returned when the stream is not a supported capture file.
+var ErrFormat = errors.New("rtpfile: invalid format")
+
+// Packet is a captured RTP packet.
+type Packet struct {
+	Time time.Time // When the packet was captured
+	Data []byte    // Marshalled RTP packet
+}
+
+// Reader reads the RTP packets of a capture file.
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	format Format
+
+	// rtpdump
+	start time.Time
+
+	// pcap
+	order    binary.ByteOrder
+	nano     bool
+	linkType uint32
+	buf      []byte
+}
+
+// Open opens the named capture file for reading.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader detects the format of the capture in r and reads its header.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+	magic, err := rd.r.Peek(4)
+	if err != nil {
+		return nil, formatError("missing header: %v", err)
+	}
+	if string(magic) == rtpdumpMagic[:4] {
+		rd.format = RTPDump
+		return rd, rd.readRTPDumpHeader()
+	}
+	rd.format = Pcap
+	return rd, rd.readPcapHeader()
+}
+
+func (r *Reader) readRTPDumpHeader() error {
+	line, err := r.r.ReadString('\n')
+	if err != nil {
+		return formatError("missing rtpdump header: %v", err)
+	}
+	if len(line) < len(rtpdumpMagic) || line[:len(rtpdumpMagic)] != rtpdumpMagic {
+		return formatError("unsupported rtpdump version")
+	}
+	var header [16]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return formatError("missing rtpdump header: %v", err)
+	}
+	sec := binary.BigEndian.Uint32(header[0:])
+	usec := binary.BigEndian.Uint32(header[4:])
+	r.start = time.Unix(int64(sec), int64(usec)*1000)
+	return nil
+}
+
+func (r *Reader) readPcapHeader() error {
+	var header [24]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return formatError("missing pcap header: %v", err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(header[:]) == pcapMagic:
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[:]) == pcapMagic:
+		r.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[:]) == pcapMagicNano:
+		r.order, r.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header[:]) == pcapMagicNano:
+		r.order, r.nano = binary.BigEndian, true
+	default:
+		return formatError("unknown magic %x", header[:4])
+	}
+	r.linkType = r.order.Uint32(header[20:]) & 0x0FFFFFFF
+	if r.linkType != linkTypeRaw && r.linkType != linkTypeEther {
+		return formatError("unsupported link type %d", r.linkType)
+	}
+	return nil
+}
+
+func formatError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, args...))
+}
+
+// Format returns the detected format of the capture.
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// ReadPacket returns the next RTP packet, or io.EOF at the end of the
+// capture. RTCP and non-UDP packets are skipped.
+func (r *Reader) ReadPacket() (Packet, error) {
+	if r.format == RTPDump {
+		return r.readRTPDump()
+	}
+	return r.readPcap()
+}
+
+func (r *Reader) readRTPDump() (Packet, error) {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r.r, header[:]); err != nil {
+			return Packet{}, eof(err)
+		}
+		length := int(binary.BigEndian.Uint16(header[0:]))
+		plen := int(binary.BigEndian.Uint16(header[2:]))
+		offset := binary.BigEndian.Uint32(header[4:])
+		if length < 8 {
+			return Packet{}, formatError("invalid record length %d", length)
+		}
+		data := make([]byte, length-8)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return Packet{}, truncated(err)
+		}
+		// A zero packet length marks RTCP
+		if plen == 0 || !isRTP(data) {
+			continue
+		}
+		if plen < len(data) {
+			data = data[:plen]
+		}
+		return Packet{Time: r.start.Add(time.Duration(offset) * time.Millisecond), Data: data}, nil
+	}
+}
+
+func (r *Reader) readPcap() (Packet, error) {
+	for {
+		var header [16]byte
+		if _, err := io.ReadFull(r.r, header[:]); err != nil {
+			return Packet{}, eof(err)
+		}
+		sec := r.order.Uint32(header[0:])
+		frac := r.order.Uint32(header[4:])
+		size := r.order.Uint32(header[8:])
+		if size > 262144 {
+			return Packet{}, formatError("invalid record length %d", size)
+		}
+		if cap(r.buf) < int(size) {
+			r.buf = make([]byte, size)
+		}
+		frame := r.buf[:size]
+		if _, err := io.ReadFull(r.r, frame); err != nil {
+			return Packet{}, truncated(err)
+		}
+
+		payload := r.udpPayload(frame)
+		if payload == nil || !isRTP(payload) {
+			continue
+		}
+		if !r.nano {
+			frac *= 1000
+		}
+		return Packet{
+			Time: time.Unix(int64(sec), int64(frac)),
+			Data: bytes.Clone(payload),
+		}, nil
+	}
+}
+
+// udpPayload returns the UDP payload of an IPv4 frame, or nil
+func (r *Reader) udpPayload(frame []byte) []byte {
+	if r.linkType == linkTypeEther {
+		if len(frame) < 14 {
+			return nil
+		}
+		etherType := binary.BigEndian.Uint16(frame[12:])
+		frame = frame[14:]
+		if etherType == 0x8100 && len(frame) >= 4 { // VLAN tag
+			etherType = binary.BigEndian.Uint16(frame[2:])
+			frame = frame[4:]
+		}
+		if etherType != 0x0800 {
+			return nil
+		}
+	}
+
+	if len(frame) < ipv4HeaderSize || frame[0]>>4 != 4 || frame[9] != 17 {
+		return nil
+	}
+	ihl := int(frame[0]&0x0F) * 4
+	total := int(binary.BigEndian.Uint16(frame[2:]))
+	if ihl < ipv4HeaderSize || total > len(frame) || total < ihl+udpHeaderSize {
+		return nil
+	}
+	// Fragments other than the first cannot be decoded on their own
+	if binary.BigEndian.Uint16(frame[6:])&0x3FFF != 0 {
+		return nil
+	}
+	udp := frame[ihl:total]
+	length := int(binary.BigEndian.Uint16(udp[4:]))
+	if length < udpHeaderSize || length > len(udp) {
+		return nil
+	}
+	return udp[udpHeaderSize:length]
+}
+
+// isRTP reports whether data looks like an RTP packet rather than RTCP
+// multiplexed on the same port (RFC 5761).
+func isRTP(data []byte) bool {
+	if len(data) < 12 || data[0]>>6 != 2 {
+		return false
+	}
+	pt := data[1] & 0x7F
+	return pt < 64 || pt > 95
+}
+
+// eof maps a clean end of file to io.EOF and a partial header to an error
+func eof(err error) error {
+	if err == io.EOF {
+		return io.EOF
+	}
+	return truncated(err)
+}
+
+func truncated(err error) error {
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return formatError("truncated record")
+	}
+	return fmt.Errorf("failed to read capture: %w", err)
+}
+
+// Close closes the underlying file if it was opened by Open.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package rtpfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rtpPacket builds a minimal RTP packet with an Opus payload type
+func rtpPacket(seq uint16, payload []byte) []byte {
+	header := []byte{0x80, 111, 0, 0, 0, 0, 0, 0, 0, 0, 0x12, 0x34}
+	binary.BigEndian.PutUint16(header[2:], seq)
+	binary.BigEndian.PutUint32(header[4:], uint32(seq)*960)
+	return append(header, payload...)
+}
+
+func TestRoundTrip(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, format := range []Format{RTPDump, Pcap} {
+		t.Run(format.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "capture")
+			w, err := Create(path, format)
+			require.NoError(t, err)
+
+			var packets []Packet
+			for i := 0; i < 50; i++ {
+				p := Packet{
+					Time: start.Add(time.Duration(i) * 20 * time.Millisecond),
+					Data: rtpPacket(uint16(i), bytes.Repeat([]byte{byte(i)}, 3+i*4)),
+				}
+				packets = append(packets, p)
+				require.NoError(t, w.WritePacket(p.Time, p.Data))
+			}
+			require.NoError(t, w.Close())
+			assert.ErrorIs(t, w.WritePacket(start, packets[0].Data), ErrClosed)
+
+			r, err := Open(path)
+			require.NoError(t, err)
+			defer r.Close()
+			assert.Equal(t, format, r.Format())
+			for i, want := range packets {
+				got, err := r.ReadPacket()
+				require.NoError(t, err, "packet %d", i)
+				assert.Equal(t, want.Data, got.Data, "packet %d", i)
+				assert.True(t, want.Time.Equal(got.Time), "packet %d: got %v, want %v", i, got.Time, want.Time)
+			}
+			_, err = r.ReadPacket()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+func TestPcapHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Pcap)
+	require.NoError(t, err)
+	packet := rtpPacket(1, []byte{1, 2, 3})
+	require.NoError(t, w.WritePacket(time.Unix(1, 0), packet))
+
+	frame := buf.Bytes()[24+16:]
+	require.Len(t, frame, ipv4HeaderSize+udpHeaderSize+len(packet))
+	assert.Zero(t, ipChecksum(frame[:ipv4HeaderSize]), "IPv4 header checksum")
+	assert.Equal(t, uint16(udpHeaderSize+len(packet)), binary.BigEndian.Uint16(frame[ipv4HeaderSize+4:]))
+}
+
+func TestReaderSkipsRTCP(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Pcap)
+	require.NoError(t, err)
+	// Receiver report (PT 201) multiplexed with the media
+	rtcp := []byte{0x80, 201, 0, 1, 0, 0, 0x12, 0x34}
+	require.NoError(t, w.WritePacket(time.Unix(1, 0), rtcp))
+	packet := rtpPacket(7, []byte{9})
+	require.NoError(t, w.WritePacket(time.Unix(2, 0), packet))
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	got, err := r.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, packet, got.Data)
+	_, err = r.ReadPacket()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReaderEthernet(t *testing.T) {
+	var raw bytes.Buffer
+	w, err := NewWriter(&raw, Pcap)
+	require.NoError(t, err)
+	packet := rtpPacket(3, []byte{4, 5})
+	require.NoError(t, w.WritePacket(time.Unix(5, 250000000), packet))
+
+	// Rewrite the capture with Ethernet framing as a big-endian file
+	ip := raw.Bytes()[24+16:]
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.BigEndian.PutUint32(header[0:], pcapMagic)
+	binary.BigEndian.PutUint32(header[16:], 65535)
+	binary.BigEndian.PutUint32(header[20:], linkTypeEther)
+	buf.Write(header)
+	record := make([]byte, 16)
+	binary.BigEndian.PutUint32(record[0:], 5)
+	binary.BigEndian.PutUint32(record[4:], 250000)
+	binary.BigEndian.PutUint32(record[8:], uint32(14+len(ip)))
+	binary.BigEndian.PutUint32(record[12:], uint32(14+len(ip)))
+	buf.Write(record)
+	buf.Write(make([]byte, 12)) // MAC addresses
+	buf.Write([]byte{0x08, 0x00})
+	buf.Write(ip)
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	got, err := r.ReadPacket()
+	require.NoError(t, err)
+	assert.Equal(t, packet, got.Data)
+	assert.True(t, time.Unix(5, 250000000).Equal(got.Time))
+}
+
+func TestReaderInvalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("not a capture file at all")))
+	assert.ErrorIs(t, err, ErrFormat)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, RTPDump)
+	require.NoError(t, err)
+	require.NoError(t, w.WritePacket(time.Unix(1, 0), rtpPacket(1, []byte{1, 2, 3})))
+	r, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	require.NoError(t, err)
+	_, err = r.ReadPacket()
+	assert.ErrorIs(t, err, ErrFormat)
+}
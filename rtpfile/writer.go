@@ -0,0 +1,195 @@
+// Package rtpfile reads and writes captured RTP packets in the rtpdump
+// format of rtptools and in pcap files that Wireshark can decode.
+package rtpfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Format is the container of a capture file
+type Format int
+
+const (
+	RTPDump Format = iota // rtptools "#!rtpplay1.0" format
+	Pcap                  // libpcap with synthesized IPv4/UDP headers
+)
+
+func (f Format) String() string {
+	switch f {
+	case RTPDump:
+		return "rtpdump"
+	case Pcap:
+		return "pcap"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Addresses written to the capture headers. The packets are received over
+// an encrypted WebRTC transport, so the real addresses are not known here.
+var (
+	sourceAddr = [4]byte{192, 0, 2, 1} // TEST-NET-1
+	destAddr   = [4]byte{192, 0, 2, 2}
+)
+
+const (
+	sourcePort = 5004
+	destPort   = 5006
+
+	rtpdumpMagic   = "#!rtpplay1.0"
+	pcapMagic      = 0xa1b2c3d4 // Microsecond timestamps
+	pcapMagicNano  = 0xa1b23c4d // Nanosecond timestamps
+	linkTypeEther  = 1
+	linkTypeRaw    = 101
+	maxPacketSize  = 65535 - 28 // Largest UDP payload in IPv4
+	ipv4HeaderSize = 20
+	udpHeaderSize  = 8
+)
+
+// ErrClosed is returned when writing to a closed Writer.
+var ErrClosed = errors.New("rtpfile: writer closed")
+
+// Writer appends packets to a capture file.
+type Writer struct {
+	w      io.Writer
+	closer io.Closer
+	format Format
+	start  time.Time // Time of the first packet, rtpdump offsets are relative to it
+	ipID   uint16
+	buf    []byte
+	closed bool
+}
+
+// Create creates the named capture file.
+func Create(path string, format Format) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+	w, err := NewWriter(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
+}
+
+// NewWriter returns a Writer that writes the capture to w. The caller
+// remains responsible for closing w.
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	wr := &Writer{w: w, format: format}
+	switch format {
+	case RTPDump:
+		// The header holds the start time, so it is written with the first packet
+	case Pcap:
+		header := make([]byte, 24)
+		binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+		binary.LittleEndian.PutUint16(header[4:], 2) // Version 2.4
+		binary.LittleEndian.PutUint16(header[6:], 4)
+		binary.LittleEndian.PutUint32(header[16:], 65535) // Snapshot length
+		binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+		if _, err := w.Write(header); err != nil {
+			return nil, fmt.Errorf("failed to write capture header: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported capture format: %v", format)
+	}
+	return wr, nil
+}
+
+// WritePacket appends a marshalled RTP packet received at the given time.
+func (w *Writer) WritePacket(at time.Time, packet []byte) error {
+	if w.closed {
+		return ErrClosed
+	}
+	if len(packet) > maxPacketSize {
+		return fmt.Errorf("packet too large: %d bytes", len(packet))
+	}
+	if w.format == RTPDump {
+		return w.writeRTPDump(at, packet)
+	}
+	return w.writePcap(at, packet)
+}
+
+func (w *Writer) writeRTPDump(at time.Time, packet []byte) error {
+	if w.start.IsZero() {
+		w.start = at
+		header := fmt.Appendf(nil, "%s %d.%d.%d.%d/%d\n", rtpdumpMagic,
+			sourceAddr[0], sourceAddr[1], sourceAddr[2], sourceAddr[3], sourcePort)
+		header = binary.BigEndian.AppendUint32(header, uint32(at.Unix()))
+		header = binary.BigEndian.AppendUint32(header, uint32(at.Nanosecond()/1000))
+		header = append(header, sourceAddr[:]...)
+		header = binary.BigEndian.AppendUint16(header, sourcePort)
+		header = binary.BigEndian.AppendUint16(header, 0) // Padding
+		if _, err := w.w.Write(header); err != nil {
+			return fmt.Errorf("failed to write capture header: %w", err)
+		}
+	}
+
+	offset := at.Sub(w.start).Milliseconds()
+	if offset < 0 {
+		offset = 0
+	}
+	w.buf = w.buf[:0]
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(8+len(packet)))
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(len(packet)))
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(offset))
+	w.buf = append(w.buf, packet...)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *Writer) writePcap(at time.Time, packet []byte) error {
+	size := ipv4HeaderSize + udpHeaderSize + len(packet)
+	w.buf = w.buf[:0]
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(at.Unix()))
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(at.Nanosecond()/1000))
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(size))
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(size))
+
+	ip := len(w.buf)
+	w.buf = append(w.buf, 0x45, 0) // IPv4, 20-byte header
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(size))
+	w.buf = binary.BigEndian.AppendUint16(w.buf, w.ipID)
+	w.buf = append(w.buf, 0x40, 0, 64, 17, 0, 0) // Don't fragment, TTL 64, UDP, checksum
+	w.buf = append(w.buf, sourceAddr[:]...)
+	w.buf = append(w.buf, destAddr[:]...)
+	binary.BigEndian.PutUint16(w.buf[ip+10:], ipChecksum(w.buf[ip:ip+ipv4HeaderSize]))
+	w.ipID++
+
+	w.buf = binary.BigEndian.AppendUint16(w.buf, sourcePort)
+	w.buf = binary.BigEndian.AppendUint16(w.buf, destPort)
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(udpHeaderSize+len(packet)))
+	w.buf = binary.BigEndian.AppendUint16(w.buf, 0) // No UDP checksum
+	w.buf = append(w.buf, packet...)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func ipChecksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Close closes the underlying file if it was opened by Create.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package voxaudio
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signal generates a mono test signal. Fill writes the samples starting at
+// sample index pos of a stream at sampleRate, so the same signal can be
+// rendered at any rate.
+type Signal interface {
+	Fill(buf []float32, pos int64, sampleRate int)
+}
+
+// SignalFunc adapts a function of the time in seconds to a Signal
+type SignalFunc func(t float64) float32
+
+// Fill evaluates f at each sample time
+func (f SignalFunc) Fill(buf []float32, pos int64, sampleRate int) {
+	for i := range buf {
+		buf[i] = f(float64(pos+int64(i)) / float64(sampleRate))
+	}
+}
+
+// Silence returns a silent signal
+func Silence() Signal {
+	return SignalFunc(func(float64) float32 { return 0 })
+}
+
+// Tone returns a sine wave of freq Hz
+func Tone(freq float64, amplitude float32) Signal {
+	return SignalFunc(func(t float64) float32 {
+		return amplitude * float32(math.Sin(2*math.Pi*freq*t))
+	})
+}
+
+// Sweep returns an exponential sine sweep from one frequency to another,
+// repeated every period
+func Sweep(from, to float64, period time.Duration, amplitude float32) Signal {
+	T := period.Seconds()
+	if from <= 0 || to <= 0 || T <= 0 {
+		return Silence()
+	}
+	if from == to {
+		return Tone(from, amplitude)
+	}
+	k := math.Log(to / from)
+	return SignalFunc(func(t float64) float32 {
+		t = math.Mod(t, T)
+		phase := 2 * math.Pi * from * T / k * (math.Exp(t/T*k) - 1)
+		return amplitude * float32(math.Sin(phase))
+	})
+}
+
+// dtmfTones maps a DTMF key to its low and high frequency
+var dtmfTones = map[rune][2]float64{
+	'1': {697, 1209}, '2': {697, 1336}, '3': {697, 1477}, 'A': {697, 1633},
+	'4': {770, 1209}, '5': {770, 1336}, '6': {770, 1477}, 'B': {770, 1633},
+	'7': {852, 1209}, '8': {852, 1336}, '9': {852, 1477}, 'C': {852, 1633},
+	'*': {941, 1209}, '0': {941, 1336}, '#': {941, 1477}, 'D': {941, 1633},
+}
+
+// DTMF returns the dial tones of keys, each sounding for tone followed by
+// gap of silence, then silence after the last key
+func DTMF(keys string, tone, gap time.Duration, amplitude float32) (Signal, error) {
+	var pairs [][2]float64
+	for _, key := range strings.ToUpper(keys) {
+		pair, ok := dtmfTones[key]
+		if !ok {
+			return nil, fmt.Errorf("invalid DTMF key %q", key)
+		}
+		pairs = append(pairs, pair)
+	}
+	step := (tone + gap).Seconds()
+	if step <= 0 {
+		return nil, fmt.Errorf("invalid DTMF timing: %v tone, %v gap", tone, gap)
+	}
+	return SignalFunc(func(t float64) float32 {
+		i := int(t / step)
+		if i >= len(pairs) {
+			return 0
+		}
+		offset := t - float64(i)*step
+		if offset >= tone.Seconds() {
+			return 0
+		}
+		// Each of the two tones at half amplitude so the sum stays in range
+		low, high := pairs[i][0], pairs[i][1]
+		return amplitude / 2 * float32(math.Sin(2*math.Pi*low*offset)+math.Sin(2*math.Pi*high*offset))
+	}), nil
+}
+
+// Clicks returns a train of 1ms rectangular pulses every interval. The
+// pulses start at time 0, so they mark known instants for latency checks.
+func Clicks(interval time.Duration, amplitude float32) Signal {
+	every := interval.Seconds()
+	return SignalFunc(func(t float64) float32 {
+		if every > 0 && math.Mod(t, every) < 0.001 {
+			return amplitude
+		}
+		return 0
+	})
+}
+
+// whiteNoise is uniform noise derived from the sample index, so any part of
+// the stream can be rendered independently
+type whiteNoise struct {
+	amplitude float32
+	seed      uint64
+}
+
+// WhiteNoise returns uniform white noise; equal seeds give equal noise
+func WhiteNoise(amplitude float32, seed uint64) Signal {
+	return whiteNoise{amplitude: amplitude, seed: seed}
+}
+
+func (n whiteNoise) Fill(buf []float32, pos int64, sampleRate int) {
+	for i := range buf {
+		buf[i] = n.amplitude * noiseSample(n.seed, pos+int64(i))
+	}
+}
+
+// noiseSample returns a uniform value in [-1, 1) for index
+func noiseSample(seed uint64, index int64) float32 {
+	// splitmix64
+	z := seed + uint64(index)*0x9E3779B97F4A7C15
+	z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+	z = (z ^ z>>27) * 0x94D049BB133111EB
+	z ^= z >> 31
+	return float32(z>>40)/float32(1<<23) - 1
+}
+
+// pinkNoise filters white noise to a -3 dB/octave spectrum with Paul
+// Kellet's economy filter. It is rendered sequentially; a jump in the
+// position restarts the filter.
+type pinkNoise struct {
+	mu         sync.Mutex
+	amplitude  float32
+	seed       uint64
+	next       int64
+	b0, b1, b2 float32
+}
+
+// PinkNoise returns pink noise; equal seeds give equal noise
+func PinkNoise(amplitude float32, seed uint64) Signal {
+	return &pinkNoise{amplitude: amplitude, seed: seed}
+}
+
+func (n *pinkNoise) Fill(buf []float32, pos int64, sampleRate int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if pos != n.next {
+		n.b0, n.b1, n.b2 = 0, 0, 0
+	}
+	for i := range buf {
+		white := noiseSample(n.seed, pos+int64(i))
+		n.b0 = 0.99765*n.b0 + white*0.0990460
+		n.b1 = 0.96300*n.b1 + white*0.2965164
+		n.b2 = 0.57000*n.b2 + white*1.0526913
+		// The filter has a gain of about 4, scale back to the white noise level
+		buf[i] = n.amplitude * (n.b0 + n.b1 + n.b2 + white*0.1848) / 4
+	}
+	n.next = pos + int64(len(buf))
+}
+
+// signalChunk is the amount of audio delivered by a SignalSource at a time
+const signalChunk = 20 * time.Millisecond
+
+// SignalSource renders a Signal as an AudioSource, for calibration and for
+// tests that need known input in place of a LoopbackRecorder.
+type SignalSource struct {
+	mu         sync.Mutex
+	signal     Signal
+	sampleRate int
+	channels   int
+	gains      []float32     // Per channel gain, default 1 on every channel
+	duration   time.Duration // 0 generates until stopped
+	speed      float64       // Relative to real time, 0 delivers as fast as possible
+
+	audio    chan []float32
+	stopCh   chan struct{}
+	done     chan struct{}
+	frames   int64
+	started  bool
+	stopOnce sync.Once
+}
+
+// NewSignalSource returns a source of signal at the given rate and channel
+// count. It delivers in real time until stopped unless SetDuration or
+// SetSpeed is called.
+func NewSignalSource(signal Signal, sampleRate, channels int) (*SignalSource, error) {
+	if sampleRate <= 0 || channels <= 0 {
+		return nil, fmt.Errorf("invalid signal format: %d Hz, %d channels", sampleRate, channels)
+	}
+	return &SignalSource{
+		signal:     signal,
+		sampleRate: sampleRate,
+		channels:   channels,
+		speed:      1,
+		audio:      make(chan []float32, 16),
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// SetDuration ends the signal after d
+// Note: 0 generates until Stop is called
+func (s *SignalSource) SetDuration(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.duration = d
+}
+
+// SetSpeed sets the delivery speed relative to real time
+// Note: 0 delivers as fast as the consumer reads
+func (s *SignalSource) SetSpeed(speed float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speed = speed
+}
+
+// SetChannelGains scales the signal per channel, e.g. {1, 0} plays it on
+// the left channel only. Missing channels are silent.
+func (s *SignalSource) SetChannelGains(gains []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gains = append([]float32(nil), gains...)
+}
+
+// Start begins generating. The device name is ignored.
+func (s *SignalSource) Start(deviceName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("signal source already started")
+	}
+	s.started = true
+	go s.run()
+	return nil
+}
+
+// Stop ends the signal and closes the audio channel
+func (s *SignalSource) Stop() error {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.started {
+			s.started = true
+			go s.run()
+		}
+	})
+	<-s.done
+	return nil
+}
+
+// Audio returns the channel of generated samples
+func (s *SignalSource) Audio() <-chan []float32 {
+	return s.audio
+}
+
+// Format returns the sample rate and channel count of the generated audio
+func (s *SignalSource) Format() (int, int) {
+	return s.sampleRate, s.channels
+}
+
+// Position returns how much of the signal has been delivered
+func (s *SignalSource) Position() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.frames) * time.Second / time.Duration(s.sampleRate)
+}
+
+// Done is closed when the signal has ended or the source is stopped
+func (s *SignalSource) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *SignalSource) run() {
+	defer close(s.done)
+	defer close(s.audio)
+
+	s.mu.Lock()
+	speed, duration := s.speed, s.duration
+	gains := s.gains
+	if gains == nil {
+		gains = make([]float32, s.channels)
+		for i := range gains {
+			gains[i] = 1
+		}
+	}
+	s.mu.Unlock()
+
+	chunkFrames := int(int64(s.sampleRate) * int64(signalChunk) / int64(time.Second))
+	total := int64(duration) * int64(s.sampleRate) / int64(time.Second)
+	mono := make([]float32, chunkFrames)
+	next := time.Now()
+
+	for pos := int64(0); duration == 0 || pos < total; {
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+
+		frames := chunkFrames
+		if duration > 0 && total-pos < int64(frames) {
+			frames = int(total - pos)
+		}
+		s.signal.Fill(mono[:frames], pos, s.sampleRate)
+		chunk := make([]float32, frames*s.channels)
+		for i, v := range mono[:frames] {
+			for c := 0; c < s.channels; c++ {
+				if c < len(gains) {
+					chunk[i*s.channels+c] = v * gains[c]
+				}
+			}
+		}
+
+		if speed > 0 {
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-s.stopCh:
+					return
+				case <-time.After(wait):
+				}
+			}
+			d := time.Duration(frames) * time.Second / time.Duration(s.sampleRate)
+			next = next.Add(time.Duration(float64(d) / speed))
+		}
+
+		select {
+		case <-s.stopCh:
+			return
+		case s.audio <- chunk:
+			pos += int64(frames)
+			s.mu.Lock()
+			s.frames = pos
+			s.mu.Unlock()
+		}
+	}
+}
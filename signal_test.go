@@ -0,0 +1,178 @@
+package voxaudio
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// render returns n samples of signal at rate
+func render(signal Signal, n, rate int) []float32 {
+	buf := make([]float32, n)
+	signal.Fill(buf, 0, rate)
+	return buf
+}
+
+// goertzel returns the power of freq in samples
+func goertzel(samples []float32, freq float64, rate int) float64 {
+	coeff := 2 * math.Cos(2*math.Pi*freq/float64(rate))
+	var s1, s2 float64
+	for _, v := range samples {
+		s0 := float64(v) + coeff*s1 - s2
+		s2, s1 = s1, s0
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
+
+// zeroCrossings counts the sign changes of samples
+func zeroCrossings(samples []float32) int {
+	n := 0
+	for i := 1; i < len(samples); i++ {
+		if (samples[i-1] < 0) != (samples[i] < 0) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestToneAndSweep(t *testing.T) {
+	tone := render(Tone(1000, 0.5), 48000, 48000)
+	assert.InDelta(t, 0.5, tone[12], 1e-6, "peak a quarter period in")
+	assert.InDelta(t, 2000, zeroCrossings(tone), 2)
+
+	// 100 Hz to 10 kHz over one second: the frequency rises by 10x every half second
+	sweep := render(Sweep(100, 10000, time.Second, 1), 48000, 48000)
+	// Two zero crossings per cycle, so crossings in 100ms times 5 is the mean frequency
+	start := zeroCrossings(sweep[:4800]) * 5
+	end := zeroCrossings(sweep[43200:]) * 5
+	assert.InDelta(t, 127, start, 10, "mean frequency of the first 100ms")
+	assert.InDelta(t, 8013, end, 50, "mean frequency of the last 100ms")
+
+	// The sweep repeats
+	again := make([]float32, 100)
+	Sweep(100, 10000, time.Second, 1).Fill(again, 48000, 48000)
+	assert.InDeltaSlice(t, sweep[:100], again, 1e-4)
+}
+
+func TestDTMF(t *testing.T) {
+	_, err := DTMF("12x", 50*time.Millisecond, 50*time.Millisecond, 1)
+	assert.Error(t, err)
+
+	signal, err := DTMF("5#", 80*time.Millisecond, 20*time.Millisecond, 1)
+	require.NoError(t, err)
+	samples := render(signal, 8000*3/10, 8000) // 300ms at 8 kHz
+
+	five := samples[:640]
+	assert.Greater(t, goertzel(five, 770, 8000), 100*goertzel(five, 697, 8000))
+	assert.Greater(t, goertzel(five, 1336, 8000), 100*goertzel(five, 1209, 8000))
+	hash := samples[800:1440]
+	assert.Greater(t, goertzel(hash, 941, 8000), 100*goertzel(hash, 852, 8000))
+	assert.Greater(t, goertzel(hash, 1477, 8000), 100*goertzel(hash, 1633, 8000))
+
+	for _, v := range samples[640:800] {
+		assert.Zero(t, v, "gap after the first key")
+	}
+	for _, v := range samples[1600:] {
+		assert.Zero(t, v, "silence after the last key")
+	}
+}
+
+func TestNoise(t *testing.T) {
+	white := render(WhiteNoise(0.5, 1), 48000, 48000)
+	var sum, squares float64
+	for _, v := range white {
+		require.LessOrEqual(t, math.Abs(float64(v)), 0.5)
+		sum += float64(v)
+		squares += float64(v) * float64(v)
+	}
+	assert.InDelta(t, 0, sum/48000, 0.01)
+	assert.InDelta(t, 0.5/math.Sqrt(3), math.Sqrt(squares/48000), 0.01, "RMS of uniform noise")
+	assert.Equal(t, white, render(WhiteNoise(0.5, 1), 48000, 48000), "equal seeds give equal noise")
+	assert.NotEqual(t, white[:10], render(WhiteNoise(0.5, 2), 10, 48000))
+
+	part := make([]float32, 100)
+	WhiteNoise(0.5, 1).Fill(part, 1000, 48000)
+	assert.Equal(t, white[1000:1100], part, "any part renders independently")
+
+	// Pink noise rendered in chunks equals a single render, and has more
+	// energy in the lowest octaves than white noise of the same level
+	pink := PinkNoise(0.5, 1)
+	chunked := make([]float32, 48000)
+	for pos := 0; pos < len(chunked); pos += 960 {
+		pink.Fill(chunked[pos:pos+960], int64(pos), 48000)
+	}
+	assert.Equal(t, render(PinkNoise(0.5, 1), 48000, 48000), chunked)
+	low := goertzel(chunked, 50, 48000) / goertzel(chunked, 10000, 48000)
+	assert.Greater(t, low, 10.0)
+}
+
+func TestClicks(t *testing.T) {
+	samples := render(Clicks(250*time.Millisecond, 0.8), 16000, 16000)
+	var starts []int
+	for i, v := range samples {
+		if v != 0 && (i == 0 || samples[i-1] == 0) {
+			starts = append(starts, i)
+			assert.Equal(t, float32(0.8), v)
+		}
+	}
+	assert.Equal(t, []int{0, 4000, 8000, 12000}, starts)
+	assert.Equal(t, float32(0.8), samples[4015], "pulses last 1ms")
+	assert.Zero(t, samples[4016])
+}
+
+func TestSignalSource(t *testing.T) {
+	_, err := NewSignalSource(Silence(), 0, 1)
+	assert.Error(t, err)
+
+	source, err := NewSignalSource(Tone(440, 0.5), 16000, 2)
+	require.NoError(t, err)
+	source.SetDuration(110 * time.Millisecond)
+	source.SetSpeed(0)
+	source.SetChannelGains([]float32{1})
+	var _ AudioSource = source
+
+	require.NoError(t, source.Start(""))
+	assert.Error(t, source.Start(""))
+	rate, channels := source.Format()
+	assert.Equal(t, 16000, rate)
+	assert.Equal(t, 2, channels)
+
+	var got []float32
+	var chunks int
+	for chunk := range source.Audio() {
+		got = append(got, chunk...)
+		chunks++
+	}
+	<-source.Done()
+	assert.Equal(t, 6, chunks, "20ms chunks, the last one short")
+	require.Len(t, got, 1760*2)
+	want := render(Tone(440, 0.5), 1760, 16000)
+	for i := range want {
+		require.Equal(t, want[i], got[i*2], "left channel, frame %d", i)
+		require.Zero(t, got[i*2+1], "right channel, frame %d", i)
+	}
+	assert.Equal(t, 110*time.Millisecond, source.Position())
+	require.NoError(t, source.Stop())
+
+	// Stop before Start closes the channel
+	source, err = NewSignalSource(Silence(), 16000, 1)
+	require.NoError(t, err)
+	require.NoError(t, source.Stop())
+	_, ok := <-source.Audio()
+	assert.False(t, ok)
+}
+
+func TestSignalSourceRealtime(t *testing.T) {
+	source, err := NewSignalSource(Silence(), 8000, 1)
+	require.NoError(t, err)
+	require.NoError(t, source.Start(""))
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		<-source.Audio()
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	require.NoError(t, source.Stop())
+}
@@ -0,0 +1,458 @@
+package voxaudio
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SubtitleFormat selects the syntax of subtitle files
+type SubtitleFormat int
+
+const (
+	SubtitleSRT    SubtitleFormat = iota // SubRip (.srt)
+	SubtitleWebVTT                       // WebVTT (.vtt)
+)
+
+// Extension returns the file extension of the format, including the dot
+func (f SubtitleFormat) Extension() string {
+	if f == SubtitleWebVTT {
+		return ".vtt"
+	}
+	return ".srt"
+}
+
+// Cue is a piece of text shown between Start and End
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // Lines are separated by "\n"
+}
+
+// SubtitleOptions controls how transcript segments are turned into cues
+type SubtitleOptions struct {
+	MaxLineLength int           // Characters per line, default 42
+	MaxLines      int           // Lines per cue, default 2
+	MinDuration   time.Duration // Shortest cue, default 1s (never overlaps the next cue)
+	MaxDuration   time.Duration // Longer segments are split, default 7s
+	MergeGap      time.Duration // Merge segments separated by at most this gap if they fit in one cue, 0 disables
+}
+
+func (o SubtitleOptions) withDefaults() SubtitleOptions {
+	if o.MaxLineLength <= 0 {
+		o.MaxLineLength = 42
+	}
+	if o.MaxLines <= 0 {
+		o.MaxLines = 2
+	}
+	if o.MinDuration <= 0 {
+		o.MinDuration = time.Second
+	}
+	if o.MaxDuration <= 0 {
+		o.MaxDuration = 7 * time.Second
+	}
+	return o
+}
+
+// BuildCues merges, splits and wraps transcript segments into cues
+func (o SubtitleOptions) BuildCues(segments []Cue) []Cue {
+	o = o.withDefaults()
+	maxChars := o.MaxLineLength * o.MaxLines
+
+	// Normalize and order the segments
+	var segs []Cue
+	for _, seg := range segments {
+		seg.Text = strings.Join(strings.Fields(seg.Text), " ")
+		if seg.Text == "" {
+			continue
+		}
+		if seg.End < seg.Start {
+			seg.End = seg.Start
+		}
+		segs = append(segs, seg)
+	}
+	sort.SliceStable(segs, func(i, j int) bool { return segs[i].Start < segs[j].Start })
+
+	// Merge short neighbouring segments
+	var merged []Cue
+	for _, seg := range segs {
+		if n := len(merged); n > 0 && o.MergeGap > 0 {
+			prev := &merged[n-1]
+			text := joinSegments(prev.Text, seg.Text)
+			if seg.Start-prev.End <= o.MergeGap &&
+				seg.End-prev.Start <= o.MaxDuration &&
+				len(o.wrap(tokenize(text))) <= o.MaxLines {
+				prev.Text = text
+				if seg.End > prev.End {
+					prev.End = seg.End
+				}
+				continue
+			}
+		}
+		merged = append(merged, seg)
+	}
+
+	// Split long segments, sharing the time by character count
+	var cues []Cue
+	for _, seg := range merged {
+		tokens := tokenize(seg.Text)
+		total := utf8.RuneCountInString(seg.Text)
+		parts := int((seg.End - seg.Start + o.MaxDuration - 1) / o.MaxDuration)
+		target := maxChars
+		if parts > 1 && (total+parts-1)/parts < target {
+			target = (total + parts - 1) / parts
+		}
+
+		chunks := o.pack(tokens, target)
+		start := seg.Start
+		for i, chunk := range chunks {
+			text := joinTokens(chunk)
+			end := seg.End
+			if i < len(chunks)-1 {
+				share := float64(utf8.RuneCountInString(text)) / float64(total)
+				end = start + time.Duration(share*float64(seg.End-seg.Start))
+			}
+			cues = append(cues, Cue{Start: start, End: end, Text: strings.Join(o.wrap(chunk), "\n")})
+			start = end
+		}
+	}
+
+	// Enforce the minimum duration without overlapping the next cue
+	for i := range cues {
+		if cues[i].End-cues[i].Start >= o.MinDuration {
+			continue
+		}
+		end := cues[i].Start + o.MinDuration
+		if i+1 < len(cues) && cues[i+1].Start < end {
+			end = cues[i+1].Start
+		}
+		if end > cues[i].End {
+			cues[i].End = end
+		}
+	}
+	return cues
+}
+
+// pack groups tokens into chunks of at most target characters that wrap into MaxLines lines
+func (o SubtitleOptions) pack(tokens []token, target int) [][]token {
+	var chunks [][]token
+	var current []token
+	for _, tok := range tokens {
+		candidate := append(append([]token(nil), current...), tok)
+		if len(current) > 0 &&
+			(utf8.RuneCountInString(joinTokens(candidate)) > target || len(o.wrap(candidate)) > o.MaxLines) {
+			chunks = append(chunks, current)
+			candidate = []token{{text: tok.text}}
+		}
+		current = candidate
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// wrap breaks tokens into lines of at most MaxLineLength characters
+func (o SubtitleOptions) wrap(tokens []token) []string {
+	var lines []string
+	var line []token
+	for _, tok := range tokens {
+		if len(line) > 0 && utf8.RuneCountInString(joinTokens(append(line, tok))) > o.MaxLineLength {
+			lines = append(lines, joinTokens(line))
+			line = nil
+			tok.space = false
+		}
+		line = append(line, tok)
+	}
+	if len(line) > 0 {
+		lines = append(lines, joinTokens(line))
+	}
+	return lines
+}
+
+// token is a word, or a single character of a script written without spaces
+type token struct {
+	text  string
+	space bool // Preceded by a space
+}
+
+func tokenize(text string) []token {
+	var tokens []token
+	for i, word := range strings.Fields(text) {
+		space := i > 0
+		var run strings.Builder
+		for _, r := range word {
+			if isUnspacedScript(r) {
+				if run.Len() > 0 {
+					tokens = append(tokens, token{text: run.String(), space: space})
+					run.Reset()
+					space = false
+				}
+				tokens = append(tokens, token{text: string(r), space: space})
+				space = false
+				continue
+			}
+			run.WriteRune(r)
+		}
+		if run.Len() > 0 {
+			tokens = append(tokens, token{text: run.String(), space: space})
+		}
+	}
+	return tokens
+}
+
+func isUnspacedScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF) // CJK punctuation, full-width forms
+}
+
+// joinSegments joins two texts with a space unless both sides are unspaced script
+func joinSegments(a, b string) string {
+	last, _ := utf8.DecodeLastRuneInString(a)
+	first, _ := utf8.DecodeRuneInString(b)
+	if isUnspacedScript(last) && isUnspacedScript(first) {
+		return a + b
+	}
+	return a + " " + b
+}
+
+func joinTokens(tokens []token) string {
+	var b strings.Builder
+	for i, tok := range tokens {
+		if i > 0 && tok.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String()
+}
+
+// WriteSubtitles writes cues to w in the given format
+func WriteSubtitles(w io.Writer, format SubtitleFormat, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	sep := ","
+	if format == SubtitleWebVTT {
+		sep = "."
+		bw.WriteString("WEBVTT\n\n")
+	}
+	for i, cue := range cues {
+		if format == SubtitleSRT {
+			fmt.Fprintf(bw, "%d\n", i+1)
+		}
+		fmt.Fprintf(bw, "%s --> %s\n%s\n\n",
+			formatCueTime(cue.Start, sep), formatCueTime(cue.End, sep), cue.Text)
+	}
+	return bw.Flush()
+}
+
+func formatCueTime(d time.Duration, sep string) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// SubtitleWriter collects the source and translation transcripts of a session
+// and writes them as subtitles. Source cues are timed by the server's voice
+// activity detection, translation cues by the playback of the translated audio.
+type SubtitleWriter struct {
+	mu      sync.Mutex
+	session *Session
+	options SubtitleOptions
+	origin  time.Time
+
+	source      map[string]*Cue // Keyed by conversation item ID
+	translation map[string]*Cue // Keyed by response ID
+}
+
+// NewSubtitleWriter starts collecting transcripts from session.
+// It enables input audio transcription, so it must be created before Start.
+func NewSubtitleWriter(session *Session, options SubtitleOptions) *SubtitleWriter {
+	w := &SubtitleWriter{
+		session:     session,
+		options:     options,
+		source:      make(map[string]*Cue),
+		translation: make(map[string]*Cue),
+	}
+	if session.transcriptionModel == "" {
+		session.SetInputTranscription(defaultTranscriptionModel)
+	}
+
+	session.OnEvent(EventSpeechStarted, func(evt ServerEvent) {
+		cue := w.sourceCue(evt)
+		start := w.inputOffset(evt, evt.AudioStartMs)
+		w.mu.Lock()
+		cue.Start = start
+		w.mu.Unlock()
+	})
+	session.OnEvent(EventSpeechStopped, func(evt ServerEvent) {
+		cue := w.sourceCue(evt)
+		end := w.inputOffset(evt, evt.AudioEndMs)
+		w.mu.Lock()
+		cue.End = end
+		w.mu.Unlock()
+	})
+	session.OnEvent(EventInputTranscriptionDone, func(evt ServerEvent) {
+		cue := w.sourceCue(evt)
+		w.mu.Lock()
+		cue.Text = evt.Transcript
+		w.mu.Unlock()
+	})
+	session.OnEvent(EventOutputAudioStarted, func(evt ServerEvent) {
+		cue := w.translationCue(evt)
+		w.mu.Lock()
+		cue.Start = w.offset(evt.Received)
+		w.mu.Unlock()
+	})
+	session.OnEvent(EventResponseAudioTranscript, func(evt ServerEvent) {
+		w.translationCue(evt) // Fallback start if playback events are not sent
+	})
+	session.OnEvent(EventResponseAudioTranscriptEnd, func(evt ServerEvent) {
+		cue := w.translationCue(evt)
+		w.mu.Lock()
+		cue.Text = evt.Transcript
+		w.mu.Unlock()
+	})
+	// Text only sessions send the translation as text
+	session.OnEvent(EventResponseTextDelta, func(evt ServerEvent) {
+		w.translationCue(evt)
+	})
+	session.OnEvent(EventResponseTextDone, func(evt ServerEvent) {
+		cue := w.translationCue(evt)
+		w.mu.Lock()
+		cue.Text = evt.Text
+		w.mu.Unlock()
+	})
+	session.OnEvent(EventResponseDone, func(evt ServerEvent) {
+		var done struct {
+			Response struct {
+				ID string `json:"id"`
+			} `json:"response"`
+		}
+		if json.Unmarshal(evt.Raw, &done) != nil || done.Response.ID == "" {
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		// Playback usually continues after the response is generated;
+		// output_audio_buffer.stopped refines this end time
+		if cue, ok := w.translation[done.Response.ID]; ok && cue.End == 0 {
+			cue.End = w.offset(evt.Received)
+		}
+	})
+	session.OnEvent(EventOutputAudioStopped, func(evt ServerEvent) {
+		cue := w.translationCue(evt)
+		w.mu.Lock()
+		cue.End = w.offset(evt.Received)
+		w.mu.Unlock()
+	})
+	return w
+}
+
+// SetOrigin sets the time that corresponds to 00:00:00 in the subtitles.
+// By default it is the moment the first input audio was uploaded.
+func (w *SubtitleWriter) SetOrigin(origin time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.origin = origin
+}
+
+// offset converts a local time to subtitle time; the caller holds w.mu
+func (w *SubtitleWriter) offset(t time.Time) time.Duration {
+	if w.origin.IsZero() {
+		w.origin = w.session.inputStartTime()
+		if w.origin.IsZero() {
+			w.origin = t
+		}
+	}
+	return t.Sub(w.origin)
+}
+
+// inputOffset converts a position in the uploaded audio to subtitle time
+func (w *SubtitleWriter) inputOffset(evt ServerEvent, audioMs int) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	start := w.session.inputStartTime()
+	if start.IsZero() {
+		return w.offset(evt.Received)
+	}
+	return w.offset(start.Add(time.Duration(audioMs) * time.Millisecond))
+}
+
+func (w *SubtitleWriter) sourceCue(evt ServerEvent) *Cue {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cue, ok := w.source[evt.ItemID]
+	if !ok {
+		at := w.offset(evt.Received)
+		cue = &Cue{Start: at, End: at}
+		w.source[evt.ItemID] = cue
+	}
+	return cue
+}
+
+func (w *SubtitleWriter) translationCue(evt ServerEvent) *Cue {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cue, ok := w.translation[evt.ResponseID]
+	if !ok {
+		cue = &Cue{Start: w.offset(evt.Received)}
+		w.translation[evt.ResponseID] = cue
+	}
+	return cue
+}
+
+// SourceCues returns the cues of the original speech
+func (w *SubtitleWriter) SourceCues() []Cue {
+	return w.options.BuildCues(w.segments(w.source))
+}
+
+// TranslationCues returns the cues of the translated speech
+func (w *SubtitleWriter) TranslationCues() []Cue {
+	return w.options.BuildCues(w.segments(w.translation))
+}
+
+func (w *SubtitleWriter) segments(cues map[string]*Cue) []Cue {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	segments := make([]Cue, 0, len(cues))
+	for _, cue := range cues {
+		segments = append(segments, *cue)
+	}
+	return segments
+}
+
+// WriteFiles writes basePath.source and basePath.translation subtitle files
+// with the extension of format
+func (w *SubtitleWriter) WriteFiles(basePath string, format SubtitleFormat) error {
+	files := []struct {
+		name string
+		cues []Cue
+	}{
+		{basePath + ".source" + format.Extension(), w.SourceCues()},
+		{basePath + ".translation" + format.Extension(), w.TranslationCues()},
+	}
+	for _, f := range files {
+		file, err := os.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("failed to create subtitle file: %w", err)
+		}
+		err = WriteSubtitles(file, format, f.cues)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write subtitle file: %w", err)
+		}
+	}
+	return nil
+}
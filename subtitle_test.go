@@ -0,0 +1,130 @@
+package voxaudio
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSubtitles(t *testing.T) {
+	cues := []Cue{
+		{Start: 1500 * time.Millisecond, End: 3 * time.Second, Text: "Hello"},
+		{Start: time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond, End: time.Hour + 2*time.Minute + 5*time.Second, Text: "two\nlines"},
+	}
+
+	var srt bytes.Buffer
+	require.NoError(t, WriteSubtitles(&srt, SubtitleSRT, cues))
+	assert.Equal(t, "1\n00:00:01,500 --> 00:00:03,000\nHello\n\n"+
+		"2\n01:02:03,004 --> 01:02:05,000\ntwo\nlines\n\n", srt.String())
+
+	var vtt bytes.Buffer
+	require.NoError(t, WriteSubtitles(&vtt, SubtitleWebVTT, cues))
+	assert.Equal(t, "WEBVTT\n\n00:00:01.500 --> 00:00:03.000\nHello\n\n"+
+		"01:02:03.004 --> 01:02:05.000\ntwo\nlines\n\n", vtt.String())
+}
+
+func TestBuildCuesWrapsAndSplits(t *testing.T) {
+	opts := SubtitleOptions{MaxLineLength: 20, MaxLines: 2}
+	text := "the quick brown fox jumps over the lazy dog and keeps running far away"
+	cues := opts.BuildCues([]Cue{{Start: 0, End: 4 * time.Second, Text: text}})
+
+	require.Len(t, cues, 2)
+	var words []string
+	for _, cue := range cues {
+		lines := strings.Split(cue.Text, "\n")
+		assert.LessOrEqual(t, len(lines), 2)
+		for _, line := range lines {
+			assert.LessOrEqual(t, len(line), 20, line)
+		}
+		words = append(words, strings.Fields(cue.Text)...)
+	}
+	assert.Equal(t, text, strings.Join(words, " "))
+
+	// Time is shared by length and the cues are contiguous
+	assert.Equal(t, time.Duration(0), cues[0].Start)
+	assert.Equal(t, cues[0].End, cues[1].Start)
+	assert.Equal(t, 4*time.Second, cues[1].End)
+}
+
+func TestBuildCuesMaxDuration(t *testing.T) {
+	opts := SubtitleOptions{MaxDuration: 3 * time.Second}
+	cues := opts.BuildCues([]Cue{{Start: 0, End: 9 * time.Second, Text: "one two three four five six"}})
+
+	require.GreaterOrEqual(t, len(cues), 3)
+	for _, cue := range cues {
+		assert.LessOrEqual(t, cue.End-cue.Start, 3*time.Second)
+	}
+	assert.Equal(t, 9*time.Second, cues[len(cues)-1].End)
+}
+
+func TestBuildCuesUnspacedScript(t *testing.T) {
+	opts := SubtitleOptions{MaxLineLength: 5, MaxLines: 1}
+	cues := opts.BuildCues([]Cue{{Start: 0, End: 6 * time.Second, Text: "今天天气很好，我们去公园吧"}})
+
+	require.Len(t, cues, 3)
+	assert.Equal(t, "今天天气很", cues[0].Text)
+	assert.Equal(t, "好，我们去", cues[1].Text)
+	assert.Equal(t, "公园吧", cues[2].Text)
+}
+
+func TestBuildCuesMergeAndMinDuration(t *testing.T) {
+	segments := []Cue{
+		{Start: 2 * time.Second, End: 2200 * time.Millisecond, Text: "  again "},
+		{Start: 0, End: 500 * time.Millisecond, Text: "Hi"},
+		{Start: 700 * time.Millisecond, End: 1500 * time.Millisecond, Text: "there"},
+		{Start: 5 * time.Second, End: 5 * time.Second, Text: ""},
+	}
+
+	cues := SubtitleOptions{}.BuildCues(segments)
+	require.Len(t, cues, 3)
+	assert.Equal(t, Cue{Start: 0, End: 700 * time.Millisecond, Text: "Hi"}, cues[0]) // Extended up to the next cue
+	assert.Equal(t, Cue{Start: 700 * time.Millisecond, End: 1700 * time.Millisecond, Text: "there"}, cues[1])
+	assert.Equal(t, Cue{Start: 2 * time.Second, End: 3 * time.Second, Text: "again"}, cues[2])
+
+	cues = SubtitleOptions{MergeGap: 300 * time.Millisecond}.BuildCues(segments)
+	require.Len(t, cues, 2)
+	assert.Equal(t, Cue{Start: 0, End: 1500 * time.Millisecond, Text: "Hi there"}, cues[0])
+	assert.Equal(t, "again", cues[1].Text)
+}
+
+func TestSubtitleWriterCollectsEvents(t *testing.T) {
+	s := &Session{}
+	w := NewSubtitleWriter(s, SubtitleOptions{})
+	assert.Equal(t, defaultTranscriptionModel, s.transcriptionModel)
+
+	origin := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s.inputStartedAt = origin
+	at := func(ms int) time.Time { return origin.Add(time.Duration(ms) * time.Millisecond) }
+	send := func(ms int, format string, args ...interface{}) {
+		require.NoError(t, s.dispatchEvent([]byte(fmt.Sprintf(format, args...)), at(ms)))
+	}
+
+	send(1300, `{"type":"input_audio_buffer.speech_started","item_id":"item1","audio_start_ms":1000}`)
+	send(3300, `{"type":"input_audio_buffer.speech_stopped","item_id":"item1","audio_end_ms":3000}`)
+	send(3400, `{"type":"response.created","response":{"id":"resp1"}}`)
+	send(3500, `{"type":"response.audio_transcript.delta","response_id":"resp1","delta":"Good"}`)
+	send(3600, `{"type":"output_audio_buffer.started","response_id":"resp1"}`)
+	send(3800, `{"type":"conversation.item.input_audio_transcription.completed","item_id":"item1","transcript":"Buenos días"}`)
+	send(4000, `{"type":"response.audio_transcript.done","response_id":"resp1","transcript":"Good morning"}`)
+	send(4100, `{"type":"response.done","response":{"id":"resp1"}}`)
+	send(5200, `{"type":"output_audio_buffer.stopped","response_id":"resp1"}`)
+
+	assert.Equal(t, []Cue{{Start: time.Second, End: 3 * time.Second, Text: "Buenos días"}}, w.SourceCues())
+	assert.Equal(t, []Cue{{Start: 3600 * time.Millisecond, End: 5200 * time.Millisecond, Text: "Good morning"}}, w.TranslationCues())
+
+	base := filepath.Join(t.TempDir(), "talk")
+	require.NoError(t, w.WriteFiles(base, SubtitleWebVTT))
+	data, err := os.ReadFile(base + ".translation.vtt")
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:03.600 --> 00:00:05.200\nGood morning\n\n", string(data))
+	data, err = os.ReadFile(base + ".source.vtt")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "00:00:01.000 --> 00:00:03.000\nBuenos días")
+}
@@ -0,0 +1,45 @@
+package voxaudio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetTextOnly makes the session return translations as text deltas instead
+// of speech. Listen for EventResponseTextDelta and EventResponseTextDone.
+// Note: Takes effect on the next call to Start, or call UpdateSessionSettings
+func (s *Session) SetTextOnly(enabled bool) {
+	s.textOnly = enabled
+}
+
+// modalities returns the output modalities of the session
+func (s *Session) modalities() []string {
+	if s.textOnly {
+		return []string{"text"}
+	}
+	return []string{"audio", "text"}
+}
+
+// TranslateText adds typed text to the conversation as a user message and
+// asks for its translation, which is spoken unless the session is text only
+func (s *Session) TranslateText(text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("empty text")
+	}
+	item := map[string]interface{}{
+		"type": "conversation.item.create",
+		"item": map[string]interface{}{
+			"type":    "message",
+			"role":    "user",
+			"content": []map[string]string{{"type": "input_text", "text": text}},
+		},
+	}
+	if err := s.sendEvent(item); err != nil {
+		return fmt.Errorf("failed to send text: %w", err)
+	}
+	if err := s.sendEvent(map[string]string{"type": "response.create"}); err != nil {
+		return fmt.Errorf("failed to request translation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateText(t *testing.T) {
+	var sent []string
+	s := &Session{sender: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+
+	require.NoError(t, s.TranslateText("  Where is the station?\n"))
+	require.Len(t, sent, 2)
+	assert.JSONEq(t, `{"type":"conversation.item.create","item":{"type":"message","role":"user",`+
+		`"content":[{"type":"input_text","text":"Where is the station?"}]}}`, sent[0])
+	assert.JSONEq(t, `{"type":"response.create"}`, sent[1])
+
+	assert.Error(t, s.TranslateText(" "))
+	assert.Len(t, sent, 2)
+
+	assert.Error(t, (&Session{}).TranslateText("hello"), "no data channel")
+}
+
+func TestTextOnlySession(t *testing.T) {
+	var sent []string
+	s := &Session{voice: "alloy", targetLang: "French", sender: func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}}
+	s.SetTextOnly(true)
+	s.initializeSession()
+	require.Len(t, sent, 1)
+	var update struct {
+		Session struct {
+			Modalities []string `json:"modalities"`
+		} `json:"session"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(sent[0]), &update))
+	assert.Equal(t, []string{"text"}, update.Session.Modalities)
+
+	// Text translations become subtitles
+	w := NewSubtitleWriter(s, SubtitleOptions{})
+	origin := time.Now()
+	s.inputStartedAt = origin
+	dispatchAt(t, s, origin.Add(time.Second), `{"type":"response.text.delta","response_id":"resp1","delta":"Où"}`)
+	dispatchAt(t, s, origin.Add(1500*time.Millisecond), `{"type":"response.text.done","response_id":"resp1","text":"Où est la gare ?"}`)
+	dispatchAt(t, s, origin.Add(2*time.Second), `{"type":"response.done","response":{"id":"resp1"}}`)
+	assert.Equal(t, []Cue{{Start: time.Second, End: 2 * time.Second, Text: "Où est la gare ?"}}, w.TranslationCues())
+}
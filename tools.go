@@ -0,0 +1,257 @@
+package voxaudio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// defaultToolTimeout limits tool handlers without their own timeout
+const defaultToolTimeout = 10 * time.Second
+
+// ToolHandler runs a call of a tool with its JSON arguments. The result is
+// sent to the model as is if it is a string, otherwise encoded as JSON.
+// ctx is cancelled when the call times out or the session stops.
+type ToolHandler func(ctx context.Context, args json.RawMessage) (interface{}, error)
+
+// Tool is a function the model can call, for example to look up terminology
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // JSON schema of the arguments, nil for none
+	Handler     ToolHandler
+	Timeout     time.Duration // 0 uses a 10 second timeout
+}
+
+// ToolCall reports a finished call of a tool
+type ToolCall struct {
+	CallID    string
+	Name      string
+	Arguments json.RawMessage
+	Output    string // Sent to the model
+	Err       error  // Handler error, timeout or unknown tool
+	Duration  time.Duration
+}
+
+// toolResponse counts the calls of a response still running
+type toolResponse struct {
+	pending int
+	done    bool // response.done was received
+}
+
+// RegisterTool makes a tool available to the model
+// Note: Must be called before Start
+func (s *Session) RegisterTool(tool Tool) error {
+	if tool.Name == "" {
+		return fmt.Errorf("tool name is required")
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %s has no handler", tool.Name)
+	}
+	if len(tool.Parameters) > 0 && !json.Valid(tool.Parameters) {
+		return fmt.Errorf("tool %s has invalid parameters schema", tool.Name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tools[tool.Name]; ok {
+		return fmt.Errorf("tool %s already registered", tool.Name)
+	}
+	if s.tools == nil {
+		s.tools = make(map[string]Tool)
+	}
+	s.tools[tool.Name] = tool
+	return nil
+}
+
+// OnToolCall registers a handler called after each tool call
+func (s *Session) OnToolCall(handler func(ToolCall)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.toolHandlers = append(s.toolHandlers, handler)
+}
+
+// toolDefinitions returns the registered tools for session.update
+func (s *Session) toolDefinitions() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.tools))
+	for name := range s.tools {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var defs []map[string]interface{}
+	for _, name := range names {
+		tool := s.tools[name]
+		params := tool.Parameters
+		if len(params) == 0 {
+			params = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		defs = append(defs, map[string]interface{}{
+			"type":        "function",
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  params,
+		})
+	}
+	return defs
+}
+
+// handleToolEvent runs the calls of a response and continues the response
+// once all their outputs were sent
+func (s *Session) handleToolEvent(evt ServerEvent) {
+	switch evt.Type {
+	case EventFunctionCallArgumentsDone:
+		var call struct {
+			CallID    string `json:"call_id"`
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		}
+		if err := json.Unmarshal(evt.Raw, &call); err != nil || call.CallID == "" {
+			fmt.Printf("[Session] Invalid function call event: %s\n", string(evt.Raw))
+			return
+		}
+		s.mu.Lock()
+		tool, ok := s.tools[call.Name]
+		if s.toolResponses == nil {
+			s.toolResponses = make(map[string]*toolResponse)
+		}
+		resp := s.toolResponses[evt.ResponseID]
+		if resp == nil {
+			resp = &toolResponse{}
+			s.toolResponses[evt.ResponseID] = resp
+		}
+		resp.pending++
+		s.mu.Unlock()
+
+		result := ToolCall{CallID: call.CallID, Name: call.Name, Arguments: json.RawMessage(call.Arguments)}
+		if !ok {
+			result.Err = fmt.Errorf("unknown tool %s", call.Name)
+			s.finishToolCall(evt.ResponseID, result)
+			return
+		}
+		go func() {
+			start := time.Now()
+			result.Output, result.Err = s.runTool(tool, result.Arguments)
+			result.Duration = time.Since(start)
+			s.finishToolCall(evt.ResponseID, result)
+		}()
+	case EventResponseDone:
+		responseID, _ := responseStatus(evt)
+		s.mu.Lock()
+		resp := s.toolResponses[responseID]
+		if resp != nil {
+			resp.done = true
+		}
+		s.mu.Unlock()
+		if resp != nil {
+			s.continueToolResponse(responseID)
+		}
+	}
+}
+
+// runTool runs the handler of a tool with its timeout
+func (s *Session) runTool(tool Tool, args json.RawMessage) (string, error) {
+	timeout := tool.Timeout
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stopCh := s.stopSignal()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	type outcome struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("tool panicked: %v", r)}
+			}
+		}()
+		value, err := tool.Handler(ctx, args)
+		done <- outcome{value, err}
+	}()
+
+	select {
+	case out := <-done:
+		if out.err != nil {
+			return "", out.err
+		}
+		if text, ok := out.value.(string); ok {
+			return text, nil
+		}
+		b, err := json.Marshal(out.value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode tool result: %w", err)
+		}
+		return string(b), nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("tool timed out after %v", timeout)
+		}
+		return "", fmt.Errorf("tool cancelled: %w", ctx.Err())
+	}
+}
+
+// finishToolCall sends the output of a call and reports it
+func (s *Session) finishToolCall(responseID string, result ToolCall) {
+	if result.Err != nil {
+		fmt.Printf("[Session] Tool %s failed: %v\n", result.Name, result.Err)
+		b, _ := json.Marshal(map[string]string{"error": result.Err.Error()})
+		result.Output = string(b)
+	}
+	evt := map[string]interface{}{
+		"type": "conversation.item.create",
+		"item": map[string]string{
+			"type":    "function_call_output",
+			"call_id": result.CallID,
+			"output":  result.Output,
+		},
+	}
+	if err := s.sendEvent(evt); err != nil {
+		fmt.Printf("[Session] Failed to send output of tool %s: %v\n", result.Name, err)
+	}
+
+	s.mu.Lock()
+	if resp := s.toolResponses[responseID]; resp != nil {
+		resp.pending--
+	}
+	handlers := slices.Clone(s.toolHandlers)
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(result)
+	}
+	s.continueToolResponse(responseID)
+}
+
+// continueToolResponse asks the model to continue once the response that
+// called the tools is done and all outputs were sent
+func (s *Session) continueToolResponse(responseID string) {
+	s.mu.Lock()
+	resp := s.toolResponses[responseID]
+	ready := resp != nil && resp.done && resp.pending == 0
+	if ready {
+		delete(s.toolResponses, responseID)
+	}
+	s.mu.Unlock()
+	if !ready {
+		return
+	}
+	if err := s.sendEvent(map[string]string{"type": "response.create"}); err != nil {
+		fmt.Printf("[Session] Failed to continue after tool calls: %v\n", err)
+	}
+}
@@ -0,0 +1,197 @@
+package voxaudio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolSession is a session that collects the sent events and tool calls
+type toolSession struct {
+	*Session
+	mu    sync.Mutex
+	sent  []map[string]interface{}
+	calls []ToolCall
+}
+
+func newToolSession(t *testing.T) *toolSession {
+	ts := &toolSession{}
+	ts.Session = &Session{sender: func(msg string) error {
+		var evt map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(msg), &evt))
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.sent = append(ts.sent, evt)
+		return nil
+	}}
+	ts.OnToolCall(func(call ToolCall) {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		ts.calls = append(ts.calls, call)
+	})
+	return ts
+}
+
+func (ts *toolSession) events() []map[string]interface{} {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]map[string]interface{}(nil), ts.sent...)
+}
+
+func (ts *toolSession) waitEvents(t *testing.T, n int) []map[string]interface{} {
+	t.Helper()
+	require.Eventually(t, func() bool { return len(ts.events()) >= n }, 2*time.Second, time.Millisecond)
+	return ts.events()
+}
+
+// outputs returns the function call outputs by call ID
+func outputs(events []map[string]interface{}) map[string]string {
+	out := make(map[string]string)
+	for _, evt := range events {
+		if item, ok := evt["item"].(map[string]interface{}); ok && item["type"] == "function_call_output" {
+			out[item["call_id"].(string)] = item["output"].(string)
+		}
+	}
+	return out
+}
+
+func TestToolCalls(t *testing.T) {
+	ts := newToolSession(t)
+	require.NoError(t, ts.RegisterTool(Tool{
+		Name:       "lookup_term",
+		Parameters: json.RawMessage(`{"type":"object","properties":{"term":{"type":"string"}}}`),
+		Handler: func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			var in struct{ Term string }
+			if err := json.Unmarshal(args, &in); err != nil {
+				return nil, err
+			}
+			return map[string]string{"translation": "gare de " + in.Term}, nil
+		},
+	}))
+	require.NoError(t, ts.RegisterTool(Tool{
+		Name: "flag",
+		Handler: func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			return "flagged", nil
+		},
+	}))
+
+	now := time.Now()
+	dispatchAt(t, ts.Session, now, `{"type":"response.function_call_arguments.done","response_id":"resp_1","call_id":"call_1","name":"lookup_term","arguments":"{\"term\":\"Lyon\"}"}`)
+	dispatchAt(t, ts.Session, now, `{"type":"response.function_call_arguments.done","response_id":"resp_1","call_id":"call_2","name":"flag","arguments":"{}"}`)
+	events := ts.waitEvents(t, 2)
+	assert.Equal(t, map[string]string{"call_1": `{"translation":"gare de Lyon"}`, "call_2": "flagged"}, outputs(events))
+
+	// The response continues once it is done and all outputs were sent
+	dispatchAt(t, ts.Session, now, `{"type":"response.done","response":{"id":"resp_1","status":"completed"}}`)
+	events = ts.waitEvents(t, 3)
+	assert.Equal(t, "response.create", events[2]["type"])
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, ts.events(), 3, "one response.create for both calls")
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	require.Len(t, ts.calls, 2)
+	for _, call := range ts.calls {
+		assert.NoError(t, call.Err)
+	}
+}
+
+func TestToolCallErrors(t *testing.T) {
+	ts := newToolSession(t)
+	require.NoError(t, ts.RegisterTool(Tool{
+		Name: "fail",
+		Handler: func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			return nil, errors.New("glossary unavailable")
+		},
+	}))
+	require.NoError(t, ts.RegisterTool(Tool{
+		Name:    "slow",
+		Timeout: 20 * time.Millisecond,
+		Handler: func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return "too late", nil
+		},
+	}))
+	require.NoError(t, ts.RegisterTool(Tool{
+		Name: "panic",
+		Handler: func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+			panic("boom")
+		},
+	}))
+
+	// The response finishes before the slow call
+	now := time.Now()
+	for _, call := range []string{`"call_1","name":"fail"`, `"call_2","name":"slow"`, `"call_3","name":"missing"`, `"call_4","name":"panic"`} {
+		dispatchAt(t, ts.Session, now, `{"type":"response.function_call_arguments.done","response_id":"resp_1","call_id":`+call+`,"arguments":""}`)
+	}
+	dispatchAt(t, ts.Session, now, `{"type":"response.done","response":{"id":"resp_1","status":"completed"}}`)
+
+	events := ts.waitEvents(t, 5)
+	assert.Equal(t, map[string]string{
+		"call_1": `{"error":"glossary unavailable"}`,
+		"call_2": `{"error":"tool timed out after 20ms"}`,
+		"call_3": `{"error":"unknown tool missing"}`,
+		"call_4": `{"error":"tool panicked: boom"}`,
+	}, outputs(events))
+	assert.Equal(t, "response.create", events[4]["type"])
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	require.Len(t, ts.calls, 4)
+	for _, call := range ts.calls {
+		assert.Error(t, call.Err, call.Name)
+	}
+}
+
+func TestRegisterTool(t *testing.T) {
+	s := &Session{}
+	handler := func(ctx context.Context, args json.RawMessage) (interface{}, error) { return nil, nil }
+	assert.Error(t, s.RegisterTool(Tool{Handler: handler}))
+	assert.Error(t, s.RegisterTool(Tool{Name: "lookup"}))
+	assert.Error(t, s.RegisterTool(Tool{Name: "lookup", Handler: handler, Parameters: json.RawMessage(`{`)}))
+	require.NoError(t, s.RegisterTool(Tool{Name: "lookup", Description: "Look up a term", Handler: handler}))
+	assert.Error(t, s.RegisterTool(Tool{Name: "lookup", Handler: handler}), "duplicate")
+
+	var sent []string
+	s.sender = func(msg string) error {
+		sent = append(sent, msg)
+		return nil
+	}
+	s.initializeSession()
+	require.Len(t, sent, 1)
+	var update struct {
+		Session struct {
+			Tools      []map[string]interface{} `json:"tools"`
+			ToolChoice string                   `json:"tool_choice"`
+		} `json:"session"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(sent[0]), &update))
+	assert.Equal(t, "auto", update.Session.ToolChoice)
+	require.Len(t, update.Session.Tools, 1)
+	assert.Equal(t, "lookup", update.Session.Tools[0]["name"])
+	assert.Equal(t, "function", update.Session.Tools[0]["type"])
+	assert.Equal(t, map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}, update.Session.Tools[0]["parameters"])
+}
+
+func TestToolCancelledByStop(t *testing.T) {
+	ts := newToolSession(t)
+	wait := Tool{Name: "wait", Handler: func(ctx context.Context, args json.RawMessage) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+
+	go ts.Stop()
+	_, err := ts.runTool(wait, nil)
+	assert.ErrorContains(t, err, "tool cancelled")
+
+	// Calls that start after the stop are cancelled at once
+	_, err = ts.runTool(wait, nil)
+	assert.ErrorContains(t, err, "tool cancelled")
+}
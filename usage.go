@@ -0,0 +1,291 @@
+package voxaudio
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// TokenUsage counts tokens by direction and modality. Cached input tokens
+// are included in the input counts.
+type TokenUsage struct {
+	InputText        int `json:"input_text"`
+	InputAudio       int `json:"input_audio"`
+	CachedInputText  int `json:"cached_input_text"`
+	CachedInputAudio int `json:"cached_input_audio"`
+	OutputText       int `json:"output_text"`
+	OutputAudio      int `json:"output_audio"`
+}
+
+// Add returns the sum of u and other
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputText:        u.InputText + other.InputText,
+		InputAudio:       u.InputAudio + other.InputAudio,
+		CachedInputText:  u.CachedInputText + other.CachedInputText,
+		CachedInputAudio: u.CachedInputAudio + other.CachedInputAudio,
+		OutputText:       u.OutputText + other.OutputText,
+		OutputAudio:      u.OutputAudio + other.OutputAudio,
+	}
+}
+
+// Total returns the number of input and output tokens
+func (u TokenUsage) Total() int {
+	return u.InputText + u.InputAudio + u.OutputText + u.OutputAudio
+}
+
+// Prices are the model prices in USD per million tokens
+type Prices struct {
+	InputText        float64
+	InputAudio       float64
+	CachedInputText  float64
+	CachedInputAudio float64
+	OutputText       float64
+	OutputAudio      float64
+}
+
+// Cost returns the price of usage in USD
+func (p Prices) Cost(u TokenUsage) float64 {
+	return (float64(u.InputText-u.CachedInputText)*p.InputText +
+		float64(u.InputAudio-u.CachedInputAudio)*p.InputAudio +
+		float64(u.CachedInputText)*p.CachedInputText +
+		float64(u.CachedInputAudio)*p.CachedInputAudio +
+		float64(u.OutputText)*p.OutputText +
+		float64(u.OutputAudio)*p.OutputAudio) / 1e6
+}
+
+// DefaultPrices holds the published prices of the realtime models by model
+// name prefix. Entries can be changed or added before sessions are created.
+var DefaultPrices = map[string]Prices{
+	"gpt-realtime": {
+		InputText: 4, InputAudio: 32, CachedInputText: 0.4, CachedInputAudio: 0.4,
+		OutputText: 16, OutputAudio: 64,
+	},
+	"gpt-4o-realtime-preview": {
+		InputText: 5, InputAudio: 40, CachedInputText: 2.5, CachedInputAudio: 2.5,
+		OutputText: 20, OutputAudio: 80,
+	},
+	"gpt-4o-mini-realtime-preview": {
+		InputText: 0.6, InputAudio: 10, CachedInputText: 0.3, CachedInputAudio: 0.3,
+		OutputText: 2.4, OutputAudio: 20,
+	},
+}
+
+// PricesFor returns the prices of the longest DefaultPrices prefix of model
+func PricesFor(model string) (Prices, bool) {
+	var best string
+	for prefix := range DefaultPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return Prices{}, false
+	}
+	return DefaultPrices[best], true
+}
+
+// BudgetAction is what the session does when a budget is exceeded
+type BudgetAction int
+
+const (
+	BudgetStop  BudgetAction = iota // Stop the session
+	BudgetPause                     // Stop uploading input audio until Resume
+)
+
+// Budget limits the usage of a session. Zero limits are not enforced.
+type Budget struct {
+	MaxCost   float64 // USD
+	MaxTokens int
+	Action    BudgetAction
+}
+
+// UsageReport is emitted after each response with its usage and the
+// session totals
+type UsageReport struct {
+	ResponseID   string
+	Usage        TokenUsage // Usage of the response
+	Cost         float64    // Estimated cost of the response in USD
+	Total        TokenUsage // Usage of the session so far
+	TotalCost    float64
+	OverBudget   bool // The session budget is exhausted
+	BudgetAction BudgetAction
+}
+
+// usageTracker accumulates the usage reported in response.done events
+type usageTracker struct {
+	mu       sync.Mutex
+	prices   Prices
+	budget   Budget
+	total    TokenUsage
+	cost     float64
+	exceeded bool
+	handlers []func(UsageReport)
+}
+
+func newUsageTracker(model string) *usageTracker {
+	prices, ok := PricesFor(model)
+	if !ok {
+		fmt.Printf("[Session] No prices known for model %s, costs are reported as 0\n", model)
+	}
+	return &usageTracker{prices: prices}
+}
+
+// responseUsage decodes the usage of a response.done event
+func responseUsage(evt ServerEvent) (TokenUsage, bool) {
+	var msg struct {
+		Response struct {
+			Usage *struct {
+				InputTokenDetails struct {
+					TextTokens          int `json:"text_tokens"`
+					AudioTokens         int `json:"audio_tokens"`
+					CachedTokensDetails struct {
+						TextTokens  int `json:"text_tokens"`
+						AudioTokens int `json:"audio_tokens"`
+					} `json:"cached_tokens_details"`
+				} `json:"input_token_details"`
+				OutputTokenDetails struct {
+					TextTokens  int `json:"text_tokens"`
+					AudioTokens int `json:"audio_tokens"`
+				} `json:"output_token_details"`
+			} `json:"usage"`
+		} `json:"response"`
+	}
+	if json.Unmarshal(evt.Raw, &msg) != nil || msg.Response.Usage == nil {
+		return TokenUsage{}, false
+	}
+	u := msg.Response.Usage
+	return TokenUsage{
+		InputText:        u.InputTokenDetails.TextTokens,
+		InputAudio:       u.InputTokenDetails.AudioTokens,
+		CachedInputText:  u.InputTokenDetails.CachedTokensDetails.TextTokens,
+		CachedInputAudio: u.InputTokenDetails.CachedTokensDetails.AudioTokens,
+		OutputText:       u.OutputTokenDetails.TextTokens,
+		OutputAudio:      u.OutputTokenDetails.AudioTokens,
+	}, true
+}
+
+// add records the usage of a response; exceeded is true for the response
+// that exhausted the budget
+func (t *usageTracker) add(responseID string, usage TokenUsage) (report UsageReport, handlers []func(UsageReport), exceeded bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cost := t.prices.Cost(usage)
+	t.total = t.total.Add(usage)
+	t.cost += cost
+
+	over := t.budget.MaxCost > 0 && t.cost >= t.budget.MaxCost ||
+		t.budget.MaxTokens > 0 && t.total.Total() >= t.budget.MaxTokens
+	report = UsageReport{
+		ResponseID:   responseID,
+		Usage:        usage,
+		Cost:         cost,
+		Total:        t.total,
+		TotalCost:    t.cost,
+		OverBudget:   over,
+		BudgetAction: t.budget.Action,
+	}
+	exceeded = over && !t.exceeded
+	t.exceeded = over
+	return report, slices.Clone(t.handlers), exceeded
+}
+
+// handleUsage accounts the usage of a response.done event and enforces the budget
+func (s *Session) handleUsage(evt ServerEvent) {
+	if s.usage == nil || evt.Type != EventResponseDone {
+		return
+	}
+	usage, ok := responseUsage(evt)
+	if !ok {
+		return
+	}
+	responseID, _ := responseStatus(evt)
+	report, handlers, exceeded := s.usage.add(responseID, usage)
+	for _, handler := range handlers {
+		handler(report)
+	}
+	if !exceeded {
+		return
+	}
+
+	switch report.BudgetAction {
+	case BudgetPause:
+		fmt.Printf("[Session] Budget exhausted ($%.4f, %d tokens), pausing input\n", report.TotalCost, report.Total.Total())
+		s.Pause()
+	default:
+		fmt.Printf("[Session] Budget exhausted ($%.4f, %d tokens), stopping session\n", report.TotalCost, report.Total.Total())
+		// Stop waits for the data channel, which is running this handler
+		go s.Stop()
+	}
+}
+
+// SetPrices replaces the prices used to estimate the cost of the session
+func (s *Session) SetPrices(prices Prices) {
+	if s.usage == nil {
+		return
+	}
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	s.usage.prices = prices
+}
+
+// SetBudget limits the usage of the session
+// Note: Checked after each response, so the last response can exceed the budget
+func (s *Session) SetBudget(budget Budget) {
+	if s.usage == nil {
+		return
+	}
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	s.usage.budget = budget
+	s.usage.exceeded = false
+}
+
+// OnUsage registers a handler called with the usage of each response
+func (s *Session) OnUsage(handler func(UsageReport)) {
+	if s.usage == nil {
+		return
+	}
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	s.usage.handlers = append(s.usage.handlers, handler)
+}
+
+// Usage returns the token usage and estimated cost of the session so far
+func (s *Session) Usage() (TokenUsage, float64) {
+	if s.usage == nil {
+		return TokenUsage{}, 0
+	}
+	s.usage.mu.Lock()
+	defer s.usage.mu.Unlock()
+	return s.usage.total, s.usage.cost
+}
+
+// Pause stops uploading input audio; captured audio is discarded until Resume
+func (s *Session) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume continues uploading input audio after Pause
+// Note: Raise the budget first, or the next response pauses the session again
+func (s *Session) Resume() {
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+	if s.usage != nil {
+		s.usage.mu.Lock()
+		s.usage.exceeded = false
+		s.usage.mu.Unlock()
+	}
+}
+
+// Paused reports whether input upload is paused
+func (s *Session) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
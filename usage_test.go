@@ -0,0 +1,129 @@
+package voxaudio
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPrices = Prices{
+	InputText: 4, InputAudio: 32, CachedInputText: 0.4, CachedInputAudio: 0.4,
+	OutputText: 16, OutputAudio: 64,
+}
+
+// responseDone returns a response.done event with the given usage
+func responseDone(id string, inText, inAudio, cachedAudio, outText, outAudio int) string {
+	return fmt.Sprintf(`{"type":"response.done","response":{"id":%q,"status":"completed","usage":{`+
+		`"total_tokens":%d,"input_tokens":%d,"output_tokens":%d,`+
+		`"input_token_details":{"text_tokens":%d,"audio_tokens":%d,"cached_tokens":%d,`+
+		`"cached_tokens_details":{"text_tokens":0,"audio_tokens":%d}},`+
+		`"output_token_details":{"text_tokens":%d,"audio_tokens":%d}}}}`,
+		id, inText+inAudio+outText+outAudio, inText+inAudio, outText+outAudio,
+		inText, inAudio, cachedAudio, cachedAudio, outText, outAudio)
+}
+
+func TestUsageAccounting(t *testing.T) {
+	s := &Session{usage: &usageTracker{prices: testPrices}}
+	var reports []UsageReport
+	s.OnUsage(func(r UsageReport) { reports = append(reports, r) })
+
+	dispatchAt(t, s, time.Now(), responseDone("resp_1", 100, 1000, 0, 50, 2000))
+	dispatchAt(t, s, time.Now(), `{"type":"response.done","response":{"id":"resp_2","status":"cancelled"}}`)
+	dispatchAt(t, s, time.Now(), responseDone("resp_3", 100, 1000, 500, 0, 0))
+
+	require.Len(t, reports, 2, "responses without usage are not reported")
+	assert.Equal(t, "resp_1", reports[0].ResponseID)
+	assert.Equal(t, TokenUsage{InputText: 100, InputAudio: 1000, OutputText: 50, OutputAudio: 2000}, reports[0].Usage)
+	assert.InDelta(t, (100*4+1000*32+50*16+2000*64)/1e6, reports[0].Cost, 1e-12)
+
+	// Cached audio is billed at the cached price
+	assert.Equal(t, 500, reports[1].Usage.CachedInputAudio)
+	assert.InDelta(t, (100*4+500*32+500*0.4)/1e6, reports[1].Cost, 1e-12)
+	assert.Equal(t, 4250, reports[1].Total.Total())
+
+	total, cost := s.Usage()
+	assert.Equal(t, reports[1].Total, total)
+	assert.InDelta(t, reports[0].Cost+reports[1].Cost, cost, 1e-12)
+	assert.False(t, reports[1].OverBudget)
+
+	// Sessions built without a tracker report nothing
+	total, cost = (&Session{}).Usage()
+	assert.Zero(t, total)
+	assert.Zero(t, cost)
+}
+
+func TestUsageBudgetPause(t *testing.T) {
+	s := &Session{usage: &usageTracker{prices: testPrices}}
+	s.SetBudget(Budget{MaxTokens: 3000, Action: BudgetPause})
+	var reports []UsageReport
+	s.OnUsage(func(r UsageReport) { reports = append(reports, r) })
+
+	dispatchAt(t, s, time.Now(), responseDone("resp_1", 0, 1000, 0, 0, 1000))
+	assert.False(t, s.Paused())
+	dispatchAt(t, s, time.Now(), responseDone("resp_2", 0, 500, 0, 0, 500))
+	assert.True(t, s.Paused())
+	require.Len(t, reports, 2)
+	assert.True(t, reports[1].OverBudget)
+	assert.Equal(t, BudgetPause, reports[1].BudgetAction)
+
+	// Resuming without a new budget pauses again after the next response
+	s.Resume()
+	assert.False(t, s.Paused())
+	dispatchAt(t, s, time.Now(), responseDone("resp_3", 0, 10, 0, 0, 10))
+	assert.True(t, s.Paused(), "the budget was already exhausted")
+	s.Resume()
+	dispatchAt(t, s, time.Now(), responseDone("resp_4", 0, 10, 0, 0, 10))
+	assert.True(t, s.Paused(), "paused on every resume while over budget")
+
+	// A raised budget lets the session run until it is used up again
+	s.SetBudget(Budget{MaxTokens: 4000, Action: BudgetPause})
+	s.Resume()
+	dispatchAt(t, s, time.Now(), responseDone("resp_5", 0, 200, 0, 0, 200))
+	assert.False(t, s.Paused())
+	dispatchAt(t, s, time.Now(), responseDone("resp_6", 0, 300, 0, 0, 300))
+	assert.True(t, s.Paused())
+}
+
+func TestUsageBudgetStop(t *testing.T) {
+	stopCh := make(chan struct{})
+	s := &Session{stopCh: stopCh, usage: &usageTracker{prices: testPrices}}
+	s.SetBudget(Budget{MaxCost: 0.1})
+
+	dispatchAt(t, s, time.Now(), responseDone("resp_1", 0, 1000, 0, 0, 1000))
+	select {
+	case <-stopCh:
+		t.Fatal("stopped below the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	dispatchAt(t, s, time.Now(), responseDone("resp_2", 0, 0, 0, 0, 2000))
+	select {
+	case <-stopCh:
+	case <-time.After(time.Second):
+		t.Fatal("session not stopped after exhausting the budget")
+	}
+
+	// Stopping again while the budget stop runs is harmless
+	s.Stop()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done not closed after the session stopped")
+	}
+}
+
+func TestPricesFor(t *testing.T) {
+	prices, ok := PricesFor("gpt-4o-mini-realtime-preview-2024-12-17")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultPrices["gpt-4o-mini-realtime-preview"], prices)
+
+	prices, ok = PricesFor("gpt-4o-realtime-preview")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultPrices["gpt-4o-realtime-preview"], prices)
+
+	_, ok = PricesFor("whisper-1")
+	assert.False(t, ok)
+}
@@ -14,3 +14,10 @@ func absFloat32(x float32) float32 {
 	}
 	return x
 }
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,100 @@
+// Package wavfile implements a streaming WAV writer and reader.
+//
+// The writer supports 16/24/32-bit PCM and 32-bit IEEE float samples with any
+// number of interleaved channels. It reserves space for an RF64 ds64 chunk so
+// recordings larger than 4 GiB are upgraded to RF64 transparently, and it can
+// rewrite the header periodically so a crashed process leaves a playable file.
+package wavfile
+
+import "fmt"
+
+// SampleFormat describes how a single sample is encoded on disk.
+type SampleFormat int
+
+const (
+	PCM16   SampleFormat = iota + 1 // 16-bit signed integer
+	PCM24                           // 24-bit signed integer, packed
+	PCM32                           // 32-bit signed integer
+	Float32                         // 32-bit IEEE float
+)
+
+// Format tags used in the fmt chunk
+const (
+	formatPCM        = 0x0001
+	formatIEEEFloat  = 0x0003
+	formatExtensible = 0xFFFE
+)
+
+// maxChannels bounds the channel count accepted by the writer and reader
+const maxChannels = 64
+
+// BitsPerSample returns the encoded sample width in bits.
+func (f SampleFormat) BitsPerSample() int {
+	switch f {
+	case PCM16:
+		return 16
+	case PCM24:
+		return 24
+	case PCM32, Float32:
+		return 32
+	}
+	return 0
+}
+
+// String returns the format name.
+func (f SampleFormat) String() string {
+	switch f {
+	case PCM16:
+		return "pcm16"
+	case PCM24:
+		return "pcm24"
+	case PCM32:
+		return "pcm32"
+	case Float32:
+		return "float32"
+	}
+	return fmt.Sprintf("SampleFormat(%d)", int(f))
+}
+
+// Format describes the audio stored in a WAV file.
+type Format struct {
+	SampleRate   int          // Frames per second, e.g., 48000
+	Channels     int          // Number of interleaved channels
+	SampleFormat SampleFormat // Encoding of each sample
+}
+
+// BlockAlign returns the size of one frame (one sample per channel) in bytes.
+func (f Format) BlockAlign() int {
+	return f.Channels * f.SampleFormat.BitsPerSample() / 8
+}
+
+// ByteRate returns the number of data bytes per second.
+func (f Format) ByteRate() int {
+	return f.SampleRate * f.BlockAlign()
+}
+
+// Validate checks that the format can be written.
+func (f Format) Validate() error {
+	if f.SampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate: %d", f.SampleRate)
+	}
+	if f.Channels <= 0 || f.Channels > maxChannels {
+		return fmt.Errorf("invalid channel count: %d", f.Channels)
+	}
+	if f.SampleFormat.BitsPerSample() == 0 {
+		return fmt.Errorf("unsupported sample format: %v", f.SampleFormat)
+	}
+	return nil
+}
+
+// formatTag returns the fmt chunk tag used for this format. Multichannel
+// audio uses WAVE_FORMAT_EXTENSIBLE as recommended by the specification.
+func (f Format) formatTag() uint16 {
+	if f.Channels > 2 {
+		return formatExtensible
+	}
+	if f.SampleFormat == Float32 {
+		return formatIEEEFloat
+	}
+	return formatPCM
+}
@@ -0,0 +1,300 @@
+package wavfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// maxChunkBody bounds the header chunks (fmt, ds64) that are read into memory
+const maxChunkBody = 1 << 16
+
+// ErrFormat is returned when the input is not a supported WAV file.
+var ErrFormat = errors.New("wavfile: invalid or unsupported WAV data")
+
+// Reader decodes sample data from a RIFF/WAVE or RF64 stream.
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	format Format
+
+	dataSize  uint64 // Size of the data chunk, or 0 when unknown
+	remaining uint64 // Bytes left in the data chunk when the size is known
+	sized     bool   // Whether dataSize is trustworthy
+
+	buf []byte
+}
+
+// Open opens the named file for reading.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAV file: %w", err)
+	}
+	r, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader parses the WAV header from r and positions the reader at the
+// first sample. Files whose header sizes were never finalized (for example
+// after a crash) are read until EOF.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: bufio.NewReader(r)}
+	if err := rd.readHeader(); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+func formatError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, args...))
+}
+
+func (r *Reader) readHeader() error {
+	var riff [12]byte
+	if _, err := io.ReadFull(r.r, riff[:]); err != nil {
+		return formatError("short RIFF header")
+	}
+	magic := string(riff[0:4])
+	if magic != "RIFF" && magic != "RF64" {
+		return formatError("missing RIFF signature")
+	}
+	if string(riff[8:12]) != "WAVE" {
+		return formatError("missing WAVE signature")
+	}
+	rf64 := magic == "RF64"
+
+	var ds64DataSize uint64
+	var haveFmt, haveDS64 bool
+	for {
+		id, size, err := r.readChunkHeader()
+		if err != nil {
+			return formatError("missing data chunk")
+		}
+
+		switch id {
+		case "ds64":
+			body, err := r.readChunkBody(size)
+			if err != nil {
+				return err
+			}
+			if len(body) < 24 {
+				return formatError("ds64 chunk too short")
+			}
+			ds64DataSize = binary.LittleEndian.Uint64(body[8:16])
+			haveDS64 = true
+		case "fmt ":
+			body, err := r.readChunkBody(size)
+			if err != nil {
+				return err
+			}
+			if r.format, err = parseFmt(body); err != nil {
+				return err
+			}
+			haveFmt = true
+		case "data":
+			if !haveFmt {
+				return formatError("data chunk before fmt chunk")
+			}
+			r.dataSize = uint64(size)
+			if rf64 && size == math.MaxUint32 {
+				if !haveDS64 {
+					return formatError("RF64 file without ds64 chunk")
+				}
+				r.dataSize = ds64DataSize
+			}
+			// A zero size is what an unfinished writer leaves behind
+			r.sized = r.dataSize != 0
+			r.remaining = r.dataSize
+			return nil
+		default:
+			if err := r.skip(uint64(size) + uint64(size&1)); err != nil {
+				return formatError("truncated %q chunk", id)
+			}
+		}
+	}
+}
+
+func (r *Reader) readChunkHeader() (string, uint32, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return "", 0, err
+	}
+	return string(hdr[0:4]), binary.LittleEndian.Uint32(hdr[4:8]), nil
+}
+
+func (r *Reader) readChunkBody(size uint32) ([]byte, error) {
+	if size > maxChunkBody {
+		return nil, formatError("header chunk too large: %d bytes", size)
+	}
+	body := make([]byte, int(size)+int(size&1))
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, formatError("truncated header chunk")
+	}
+	return body[:size], nil
+}
+
+func (r *Reader) skip(n uint64) error {
+	for n > 0 {
+		step := n
+		if step > math.MaxInt32 {
+			step = math.MaxInt32
+		}
+		d, err := r.r.Discard(int(step))
+		n -= uint64(d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseFmt(b []byte) (Format, error) {
+	if len(b) < 16 {
+		return Format{}, formatError("fmt chunk too short")
+	}
+	tag := binary.LittleEndian.Uint16(b[0:2])
+	channels := int(binary.LittleEndian.Uint16(b[2:4]))
+	rate := binary.LittleEndian.Uint32(b[4:8])
+	blockAlign := int(binary.LittleEndian.Uint16(b[12:14]))
+	bits := int(binary.LittleEndian.Uint16(b[14:16]))
+
+	if tag == formatExtensible {
+		if len(b) < 40 {
+			return Format{}, formatError("extensible fmt chunk too short")
+		}
+		tag = binary.LittleEndian.Uint16(b[24:26])
+	}
+
+	var sf SampleFormat
+	switch {
+	case tag == formatPCM && bits == 16:
+		sf = PCM16
+	case tag == formatPCM && bits == 24:
+		sf = PCM24
+	case tag == formatPCM && bits == 32:
+		sf = PCM32
+	case tag == formatIEEEFloat && bits == 32:
+		sf = Float32
+	default:
+		return Format{}, formatError("unsupported encoding: tag 0x%04x, %d bits", tag, bits)
+	}
+
+	if rate == 0 || rate > math.MaxInt32 {
+		return Format{}, formatError("invalid sample rate: %d", rate)
+	}
+	f := Format{SampleRate: int(rate), Channels: channels, SampleFormat: sf}
+	if err := f.Validate(); err != nil {
+		return Format{}, formatError("%v", err)
+	}
+	if blockAlign != f.BlockAlign() {
+		return Format{}, formatError("block align %d does not match format", blockAlign)
+	}
+	return f, nil
+}
+
+// Format returns the format of the audio in the file.
+func (r *Reader) Format() Format {
+	return r.format
+}
+
+// Frames returns the number of frames in the data chunk, or -1 if the
+// header does not record it.
+func (r *Reader) Frames() int64 {
+	if !r.sized {
+		return -1
+	}
+	return int64(r.dataSize / uint64(r.format.BlockAlign()))
+}
+
+// Duration returns the duration of the audio, or -1 if it is unknown.
+func (r *Reader) Duration() time.Duration {
+	frames := r.Frames()
+	if frames < 0 {
+		return -1
+	}
+	return time.Duration(frames) * time.Second / time.Duration(r.format.SampleRate)
+}
+
+// ReadFloat32 reads interleaved samples into dst, converted to the range
+// [-1.0, 1.0]. It reads whole frames only, so dst should hold at least one
+// frame. At the end of the data it returns 0, io.EOF.
+func (r *Reader) ReadFloat32(dst []float32) (int, error) {
+	size := r.format.SampleFormat.BitsPerSample() / 8
+	channels := r.format.Channels
+	want := len(dst) / channels * channels * size
+	if want == 0 {
+		return 0, fmt.Errorf("wavfile: buffer smaller than one frame")
+	}
+	if r.sized {
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		if uint64(want) > r.remaining {
+			want = int(r.remaining) / (channels * size) * channels * size
+			if want == 0 {
+				r.remaining = 0
+				return 0, io.EOF
+			}
+		}
+	}
+
+	if cap(r.buf) < want {
+		r.buf = make([]byte, want)
+	}
+	buf := r.buf[:want]
+	n, err := io.ReadFull(r.r, buf)
+	// Only decode whole frames; a trailing partial frame is discarded
+	n -= n % (channels * size)
+	if r.sized {
+		r.remaining -= uint64(n)
+	}
+	if n == 0 {
+		if err == nil || err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		if r.sized && err == io.EOF {
+			// The header promised more data than the file holds
+			r.remaining = 0
+		}
+		return 0, err
+	}
+
+	for i := 0; i < n/size; i++ {
+		dst[i] = decodeSample(buf[i*size:], r.format.SampleFormat)
+	}
+	return n / size, nil
+}
+
+func decodeSample(b []byte, format SampleFormat) float32 {
+	switch format {
+	case PCM16:
+		return float32(int16(binary.LittleEndian.Uint16(b))) / 32768.0
+	case PCM24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float32(v) / 8388608.0
+	case PCM32:
+		return float32(float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648.0)
+	case Float32:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+// Close closes the underlying file if it was opened by Open.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package wavfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// canonicalWav builds a classic 44-byte-header PCM16 file, as written by
+// most other tools, without the reserved JUNK chunk.
+func canonicalWav(samples []int16) []byte {
+	var b []byte
+	b = append(b, "RIFF"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(36+len(samples)*2))
+	b = append(b, "WAVEfmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, formatPCM)
+	b = binary.LittleEndian.AppendUint16(b, 1)
+	b = binary.LittleEndian.AppendUint32(b, 16000)
+	b = binary.LittleEndian.AppendUint32(b, 32000)
+	b = binary.LittleEndian.AppendUint16(b, 2)
+	b = binary.LittleEndian.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(samples)*2))
+	for _, s := range samples {
+		b = binary.LittleEndian.AppendUint16(b, uint16(s))
+	}
+	return b
+}
+
+func TestReaderCanonicalHeader(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(canonicalWav([]int16{0, 16384, -32768})))
+	require.NoError(t, err)
+	assert.Equal(t, Format{SampleRate: 16000, Channels: 1, SampleFormat: PCM16}, r.Format())
+	assert.Equal(t, int64(3), r.Frames())
+	assert.Equal(t, []float32{0, 0.5, -1}, readAll(t, r))
+}
+
+func TestReaderSkipsUnknownChunks(t *testing.T) {
+	data := canonicalWav([]int16{1, 2})
+	// Insert an odd-sized LIST chunk (with pad byte) before fmt
+	list := append([]byte("LIST"), 3, 0, 0, 0, 'a', 'b', 'c', 0)
+	data = append(data[:12:12], append(list, data[12:]...)...)
+
+	r, err := NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Len(t, readAll(t, r), 2)
+}
+
+func TestReaderIgnoresTrailingChunks(t *testing.T) {
+	data := append(canonicalWav([]int16{1, 2, 3}), "LIST\x04\x00\x00\x00abcd"...)
+	r, err := NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Len(t, readAll(t, r), 3)
+}
+
+func TestReaderTruncatedData(t *testing.T) {
+	data := canonicalWav([]int16{1, 2, 3, 4})
+	r, err := NewReader(bytes.NewReader(data[:len(data)-3]))
+	require.NoError(t, err)
+	assert.Len(t, readAll(t, r), 2)
+}
+
+func TestReaderMalformedHeaders(t *testing.T) {
+	valid := canonicalWav([]int16{1})
+	cases := map[string][]byte{
+		"empty":         {},
+		"not riff":      append([]byte("RIFX"), valid[4:]...),
+		"not wave":      append(append([]byte{}, valid[:8]...), append([]byte("AVI "), valid[12:]...)...),
+		"no data chunk": valid[:36],
+		"short fmt":     append(append([]byte{}, valid[:16]...), 4, 0, 0, 0, 1, 0, 1, 0),
+		"data before fmt": append(append([]byte{}, valid[:12]...),
+			"data\x00\x00\x00\x00"...),
+	}
+	corrupt := func(offset int, v uint16) []byte {
+		b := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint16(b[offset:], v)
+		return b
+	}
+	cases["zero channels"] = corrupt(22, 0)
+	cases["8-bit"] = corrupt(34, 8)
+	cases["bad block align"] = corrupt(32, 7)
+	cases["alaw"] = corrupt(20, 6)
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(data))
+			assert.True(t, errors.Is(err, ErrFormat), "got %v", err)
+		})
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	f.Add(canonicalWav([]int16{1, -1, 300}))
+	for _, format := range []Format{
+		{SampleRate: 48000, Channels: 2, SampleFormat: PCM24},
+		{SampleRate: 44100, Channels: 8, SampleFormat: Float32},
+	} {
+		path := filepath.Join(f.TempDir(), "seed.wav")
+		w, err := Create(path, format)
+		if err != nil {
+			f.Fatal(err)
+		}
+		w.WriteFloat32(make([]float32, 64*format.Channels))
+		w.Close()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if err := r.Format().Validate(); err != nil {
+			t.Fatalf("reader accepted invalid format: %v", err)
+		}
+		buf := make([]float32, 64*r.Format().Channels)
+		total := 0
+		for {
+			n, err := r.ReadFloat32(buf)
+			total += n
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if total > len(data) {
+				t.Fatalf("read %d samples from %d bytes", total, len(data))
+			}
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package wavfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Header layout written by Writer. A JUNK chunk of the size of a ds64 chunk
+// is reserved after the RIFF header so the file can be upgraded to RF64 in
+// place once it grows past the 32-bit size limit.
+const (
+	riffSizeOffset = 4
+	junkOffset     = 12
+	ds64BodySize   = 28
+	fmtOffset      = junkOffset + 8 + ds64BodySize
+)
+
+// maxRIFFSize is the largest size representable in a RIFF header field.
+// It is a variable so tests can exercise the RF64 upgrade with small files.
+var maxRIFFSize uint64 = math.MaxUint32
+
+// ErrClosed is returned when writing to a closed Writer.
+var ErrClosed = errors.New("wavfile: writer closed")
+
+// Writer streams audio samples into a WAV file. Sizes in the header are
+// rewritten on Flush, on Close and, if SetUpdateInterval was called, periodically
+// while writing.
+type Writer struct {
+	w      io.WriteSeeker
+	closer io.Closer // Closed together with the writer when owned (see Create)
+	format Format
+
+	dataSizeOffset int64  // Offset of the data chunk size field
+	dataSize       uint64 // Bytes of sample data written so far
+	rf64           bool   // Whether the header has been upgraded to RF64
+
+	updateInterval time.Duration
+	lastUpdate     time.Time
+
+	buf    []byte
+	padded bool
+	closed bool
+}
+
+// Create creates the named file and returns a Writer that owns it.
+func Create(path string, format Format) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WAV file: %w", err)
+	}
+	w, err := NewWriter(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
+}
+
+// NewWriter writes a WAV header to w and returns a Writer for sample data.
+// The caller remains responsible for closing w.
+func NewWriter(w io.WriteSeeker, format Format) (*Writer, error) {
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+	wr := &Writer{w: w, format: format, lastUpdate: time.Now()}
+	if err := wr.writeHeader(); err != nil {
+		return nil, fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	return wr, nil
+}
+
+// Format returns the format of the audio being written.
+func (w *Writer) Format() Format {
+	return w.format
+}
+
+// SetUpdateInterval makes the writer rewrite the header sizes at most once
+// per interval while writing, so the file stays readable if the process
+// exits without calling Close. Zero disables periodic updates.
+func (w *Writer) SetUpdateInterval(interval time.Duration) {
+	w.updateInterval = interval
+}
+
+// Frames returns the number of frames written so far.
+func (w *Writer) Frames() int64 {
+	return int64(w.dataSize) / int64(w.format.BlockAlign())
+}
+
+// Duration returns the duration of the audio written so far.
+func (w *Writer) Duration() time.Duration {
+	return time.Duration(w.Frames()) * time.Second / time.Duration(w.format.SampleRate)
+}
+
+func (w *Writer) writeHeader() error {
+	fmtBody := w.fmtChunk()
+	header := make([]byte, 0, fmtOffset+8+len(fmtBody)+8)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 0) // Updated later
+	header = append(header, "WAVE"...)
+	header = append(header, "JUNK"...)
+	header = binary.LittleEndian.AppendUint32(header, ds64BodySize)
+	header = append(header, make([]byte, ds64BodySize)...)
+	header = append(header, "fmt "...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(fmtBody)))
+	header = append(header, fmtBody...)
+	header = append(header, "data"...)
+	w.dataSizeOffset = int64(len(header))
+	header = binary.LittleEndian.AppendUint32(header, 0) // Updated later
+
+	_, err := w.w.Write(header)
+	return err
+}
+
+func (w *Writer) fmtChunk() []byte {
+	f := w.format
+	tag := f.formatTag()
+	b := make([]byte, 0, 40)
+	b = binary.LittleEndian.AppendUint16(b, tag)
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.Channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.SampleRate))
+	b = binary.LittleEndian.AppendUint32(b, uint32(f.ByteRate()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.BlockAlign()))
+	b = binary.LittleEndian.AppendUint16(b, uint16(f.SampleFormat.BitsPerSample()))
+
+	switch tag {
+	case formatIEEEFloat:
+		b = binary.LittleEndian.AppendUint16(b, 0) // cbSize
+	case formatExtensible:
+		b = binary.LittleEndian.AppendUint16(b, 22) // cbSize
+		b = binary.LittleEndian.AppendUint16(b, uint16(f.SampleFormat.BitsPerSample()))
+		b = binary.LittleEndian.AppendUint32(b, 0) // Channel mask left unspecified
+		sub := uint16(formatPCM)
+		if f.SampleFormat == Float32 {
+			sub = formatIEEEFloat
+		}
+		b = binary.LittleEndian.AppendUint16(b, sub)
+		b = append(b, subFormatGUIDSuffix...)
+	}
+	return b
+}
+
+// subFormatGUIDSuffix is the common tail of the KSDATAFORMAT_SUBTYPE GUIDs
+var subFormatGUIDSuffix = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71,
+}
+
+// Write appends raw sample data that is already encoded in the writer's
+// format. The length of p must be a whole number of frames.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if len(p)%w.format.BlockAlign() != 0 {
+		return 0, fmt.Errorf("wavfile: %d bytes is not a whole number of %d-byte frames", len(p), w.format.BlockAlign())
+	}
+	n, err := w.w.Write(p)
+	w.dataSize += uint64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.updateInterval > 0 && time.Since(w.lastUpdate) >= w.updateInterval {
+		if err := w.Flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// WriteFloat32 encodes interleaved samples in the range [-1.0, 1.0] and
+// appends them. Integer formats clip out-of-range values.
+func (w *Writer) WriteFloat32(samples []float32) error {
+	size := w.format.SampleFormat.BitsPerSample() / 8
+	buf := w.buffer(len(samples) * size)
+	for i, s := range samples {
+		putFloat32(buf[i*size:], w.format.SampleFormat, s)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteInt16 encodes interleaved 16-bit samples and appends them.
+func (w *Writer) WriteInt16(samples []int16) error {
+	size := w.format.SampleFormat.BitsPerSample() / 8
+	buf := w.buffer(len(samples) * size)
+	for i, s := range samples {
+		b := buf[i*size:]
+		switch w.format.SampleFormat {
+		case PCM16:
+			binary.LittleEndian.PutUint16(b, uint16(s))
+		case PCM24:
+			v := int32(s) << 8
+			b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+		case PCM32:
+			binary.LittleEndian.PutUint32(b, uint32(int32(s)<<16))
+		case Float32:
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(s)/32768.0))
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func (w *Writer) buffer(n int) []byte {
+	if cap(w.buf) < n {
+		w.buf = make([]byte, n)
+	}
+	return w.buf[:n]
+}
+
+func putFloat32(b []byte, format SampleFormat, s float32) {
+	if format == Float32 {
+		binary.LittleEndian.PutUint32(b, math.Float32bits(s))
+		return
+	}
+	// Limit value to [-1.0, 1.0] range
+	if s > 1.0 {
+		s = 1.0
+	} else if s < -1.0 {
+		s = -1.0
+	}
+	switch format {
+	case PCM16:
+		binary.LittleEndian.PutUint16(b, uint16(int16(s*32767.0)))
+	case PCM24:
+		v := int32(s * 8388607.0)
+		b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+	case PCM32:
+		binary.LittleEndian.PutUint32(b, uint32(int32(float64(s)*2147483647.0)))
+	}
+}
+
+// Flush rewrites the header with the sizes of the data written so far.
+func (w *Writer) Flush() error {
+	if w.closed {
+		return ErrClosed
+	}
+	return w.updateHeader()
+}
+
+func (w *Writer) updateHeader() error {
+	// Data ends at the current write position
+	end := w.dataSizeOffset + 4 + int64(w.dataSize)
+	riffSize := uint64(end) - 8
+	if w.padded {
+		riffSize++ // Account for the pad byte written on Close
+	}
+
+	if riffSize > maxRIFFSize || w.rf64 {
+		if err := w.writeRF64Header(riffSize); err != nil {
+			return err
+		}
+	} else {
+		if err := w.writeAt(riffSizeOffset, binary.LittleEndian.AppendUint32(nil, uint32(riffSize))); err != nil {
+			return err
+		}
+		if err := w.writeAt(w.dataSizeOffset, binary.LittleEndian.AppendUint32(nil, uint32(w.dataSize))); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.w.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	if s, ok := w.w.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return err
+		}
+	}
+	w.lastUpdate = time.Now()
+	return nil
+}
+
+// writeRF64Header converts the reserved JUNK chunk into a ds64 chunk that
+// carries the 64-bit sizes, as described in EBU Tech 3306.
+func (w *Writer) writeRF64Header(riffSize uint64) error {
+	if !w.rf64 {
+		if err := w.writeAt(0, []byte("RF64")); err != nil {
+			return err
+		}
+		if err := w.writeAt(junkOffset, []byte("ds64")); err != nil {
+			return err
+		}
+		if err := w.writeAt(riffSizeOffset, binary.LittleEndian.AppendUint32(nil, math.MaxUint32)); err != nil {
+			return err
+		}
+		if err := w.writeAt(w.dataSizeOffset, binary.LittleEndian.AppendUint32(nil, math.MaxUint32)); err != nil {
+			return err
+		}
+		w.rf64 = true
+	}
+
+	ds64 := make([]byte, 0, ds64BodySize)
+	ds64 = binary.LittleEndian.AppendUint64(ds64, riffSize)
+	ds64 = binary.LittleEndian.AppendUint64(ds64, w.dataSize)
+	ds64 = binary.LittleEndian.AppendUint64(ds64, uint64(w.Frames()))
+	ds64 = binary.LittleEndian.AppendUint32(ds64, 0) // No table entries
+	return w.writeAt(junkOffset+8, ds64)
+}
+
+func (w *Writer) writeAt(offset int64, b []byte) error {
+	if _, err := w.w.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// Close pads the data chunk if needed, writes the final header and closes
+// the underlying file if it was opened by Create.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	err := w.finish()
+	w.closed = true
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (w *Writer) finish() error {
+	if w.dataSize%2 == 1 {
+		if _, err := w.w.Write([]byte{0}); err != nil {
+			return err
+		}
+		w.padded = true
+	}
+	return w.updateHeader()
+}
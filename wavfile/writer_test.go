@@ -0,0 +1,167 @@
+package wavfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r *Reader) []float32 {
+	t.Helper()
+	var out []float32
+	buf := make([]float32, 256*r.Format().Channels)
+	for {
+		n, err := r.ReadFloat32(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	formats := []SampleFormat{PCM16, PCM24, PCM32, Float32}
+	for _, sf := range formats {
+		for _, channels := range []int{1, 2, 6} {
+			format := Format{SampleRate: 48000, Channels: channels, SampleFormat: sf}
+			t.Run(fmt.Sprintf("%v/%dch", sf, channels), func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "out.wav")
+				w, err := Create(path, format)
+				require.NoError(t, err)
+
+				samples := make([]float32, 999*channels)
+				for i := range samples {
+					samples[i] = float32(i%200-100) / 100
+				}
+				require.NoError(t, w.WriteFloat32(samples))
+				assert.Equal(t, int64(999), w.Frames())
+				require.NoError(t, w.Close())
+
+				r, err := Open(path)
+				require.NoError(t, err)
+				defer r.Close()
+				assert.Equal(t, format, r.Format())
+				assert.Equal(t, int64(999), r.Frames())
+
+				got := readAll(t, r)
+				require.Len(t, got, len(samples))
+				for i := range samples {
+					assert.InDelta(t, samples[i], got[i], 1e-4)
+				}
+			})
+		}
+	}
+}
+
+func TestWriterInt16(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	w, err := Create(path, Format{SampleRate: 24000, Channels: 1, SampleFormat: PCM24})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteInt16([]int16{0, 16384, -16384, 32767}))
+	require.NoError(t, w.Close())
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	got := readAll(t, r)
+	assert.InDeltaSlice(t, []float32{0, 0.5, -0.5, 1}, got, 1e-4)
+}
+
+func TestWriterRejectsPartialFrames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	w, err := Create(path, Format{SampleRate: 48000, Channels: 2, SampleFormat: PCM16})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Error(t, w.WriteFloat32([]float32{0, 0, 0}))
+}
+
+func TestWriterPadsOddDataChunk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	w, err := Create(path, Format{SampleRate: 8000, Channels: 1, SampleFormat: PCM24})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteFloat32([]float32{0.25}))
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(data)%2)
+	assert.Equal(t, uint32(len(data)-8), binary.LittleEndian.Uint32(data[4:8]))
+}
+
+func TestWriterPeriodicUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	w, err := Create(path, Format{SampleRate: 48000, Channels: 1, SampleFormat: PCM16})
+	require.NoError(t, err)
+	defer w.Close()
+	w.SetUpdateInterval(time.Nanosecond)
+
+	require.NoError(t, w.WriteFloat32(make([]float32, 480)))
+
+	// Without closing, the header already describes the data written
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, int64(480), r.Frames())
+	assert.Len(t, readAll(t, r), 480)
+}
+
+func TestWriterUnfinishedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	w, err := Create(path, Format{SampleRate: 48000, Channels: 2, SampleFormat: Float32})
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.WriteFloat32(make([]float32, 200)))
+
+	// Simulate a crash: the header sizes were never written
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, int64(-1), r.Frames())
+	assert.Len(t, readAll(t, r), 200)
+}
+
+func TestWriterRF64(t *testing.T) {
+	saved := maxRIFFSize
+	maxRIFFSize = 1000
+	defer func() { maxRIFFSize = saved }()
+
+	path := filepath.Join(t.TempDir(), "out.wav")
+	w, err := Create(path, Format{SampleRate: 48000, Channels: 1, SampleFormat: PCM16})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteFloat32(make([]float32, 100)))
+	require.NoError(t, w.Flush())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "RIFF", string(data[0:4]))
+
+	require.NoError(t, w.WriteFloat32(make([]float32, 1000)))
+	require.NoError(t, w.Close())
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "RF64", string(data[0:4]))
+	assert.Equal(t, "ds64", string(data[12:16]))
+	assert.Equal(t, uint64(2200), binary.LittleEndian.Uint64(data[28:36]))
+
+	r, err := Open(path)
+	require.NoError(t, err)
+	defer r.Close()
+	assert.Equal(t, int64(1100), r.Frames())
+	assert.Len(t, readAll(t, r), 1100)
+}
+
+func TestFormatValidate(t *testing.T) {
+	assert.NoError(t, Format{SampleRate: 48000, Channels: 1, SampleFormat: PCM16}.Validate())
+	assert.Error(t, Format{SampleRate: 0, Channels: 1, SampleFormat: PCM16}.Validate())
+	assert.Error(t, Format{SampleRate: 48000, Channels: 0, SampleFormat: PCM16}.Validate())
+	assert.Error(t, Format{SampleRate: 48000, Channels: 1}.Validate())
+}